@@ -0,0 +1,91 @@
+// Package api is the gRPC API of fdevices, defined in fdevices.proto. Along
+// with the generated code it converts the types of the schema package to
+// their protobuf messages, the server lives in the web package with the other
+// transports.
+package api
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative fdevices.proto
+
+import (
+	"github.com/FarmRadioHangar/fdevices/schema"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// FromDongle returns the message of the dongle d.
+func FromDongle(d *schema.Dongle) *Dongle {
+	o := &Dongle{
+		Imei:       d.IMEI,
+		Imsi:       d.IMSI,
+		Iccid:      d.ICCID,
+		Path:       d.Path,
+		Symlink:    d.IsSymlinked,
+		Ati:        d.ATI,
+		Properties: d.Properties,
+		Labels:     d.Labels,
+		Operator:   d.Operator,
+		Sim:        d.SIM,
+		Health:     d.Health,
+	}
+	if d.Signal != nil {
+		n := int32(*d.Signal)
+		o.Signal = &n
+	}
+	return o
+}
+
+// FromPort returns the message of the port p.
+func FromPort(p *schema.Port) *Port {
+	return &Port{
+		Path:       p.Path,
+		Status:     p.Status,
+		Reason:     p.Reason,
+		Properties: p.Properties,
+		CreatedOn:  timestamppb.New(p.CreatedOn),
+	}
+}
+
+// FromEvent returns the message of the event e. Payloads of types the
+// messages do not know about are left out.
+func FromEvent(e *schema.Event) *Event {
+	o := &Event{
+		Version: int32(e.Version),
+		Seq:     e.Seq,
+		Boot:    e.Boot,
+		Time:    timestamppb.New(e.Time),
+		Type:    string(e.Type),
+		Device: &Device{
+			Imei:   e.Device.IMEI,
+			Imsi:   e.Device.IMSI,
+			Iccid:  e.Device.ICCID,
+			Path:   e.Device.Path,
+			Labels: e.Device.Labels,
+		},
+		Source: string(e.Source),
+	}
+	for _, c := range e.Changes {
+		o.Changes = append(o.Changes, &Change{Field: c.Field, Old: c.Old, New: c.New})
+	}
+	switch v := e.Data.(type) {
+	case *schema.Dongle:
+		o.Data = &Event_Dongle{Dongle: FromDongle(v)}
+	case *schema.Port:
+		o.Data = &Event_Port{Port: FromPort(v)}
+	case *schema.Missed:
+		o.Data = &Event_Missed{Missed: &Missed{Since: v.Since, Oldest: v.Oldest}}
+	}
+	return o
+}
+
+// Schema returns the filter f as it is used by the other transports.
+func (f *Filter) Schema() *schema.Filter {
+	o := &schema.Filter{
+		IMEI:   f.GetImei(),
+		IMSI:   f.GetImsi(),
+		ICCID:  f.GetIccid(),
+		Labels: f.GetLabels(),
+	}
+	for _, t := range f.GetTypes() {
+		o.Types = append(o.Types, schema.Type(t))
+	}
+	return o
+}
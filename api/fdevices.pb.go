@@ -0,0 +1,1541 @@
+// The gRPC API of fdevices. It offers what the REST API and the websocket
+// offer, for clients which prefer protobuf to JSON.
+//
+// The Go code is generated with
+//
+//	protoc --go_out=. --go_opt=paths=source_relative \
+//		--go-grpc_out=. --go-grpc_opt=paths=source_relative fdevices.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        v5.29.3
+// source: fdevices.proto
+
+package api
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Dongle is a 3G dongle.
+type Dongle struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Imei       string                 `protobuf:"bytes,1,opt,name=imei,proto3" json:"imei,omitempty"`
+	Imsi       string                 `protobuf:"bytes,2,opt,name=imsi,proto3" json:"imsi,omitempty"`
+	Iccid      string                 `protobuf:"bytes,3,opt,name=iccid,proto3" json:"iccid,omitempty"`
+	Path       string                 `protobuf:"bytes,4,opt,name=path,proto3" json:"path,omitempty"`
+	Symlink    bool                   `protobuf:"varint,5,opt,name=symlink,proto3" json:"symlink,omitempty"`
+	Ati        string                 `protobuf:"bytes,6,opt,name=ati,proto3" json:"ati,omitempty"`
+	Properties map[string]string      `protobuf:"bytes,7,rep,name=properties,proto3" json:"properties,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Labels     map[string]string      `protobuf:"bytes,8,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Operator   string                 `protobuf:"bytes,9,opt,name=operator,proto3" json:"operator,omitempty"`
+	// signal is the RSSI from 0 to 31, it is not set when it is not known.
+	Signal *int32 `protobuf:"varint,10,opt,name=signal,proto3,oneof" json:"signal,omitempty"`
+	// sim is the state of the SIM: ready, pin, puk or absent, it is empty when
+	// it is not known.
+	Sim string `protobuf:"bytes,11,opt,name=sim,proto3" json:"sim,omitempty"`
+	// health is ok when the dongle answered when it was last polled,
+	// otherwise why it did not.
+	Health        string `protobuf:"bytes,12,opt,name=health,proto3" json:"health,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Dongle) Reset() {
+	*x = Dongle{}
+	mi := &file_fdevices_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Dongle) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Dongle) ProtoMessage() {}
+
+func (x *Dongle) ProtoReflect() protoreflect.Message {
+	mi := &file_fdevices_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Dongle.ProtoReflect.Descriptor instead.
+func (*Dongle) Descriptor() ([]byte, []int) {
+	return file_fdevices_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Dongle) GetImei() string {
+	if x != nil {
+		return x.Imei
+	}
+	return ""
+}
+
+func (x *Dongle) GetImsi() string {
+	if x != nil {
+		return x.Imsi
+	}
+	return ""
+}
+
+func (x *Dongle) GetIccid() string {
+	if x != nil {
+		return x.Iccid
+	}
+	return ""
+}
+
+func (x *Dongle) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *Dongle) GetSymlink() bool {
+	if x != nil {
+		return x.Symlink
+	}
+	return false
+}
+
+func (x *Dongle) GetAti() string {
+	if x != nil {
+		return x.Ati
+	}
+	return ""
+}
+
+func (x *Dongle) GetProperties() map[string]string {
+	if x != nil {
+		return x.Properties
+	}
+	return nil
+}
+
+func (x *Dongle) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+func (x *Dongle) GetOperator() string {
+	if x != nil {
+		return x.Operator
+	}
+	return ""
+}
+
+func (x *Dongle) GetSignal() int32 {
+	if x != nil && x.Signal != nil {
+		return *x.Signal
+	}
+	return 0
+}
+
+func (x *Dongle) GetSim() string {
+	if x != nil {
+		return x.Sim
+	}
+	return ""
+}
+
+func (x *Dongle) GetHealth() string {
+	if x != nil {
+		return x.Health
+	}
+	return ""
+}
+
+// Port is a serial device which is not a dongle.
+type Port struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Path          string                 `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	Status        string                 `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	Reason        string                 `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+	Properties    map[string]string      `protobuf:"bytes,4,rep,name=properties,proto3" json:"properties,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	CreatedOn     *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=created_on,json=createdOn,proto3" json:"created_on,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Port) Reset() {
+	*x = Port{}
+	mi := &file_fdevices_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Port) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Port) ProtoMessage() {}
+
+func (x *Port) ProtoReflect() protoreflect.Message {
+	mi := &file_fdevices_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Port.ProtoReflect.Descriptor instead.
+func (*Port) Descriptor() ([]byte, []int) {
+	return file_fdevices_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Port) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *Port) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Port) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *Port) GetProperties() map[string]string {
+	if x != nil {
+		return x.Properties
+	}
+	return nil
+}
+
+func (x *Port) GetCreatedOn() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedOn
+	}
+	return nil
+}
+
+// Device identifies the device an event is about.
+type Device struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Imei          string                 `protobuf:"bytes,1,opt,name=imei,proto3" json:"imei,omitempty"`
+	Imsi          string                 `protobuf:"bytes,2,opt,name=imsi,proto3" json:"imsi,omitempty"`
+	Iccid         string                 `protobuf:"bytes,3,opt,name=iccid,proto3" json:"iccid,omitempty"`
+	Path          string                 `protobuf:"bytes,4,opt,name=path,proto3" json:"path,omitempty"`
+	Labels        map[string]string      `protobuf:"bytes,5,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Device) Reset() {
+	*x = Device{}
+	mi := &file_fdevices_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Device) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Device) ProtoMessage() {}
+
+func (x *Device) ProtoReflect() protoreflect.Message {
+	mi := &file_fdevices_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Device.ProtoReflect.Descriptor instead.
+func (*Device) Descriptor() ([]byte, []int) {
+	return file_fdevices_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Device) GetImei() string {
+	if x != nil {
+		return x.Imei
+	}
+	return ""
+}
+
+func (x *Device) GetImsi() string {
+	if x != nil {
+		return x.Imsi
+	}
+	return ""
+}
+
+func (x *Device) GetIccid() string {
+	if x != nil {
+		return x.Iccid
+	}
+	return ""
+}
+
+func (x *Device) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *Device) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+// Change is a field of a device which changed.
+type Change struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Field         string                 `protobuf:"bytes,1,opt,name=field,proto3" json:"field,omitempty"`
+	Old           string                 `protobuf:"bytes,2,opt,name=old,proto3" json:"old,omitempty"`
+	New           string                 `protobuf:"bytes,3,opt,name=new,proto3" json:"new,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Change) Reset() {
+	*x = Change{}
+	mi := &file_fdevices_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Change) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Change) ProtoMessage() {}
+
+func (x *Change) ProtoReflect() protoreflect.Message {
+	mi := &file_fdevices_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Change.ProtoReflect.Descriptor instead.
+func (*Change) Descriptor() ([]byte, []int) {
+	return file_fdevices_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Change) GetField() string {
+	if x != nil {
+		return x.Field
+	}
+	return ""
+}
+
+func (x *Change) GetOld() string {
+	if x != nil {
+		return x.Old
+	}
+	return ""
+}
+
+func (x *Change) GetNew() string {
+	if x != nil {
+		return x.New
+	}
+	return ""
+}
+
+// Missed describes the events a client has missed, it is the payload of gap
+// events.
+type Missed struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Since         uint64                 `protobuf:"varint,1,opt,name=since,proto3" json:"since,omitempty"`
+	Oldest        uint64                 `protobuf:"varint,2,opt,name=oldest,proto3" json:"oldest,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Missed) Reset() {
+	*x = Missed{}
+	mi := &file_fdevices_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Missed) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Missed) ProtoMessage() {}
+
+func (x *Missed) ProtoReflect() protoreflect.Message {
+	mi := &file_fdevices_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Missed.ProtoReflect.Descriptor instead.
+func (*Missed) Descriptor() ([]byte, []int) {
+	return file_fdevices_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Missed) GetSince() uint64 {
+	if x != nil {
+		return x.Since
+	}
+	return 0
+}
+
+func (x *Missed) GetOldest() uint64 {
+	if x != nil {
+		return x.Oldest
+	}
+	return 0
+}
+
+// Event is an event of the stream, see the schema package for the meaning of
+// its fields.
+type Event struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Version int32                  `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	Seq     uint64                 `protobuf:"varint,2,opt,name=seq,proto3" json:"seq,omitempty"`
+	Time    *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=time,proto3" json:"time,omitempty"`
+	Type    string                 `protobuf:"bytes,4,opt,name=type,proto3" json:"type,omitempty"`
+	Device  *Device                `protobuf:"bytes,5,opt,name=device,proto3" json:"device,omitempty"`
+	Source  string                 `protobuf:"bytes,6,opt,name=source,proto3" json:"source,omitempty"`
+	Changes []*Change              `protobuf:"bytes,7,rep,name=changes,proto3" json:"changes,omitempty"`
+	// Types that are valid to be assigned to Data:
+	//
+	//	*Event_Dongle
+	//	*Event_Port
+	//	*Event_Missed
+	Data          isEvent_Data `protobuf_oneof:"data"`
+	Boot          string       `protobuf:"bytes,11,opt,name=boot,proto3" json:"boot,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_fdevices_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_fdevices_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_fdevices_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Event) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *Event) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *Event) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *Event) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Event) GetDevice() *Device {
+	if x != nil {
+		return x.Device
+	}
+	return nil
+}
+
+func (x *Event) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *Event) GetChanges() []*Change {
+	if x != nil {
+		return x.Changes
+	}
+	return nil
+}
+
+func (x *Event) GetData() isEvent_Data {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *Event) GetDongle() *Dongle {
+	if x != nil {
+		if x, ok := x.Data.(*Event_Dongle); ok {
+			return x.Dongle
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetPort() *Port {
+	if x != nil {
+		if x, ok := x.Data.(*Event_Port); ok {
+			return x.Port
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetMissed() *Missed {
+	if x != nil {
+		if x, ok := x.Data.(*Event_Missed); ok {
+			return x.Missed
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetBoot() string {
+	if x != nil {
+		return x.Boot
+	}
+	return ""
+}
+
+type isEvent_Data interface {
+	isEvent_Data()
+}
+
+type Event_Dongle struct {
+	Dongle *Dongle `protobuf:"bytes,8,opt,name=dongle,proto3,oneof"`
+}
+
+type Event_Port struct {
+	Port *Port `protobuf:"bytes,9,opt,name=port,proto3,oneof"`
+}
+
+type Event_Missed struct {
+	Missed *Missed `protobuf:"bytes,10,opt,name=missed,proto3,oneof"`
+}
+
+func (*Event_Dongle) isEvent_Data() {}
+
+func (*Event_Port) isEvent_Data() {}
+
+func (*Event_Missed) isEvent_Data() {}
+
+// Filter selects dongles and events. Within a field the values are
+// alternatives, every field which is set has to match.
+type Filter struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// types only apply to events.
+	Types []string `protobuf:"bytes,1,rep,name=types,proto3" json:"types,omitempty"`
+	Imei  []string `protobuf:"bytes,2,rep,name=imei,proto3" json:"imei,omitempty"`
+	Imsi  []string `protobuf:"bytes,3,rep,name=imsi,proto3" json:"imsi,omitempty"`
+	Iccid []string `protobuf:"bytes,4,rep,name=iccid,proto3" json:"iccid,omitempty"`
+	// labels must all be set to the same value on the dongle.
+	Labels        map[string]string `protobuf:"bytes,5,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Filter) Reset() {
+	*x = Filter{}
+	mi := &file_fdevices_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Filter) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Filter) ProtoMessage() {}
+
+func (x *Filter) ProtoReflect() protoreflect.Message {
+	mi := &file_fdevices_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Filter.ProtoReflect.Descriptor instead.
+func (*Filter) Descriptor() ([]byte, []int) {
+	return file_fdevices_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Filter) GetTypes() []string {
+	if x != nil {
+		return x.Types
+	}
+	return nil
+}
+
+func (x *Filter) GetImei() []string {
+	if x != nil {
+		return x.Imei
+	}
+	return nil
+}
+
+func (x *Filter) GetImsi() []string {
+	if x != nil {
+		return x.Imsi
+	}
+	return nil
+}
+
+func (x *Filter) GetIccid() []string {
+	if x != nil {
+		return x.Iccid
+	}
+	return nil
+}
+
+func (x *Filter) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+type ListDonglesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Filter        *Filter                `protobuf:"bytes,1,opt,name=filter,proto3" json:"filter,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListDonglesRequest) Reset() {
+	*x = ListDonglesRequest{}
+	mi := &file_fdevices_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListDonglesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListDonglesRequest) ProtoMessage() {}
+
+func (x *ListDonglesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_fdevices_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListDonglesRequest.ProtoReflect.Descriptor instead.
+func (*ListDonglesRequest) Descriptor() ([]byte, []int) {
+	return file_fdevices_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ListDonglesRequest) GetFilter() *Filter {
+	if x != nil {
+		return x.Filter
+	}
+	return nil
+}
+
+type ListDonglesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Dongles       []*Dongle              `protobuf:"bytes,1,rep,name=dongles,proto3" json:"dongles,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListDonglesResponse) Reset() {
+	*x = ListDonglesResponse{}
+	mi := &file_fdevices_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListDonglesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListDonglesResponse) ProtoMessage() {}
+
+func (x *ListDonglesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_fdevices_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListDonglesResponse.ProtoReflect.Descriptor instead.
+func (*ListDonglesResponse) Descriptor() ([]byte, []int) {
+	return file_fdevices_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ListDonglesResponse) GetDongles() []*Dongle {
+	if x != nil {
+		return x.Dongles
+	}
+	return nil
+}
+
+type GetDongleRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// id is matched against the IMEI, IMSI and ICCID of the dongles. An id
+	// holding = is a label selector like port=1-1.3,name=news.
+	Id            string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetDongleRequest) Reset() {
+	*x = GetDongleRequest{}
+	mi := &file_fdevices_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetDongleRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetDongleRequest) ProtoMessage() {}
+
+func (x *GetDongleRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_fdevices_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetDongleRequest.ProtoReflect.Descriptor instead.
+func (*GetDongleRequest) Descriptor() ([]byte, []int) {
+	return file_fdevices_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *GetDongleRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type WatchEventsRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Filter *Filter                `protobuf:"bytes,1,opt,name=filter,proto3" json:"filter,omitempty"`
+	// since is the sequence number of the last event the client has seen,
+	// the events after it are sent instead of the snapshot. It is only
+	// honoured when boot is the boot of that event, events from before a
+	// restart are lost.
+	Since uint64 `protobuf:"varint,2,opt,name=since,proto3" json:"since,omitempty"`
+	Boot  string `protobuf:"bytes,4,opt,name=boot,proto3" json:"boot,omitempty"`
+	// policy is what is done when the client does not keep up, one of
+	// drop-oldest, drop-newest or disconnect. Defaults to disconnect, which
+	// ends the stream with RESOURCE_EXHAUSTED.
+	Policy        string `protobuf:"bytes,3,opt,name=policy,proto3" json:"policy,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchEventsRequest) Reset() {
+	*x = WatchEventsRequest{}
+	mi := &file_fdevices_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchEventsRequest) ProtoMessage() {}
+
+func (x *WatchEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_fdevices_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchEventsRequest.ProtoReflect.Descriptor instead.
+func (*WatchEventsRequest) Descriptor() ([]byte, []int) {
+	return file_fdevices_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *WatchEventsRequest) GetFilter() *Filter {
+	if x != nil {
+		return x.Filter
+	}
+	return nil
+}
+
+func (x *WatchEventsRequest) GetSince() uint64 {
+	if x != nil {
+		return x.Since
+	}
+	return 0
+}
+
+func (x *WatchEventsRequest) GetBoot() string {
+	if x != nil {
+		return x.Boot
+	}
+	return ""
+}
+
+func (x *WatchEventsRequest) GetPolicy() string {
+	if x != nil {
+		return x.Policy
+	}
+	return ""
+}
+
+// Snapshot is the state of the dongles when the stream starts. The events
+// which follow come after seq, in the process boot.
+type Snapshot struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Seq           uint64                 `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	Dongles       []*Dongle              `protobuf:"bytes,2,rep,name=dongles,proto3" json:"dongles,omitempty"`
+	Boot          string                 `protobuf:"bytes,3,opt,name=boot,proto3" json:"boot,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Snapshot) Reset() {
+	*x = Snapshot{}
+	mi := &file_fdevices_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Snapshot) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Snapshot) ProtoMessage() {}
+
+func (x *Snapshot) ProtoReflect() protoreflect.Message {
+	mi := &file_fdevices_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Snapshot.ProtoReflect.Descriptor instead.
+func (*Snapshot) Descriptor() ([]byte, []int) {
+	return file_fdevices_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *Snapshot) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *Snapshot) GetDongles() []*Dongle {
+	if x != nil {
+		return x.Dongles
+	}
+	return nil
+}
+
+func (x *Snapshot) GetBoot() string {
+	if x != nil {
+		return x.Boot
+	}
+	return ""
+}
+
+type WatchEventsResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Message:
+	//
+	//	*WatchEventsResponse_Snapshot
+	//	*WatchEventsResponse_Event
+	Message       isWatchEventsResponse_Message `protobuf_oneof:"message"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchEventsResponse) Reset() {
+	*x = WatchEventsResponse{}
+	mi := &file_fdevices_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchEventsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchEventsResponse) ProtoMessage() {}
+
+func (x *WatchEventsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_fdevices_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchEventsResponse.ProtoReflect.Descriptor instead.
+func (*WatchEventsResponse) Descriptor() ([]byte, []int) {
+	return file_fdevices_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *WatchEventsResponse) GetMessage() isWatchEventsResponse_Message {
+	if x != nil {
+		return x.Message
+	}
+	return nil
+}
+
+func (x *WatchEventsResponse) GetSnapshot() *Snapshot {
+	if x != nil {
+		if x, ok := x.Message.(*WatchEventsResponse_Snapshot); ok {
+			return x.Snapshot
+		}
+	}
+	return nil
+}
+
+func (x *WatchEventsResponse) GetEvent() *Event {
+	if x != nil {
+		if x, ok := x.Message.(*WatchEventsResponse_Event); ok {
+			return x.Event
+		}
+	}
+	return nil
+}
+
+type isWatchEventsResponse_Message interface {
+	isWatchEventsResponse_Message()
+}
+
+type WatchEventsResponse_Snapshot struct {
+	Snapshot *Snapshot `protobuf:"bytes,1,opt,name=snapshot,proto3,oneof"`
+}
+
+type WatchEventsResponse_Event struct {
+	Event *Event `protobuf:"bytes,2,opt,name=event,proto3,oneof"`
+}
+
+func (*WatchEventsResponse_Snapshot) isWatchEventsResponse_Message() {}
+
+func (*WatchEventsResponse_Event) isWatchEventsResponse_Message() {}
+
+type SendSMSRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// dongle is looked up like the id of GetDongleRequest.
+	Dongle        string `protobuf:"bytes,1,opt,name=dongle,proto3" json:"dongle,omitempty"`
+	Number        string `protobuf:"bytes,2,opt,name=number,proto3" json:"number,omitempty"`
+	Text          string `protobuf:"bytes,3,opt,name=text,proto3" json:"text,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SendSMSRequest) Reset() {
+	*x = SendSMSRequest{}
+	mi := &file_fdevices_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SendSMSRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SendSMSRequest) ProtoMessage() {}
+
+func (x *SendSMSRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_fdevices_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SendSMSRequest.ProtoReflect.Descriptor instead.
+func (*SendSMSRequest) Descriptor() ([]byte, []int) {
+	return file_fdevices_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *SendSMSRequest) GetDongle() string {
+	if x != nil {
+		return x.Dongle
+	}
+	return ""
+}
+
+func (x *SendSMSRequest) GetNumber() string {
+	if x != nil {
+		return x.Number
+	}
+	return ""
+}
+
+func (x *SendSMSRequest) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+type SendSMSResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SendSMSResponse) Reset() {
+	*x = SendSMSResponse{}
+	mi := &file_fdevices_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SendSMSResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SendSMSResponse) ProtoMessage() {}
+
+func (x *SendSMSResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_fdevices_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SendSMSResponse.ProtoReflect.Descriptor instead.
+func (*SendSMSResponse) Descriptor() ([]byte, []int) {
+	return file_fdevices_proto_rawDescGZIP(), []int{14}
+}
+
+type RunATRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// dongle is looked up like the id of GetDongleRequest.
+	Dongle        string `protobuf:"bytes,1,opt,name=dongle,proto3" json:"dongle,omitempty"`
+	Command       string `protobuf:"bytes,2,opt,name=command,proto3" json:"command,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RunATRequest) Reset() {
+	*x = RunATRequest{}
+	mi := &file_fdevices_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RunATRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RunATRequest) ProtoMessage() {}
+
+func (x *RunATRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_fdevices_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RunATRequest.ProtoReflect.Descriptor instead.
+func (*RunATRequest) Descriptor() ([]byte, []int) {
+	return file_fdevices_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *RunATRequest) GetDongle() string {
+	if x != nil {
+		return x.Dongle
+	}
+	return ""
+}
+
+func (x *RunATRequest) GetCommand() string {
+	if x != nil {
+		return x.Command
+	}
+	return ""
+}
+
+type RunATResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Output        string                 `protobuf:"bytes,1,opt,name=output,proto3" json:"output,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RunATResponse) Reset() {
+	*x = RunATResponse{}
+	mi := &file_fdevices_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RunATResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RunATResponse) ProtoMessage() {}
+
+func (x *RunATResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_fdevices_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RunATResponse.ProtoReflect.Descriptor instead.
+func (*RunATResponse) Descriptor() ([]byte, []int) {
+	return file_fdevices_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *RunATResponse) GetOutput() string {
+	if x != nil {
+		return x.Output
+	}
+	return ""
+}
+
+type ResetDongleRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// dongle is looked up like the id of GetDongleRequest.
+	Dongle        string `protobuf:"bytes,1,opt,name=dongle,proto3" json:"dongle,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResetDongleRequest) Reset() {
+	*x = ResetDongleRequest{}
+	mi := &file_fdevices_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResetDongleRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResetDongleRequest) ProtoMessage() {}
+
+func (x *ResetDongleRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_fdevices_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResetDongleRequest.ProtoReflect.Descriptor instead.
+func (*ResetDongleRequest) Descriptor() ([]byte, []int) {
+	return file_fdevices_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *ResetDongleRequest) GetDongle() string {
+	if x != nil {
+		return x.Dongle
+	}
+	return ""
+}
+
+type ResetDongleResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResetDongleResponse) Reset() {
+	*x = ResetDongleResponse{}
+	mi := &file_fdevices_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResetDongleResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResetDongleResponse) ProtoMessage() {}
+
+func (x *ResetDongleResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_fdevices_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResetDongleResponse.ProtoReflect.Descriptor instead.
+func (*ResetDongleResponse) Descriptor() ([]byte, []int) {
+	return file_fdevices_proto_rawDescGZIP(), []int{18}
+}
+
+var File_fdevices_proto protoreflect.FileDescriptor
+
+const file_fdevices_proto_rawDesc = "" +
+	"\n" +
+	"\x0efdevices.proto\x12\vfdevices.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xec\x03\n" +
+	"\x06Dongle\x12\x12\n" +
+	"\x04imei\x18\x01 \x01(\tR\x04imei\x12\x12\n" +
+	"\x04imsi\x18\x02 \x01(\tR\x04imsi\x12\x14\n" +
+	"\x05iccid\x18\x03 \x01(\tR\x05iccid\x12\x12\n" +
+	"\x04path\x18\x04 \x01(\tR\x04path\x12\x18\n" +
+	"\asymlink\x18\x05 \x01(\bR\asymlink\x12\x10\n" +
+	"\x03ati\x18\x06 \x01(\tR\x03ati\x12C\n" +
+	"\n" +
+	"properties\x18\a \x03(\v2#.fdevices.v1.Dongle.PropertiesEntryR\n" +
+	"properties\x127\n" +
+	"\x06labels\x18\b \x03(\v2\x1f.fdevices.v1.Dongle.LabelsEntryR\x06labels\x12\x1a\n" +
+	"\boperator\x18\t \x01(\tR\boperator\x12\x1b\n" +
+	"\x06signal\x18\n" +
+	" \x01(\x05H\x00R\x06signal\x88\x01\x01\x12\x10\n" +
+	"\x03sim\x18\v \x01(\tR\x03sim\x12\x16\n" +
+	"\x06health\x18\f \x01(\tR\x06health\x1a=\n" +
+	"\x0fPropertiesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01B\t\n" +
+	"\a_signal\"\x87\x02\n" +
+	"\x04Port\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x12\x16\n" +
+	"\x06reason\x18\x03 \x01(\tR\x06reason\x12A\n" +
+	"\n" +
+	"properties\x18\x04 \x03(\v2!.fdevices.v1.Port.PropertiesEntryR\n" +
+	"properties\x129\n" +
+	"\n" +
+	"created_on\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedOn\x1a=\n" +
+	"\x0fPropertiesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xce\x01\n" +
+	"\x06Device\x12\x12\n" +
+	"\x04imei\x18\x01 \x01(\tR\x04imei\x12\x12\n" +
+	"\x04imsi\x18\x02 \x01(\tR\x04imsi\x12\x14\n" +
+	"\x05iccid\x18\x03 \x01(\tR\x05iccid\x12\x12\n" +
+	"\x04path\x18\x04 \x01(\tR\x04path\x127\n" +
+	"\x06labels\x18\x05 \x03(\v2\x1f.fdevices.v1.Device.LabelsEntryR\x06labels\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"B\n" +
+	"\x06Change\x12\x14\n" +
+	"\x05field\x18\x01 \x01(\tR\x05field\x12\x10\n" +
+	"\x03old\x18\x02 \x01(\tR\x03old\x12\x10\n" +
+	"\x03new\x18\x03 \x01(\tR\x03new\"6\n" +
+	"\x06Missed\x12\x14\n" +
+	"\x05since\x18\x01 \x01(\x04R\x05since\x12\x16\n" +
+	"\x06oldest\x18\x02 \x01(\x04R\x06oldest\"\x8e\x03\n" +
+	"\x05Event\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\x05R\aversion\x12\x10\n" +
+	"\x03seq\x18\x02 \x01(\x04R\x03seq\x12.\n" +
+	"\x04time\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x12\n" +
+	"\x04type\x18\x04 \x01(\tR\x04type\x12+\n" +
+	"\x06device\x18\x05 \x01(\v2\x13.fdevices.v1.DeviceR\x06device\x12\x16\n" +
+	"\x06source\x18\x06 \x01(\tR\x06source\x12-\n" +
+	"\achanges\x18\a \x03(\v2\x13.fdevices.v1.ChangeR\achanges\x12-\n" +
+	"\x06dongle\x18\b \x01(\v2\x13.fdevices.v1.DongleH\x00R\x06dongle\x12'\n" +
+	"\x04port\x18\t \x01(\v2\x11.fdevices.v1.PortH\x00R\x04port\x12-\n" +
+	"\x06missed\x18\n" +
+	" \x01(\v2\x13.fdevices.v1.MissedH\x00R\x06missed\x12\x12\n" +
+	"\x04boot\x18\v \x01(\tR\x04bootB\x06\n" +
+	"\x04data\"\xd0\x01\n" +
+	"\x06Filter\x12\x14\n" +
+	"\x05types\x18\x01 \x03(\tR\x05types\x12\x12\n" +
+	"\x04imei\x18\x02 \x03(\tR\x04imei\x12\x12\n" +
+	"\x04imsi\x18\x03 \x03(\tR\x04imsi\x12\x14\n" +
+	"\x05iccid\x18\x04 \x03(\tR\x05iccid\x127\n" +
+	"\x06labels\x18\x05 \x03(\v2\x1f.fdevices.v1.Filter.LabelsEntryR\x06labels\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"A\n" +
+	"\x12ListDonglesRequest\x12+\n" +
+	"\x06filter\x18\x01 \x01(\v2\x13.fdevices.v1.FilterR\x06filter\"D\n" +
+	"\x13ListDonglesResponse\x12-\n" +
+	"\adongles\x18\x01 \x03(\v2\x13.fdevices.v1.DongleR\adongles\"\"\n" +
+	"\x10GetDongleRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x83\x01\n" +
+	"\x12WatchEventsRequest\x12+\n" +
+	"\x06filter\x18\x01 \x01(\v2\x13.fdevices.v1.FilterR\x06filter\x12\x14\n" +
+	"\x05since\x18\x02 \x01(\x04R\x05since\x12\x12\n" +
+	"\x04boot\x18\x04 \x01(\tR\x04boot\x12\x16\n" +
+	"\x06policy\x18\x03 \x01(\tR\x06policy\"_\n" +
+	"\bSnapshot\x12\x10\n" +
+	"\x03seq\x18\x01 \x01(\x04R\x03seq\x12-\n" +
+	"\adongles\x18\x02 \x03(\v2\x13.fdevices.v1.DongleR\adongles\x12\x12\n" +
+	"\x04boot\x18\x03 \x01(\tR\x04boot\"\x81\x01\n" +
+	"\x13WatchEventsResponse\x123\n" +
+	"\bsnapshot\x18\x01 \x01(\v2\x15.fdevices.v1.SnapshotH\x00R\bsnapshot\x12*\n" +
+	"\x05event\x18\x02 \x01(\v2\x12.fdevices.v1.EventH\x00R\x05eventB\t\n" +
+	"\amessage\"T\n" +
+	"\x0eSendSMSRequest\x12\x16\n" +
+	"\x06dongle\x18\x01 \x01(\tR\x06dongle\x12\x16\n" +
+	"\x06number\x18\x02 \x01(\tR\x06number\x12\x12\n" +
+	"\x04text\x18\x03 \x01(\tR\x04text\"\x11\n" +
+	"\x0fSendSMSResponse\"@\n" +
+	"\fRunATRequest\x12\x16\n" +
+	"\x06dongle\x18\x01 \x01(\tR\x06dongle\x12\x18\n" +
+	"\acommand\x18\x02 \x01(\tR\acommand\"'\n" +
+	"\rRunATResponse\x12\x16\n" +
+	"\x06output\x18\x01 \x01(\tR\x06output\",\n" +
+	"\x12ResetDongleRequest\x12\x16\n" +
+	"\x06dongle\x18\x01 \x01(\tR\x06dongle\"\x15\n" +
+	"\x13ResetDongleResponse2\xc8\x03\n" +
+	"\aDongles\x12P\n" +
+	"\vListDongles\x12\x1f.fdevices.v1.ListDonglesRequest\x1a .fdevices.v1.ListDonglesResponse\x12?\n" +
+	"\tGetDongle\x12\x1d.fdevices.v1.GetDongleRequest\x1a\x13.fdevices.v1.Dongle\x12R\n" +
+	"\vWatchEvents\x12\x1f.fdevices.v1.WatchEventsRequest\x1a .fdevices.v1.WatchEventsResponse0\x01\x12D\n" +
+	"\aSendSMS\x12\x1b.fdevices.v1.SendSMSRequest\x1a\x1c.fdevices.v1.SendSMSResponse\x12>\n" +
+	"\x05RunAT\x12\x19.fdevices.v1.RunATRequest\x1a\x1a.fdevices.v1.RunATResponse\x12P\n" +
+	"\vResetDongle\x12\x1f.fdevices.v1.ResetDongleRequest\x1a .fdevices.v1.ResetDongleResponseB)Z'github.com/FarmRadioHangar/fdevices/apib\x06proto3"
+
+var (
+	file_fdevices_proto_rawDescOnce sync.Once
+	file_fdevices_proto_rawDescData []byte
+)
+
+func file_fdevices_proto_rawDescGZIP() []byte {
+	file_fdevices_proto_rawDescOnce.Do(func() {
+		file_fdevices_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_fdevices_proto_rawDesc), len(file_fdevices_proto_rawDesc)))
+	})
+	return file_fdevices_proto_rawDescData
+}
+
+var file_fdevices_proto_msgTypes = make([]protoimpl.MessageInfo, 24)
+var file_fdevices_proto_goTypes = []any{
+	(*Dongle)(nil),                // 0: fdevices.v1.Dongle
+	(*Port)(nil),                  // 1: fdevices.v1.Port
+	(*Device)(nil),                // 2: fdevices.v1.Device
+	(*Change)(nil),                // 3: fdevices.v1.Change
+	(*Missed)(nil),                // 4: fdevices.v1.Missed
+	(*Event)(nil),                 // 5: fdevices.v1.Event
+	(*Filter)(nil),                // 6: fdevices.v1.Filter
+	(*ListDonglesRequest)(nil),    // 7: fdevices.v1.ListDonglesRequest
+	(*ListDonglesResponse)(nil),   // 8: fdevices.v1.ListDonglesResponse
+	(*GetDongleRequest)(nil),      // 9: fdevices.v1.GetDongleRequest
+	(*WatchEventsRequest)(nil),    // 10: fdevices.v1.WatchEventsRequest
+	(*Snapshot)(nil),              // 11: fdevices.v1.Snapshot
+	(*WatchEventsResponse)(nil),   // 12: fdevices.v1.WatchEventsResponse
+	(*SendSMSRequest)(nil),        // 13: fdevices.v1.SendSMSRequest
+	(*SendSMSResponse)(nil),       // 14: fdevices.v1.SendSMSResponse
+	(*RunATRequest)(nil),          // 15: fdevices.v1.RunATRequest
+	(*RunATResponse)(nil),         // 16: fdevices.v1.RunATResponse
+	(*ResetDongleRequest)(nil),    // 17: fdevices.v1.ResetDongleRequest
+	(*ResetDongleResponse)(nil),   // 18: fdevices.v1.ResetDongleResponse
+	nil,                           // 19: fdevices.v1.Dongle.PropertiesEntry
+	nil,                           // 20: fdevices.v1.Dongle.LabelsEntry
+	nil,                           // 21: fdevices.v1.Port.PropertiesEntry
+	nil,                           // 22: fdevices.v1.Device.LabelsEntry
+	nil,                           // 23: fdevices.v1.Filter.LabelsEntry
+	(*timestamppb.Timestamp)(nil), // 24: google.protobuf.Timestamp
+}
+var file_fdevices_proto_depIdxs = []int32{
+	19, // 0: fdevices.v1.Dongle.properties:type_name -> fdevices.v1.Dongle.PropertiesEntry
+	20, // 1: fdevices.v1.Dongle.labels:type_name -> fdevices.v1.Dongle.LabelsEntry
+	21, // 2: fdevices.v1.Port.properties:type_name -> fdevices.v1.Port.PropertiesEntry
+	24, // 3: fdevices.v1.Port.created_on:type_name -> google.protobuf.Timestamp
+	22, // 4: fdevices.v1.Device.labels:type_name -> fdevices.v1.Device.LabelsEntry
+	24, // 5: fdevices.v1.Event.time:type_name -> google.protobuf.Timestamp
+	2,  // 6: fdevices.v1.Event.device:type_name -> fdevices.v1.Device
+	3,  // 7: fdevices.v1.Event.changes:type_name -> fdevices.v1.Change
+	0,  // 8: fdevices.v1.Event.dongle:type_name -> fdevices.v1.Dongle
+	1,  // 9: fdevices.v1.Event.port:type_name -> fdevices.v1.Port
+	4,  // 10: fdevices.v1.Event.missed:type_name -> fdevices.v1.Missed
+	23, // 11: fdevices.v1.Filter.labels:type_name -> fdevices.v1.Filter.LabelsEntry
+	6,  // 12: fdevices.v1.ListDonglesRequest.filter:type_name -> fdevices.v1.Filter
+	0,  // 13: fdevices.v1.ListDonglesResponse.dongles:type_name -> fdevices.v1.Dongle
+	6,  // 14: fdevices.v1.WatchEventsRequest.filter:type_name -> fdevices.v1.Filter
+	0,  // 15: fdevices.v1.Snapshot.dongles:type_name -> fdevices.v1.Dongle
+	11, // 16: fdevices.v1.WatchEventsResponse.snapshot:type_name -> fdevices.v1.Snapshot
+	5,  // 17: fdevices.v1.WatchEventsResponse.event:type_name -> fdevices.v1.Event
+	7,  // 18: fdevices.v1.Dongles.ListDongles:input_type -> fdevices.v1.ListDonglesRequest
+	9,  // 19: fdevices.v1.Dongles.GetDongle:input_type -> fdevices.v1.GetDongleRequest
+	10, // 20: fdevices.v1.Dongles.WatchEvents:input_type -> fdevices.v1.WatchEventsRequest
+	13, // 21: fdevices.v1.Dongles.SendSMS:input_type -> fdevices.v1.SendSMSRequest
+	15, // 22: fdevices.v1.Dongles.RunAT:input_type -> fdevices.v1.RunATRequest
+	17, // 23: fdevices.v1.Dongles.ResetDongle:input_type -> fdevices.v1.ResetDongleRequest
+	8,  // 24: fdevices.v1.Dongles.ListDongles:output_type -> fdevices.v1.ListDonglesResponse
+	0,  // 25: fdevices.v1.Dongles.GetDongle:output_type -> fdevices.v1.Dongle
+	12, // 26: fdevices.v1.Dongles.WatchEvents:output_type -> fdevices.v1.WatchEventsResponse
+	14, // 27: fdevices.v1.Dongles.SendSMS:output_type -> fdevices.v1.SendSMSResponse
+	16, // 28: fdevices.v1.Dongles.RunAT:output_type -> fdevices.v1.RunATResponse
+	18, // 29: fdevices.v1.Dongles.ResetDongle:output_type -> fdevices.v1.ResetDongleResponse
+	24, // [24:30] is the sub-list for method output_type
+	18, // [18:24] is the sub-list for method input_type
+	18, // [18:18] is the sub-list for extension type_name
+	18, // [18:18] is the sub-list for extension extendee
+	0,  // [0:18] is the sub-list for field type_name
+}
+
+func init() { file_fdevices_proto_init() }
+func file_fdevices_proto_init() {
+	if File_fdevices_proto != nil {
+		return
+	}
+	file_fdevices_proto_msgTypes[0].OneofWrappers = []any{}
+	file_fdevices_proto_msgTypes[5].OneofWrappers = []any{
+		(*Event_Dongle)(nil),
+		(*Event_Port)(nil),
+		(*Event_Missed)(nil),
+	}
+	file_fdevices_proto_msgTypes[12].OneofWrappers = []any{
+		(*WatchEventsResponse_Snapshot)(nil),
+		(*WatchEventsResponse_Event)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_fdevices_proto_rawDesc), len(file_fdevices_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   24,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_fdevices_proto_goTypes,
+		DependencyIndexes: file_fdevices_proto_depIdxs,
+		MessageInfos:      file_fdevices_proto_msgTypes,
+	}.Build()
+	File_fdevices_proto = out.File
+	file_fdevices_proto_goTypes = nil
+	file_fdevices_proto_depIdxs = nil
+}
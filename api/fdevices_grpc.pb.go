@@ -0,0 +1,353 @@
+// The gRPC API of fdevices. It offers what the REST API and the websocket
+// offer, for clients which prefer protobuf to JSON.
+//
+// The Go code is generated with
+//
+//	protoc --go_out=. --go_opt=paths=source_relative \
+//		--go-grpc_out=. --go-grpc_opt=paths=source_relative fdevices.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: fdevices.proto
+
+package api
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Dongles_ListDongles_FullMethodName = "/fdevices.v1.Dongles/ListDongles"
+	Dongles_GetDongle_FullMethodName   = "/fdevices.v1.Dongles/GetDongle"
+	Dongles_WatchEvents_FullMethodName = "/fdevices.v1.Dongles/WatchEvents"
+	Dongles_SendSMS_FullMethodName     = "/fdevices.v1.Dongles/SendSMS"
+	Dongles_RunAT_FullMethodName       = "/fdevices.v1.Dongles/RunAT"
+	Dongles_ResetDongle_FullMethodName = "/fdevices.v1.Dongles/ResetDongle"
+)
+
+// DonglesClient is the client API for Dongles service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Dongles lists and follows the dongles, and sends them commands.
+//
+// Credentials are passed like in HTTP, in the authorization metadata as
+// "Bearer <token>" or "Basic <user:password in base64>". ListDongles,
+// GetDongle and WatchEvents need the read scope, SendSMS the sms scope and
+// RunAT and ResetDongle the control scope.
+type DonglesClient interface {
+	// ListDongles lists the dongles ordered by IMEI.
+	ListDongles(ctx context.Context, in *ListDonglesRequest, opts ...grpc.CallOption) (*ListDonglesResponse, error)
+	// GetDongle returns a single dongle. It fails with NOT_FOUND when no
+	// dongle matches, and FAILED_PRECONDITION when several do.
+	GetDongle(ctx context.Context, in *GetDongleRequest, opts ...grpc.CallOption) (*Dongle, error)
+	// WatchEvents streams the events. Unless it resumes from a sequence
+	// number, the stream starts with a snapshot of the dongles.
+	WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchEventsResponse], error)
+	// SendSMS sends an SMS from a dongle.
+	SendSMS(ctx context.Context, in *SendSMSRequest, opts ...grpc.CallOption) (*SendSMSResponse, error)
+	// RunAT runs a single AT command on a dongle.
+	RunAT(ctx context.Context, in *RunATRequest, opts ...grpc.CallOption) (*RunATResponse, error)
+	// ResetDongle restarts a dongle.
+	ResetDongle(ctx context.Context, in *ResetDongleRequest, opts ...grpc.CallOption) (*ResetDongleResponse, error)
+}
+
+type donglesClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDonglesClient(cc grpc.ClientConnInterface) DonglesClient {
+	return &donglesClient{cc}
+}
+
+func (c *donglesClient) ListDongles(ctx context.Context, in *ListDonglesRequest, opts ...grpc.CallOption) (*ListDonglesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListDonglesResponse)
+	err := c.cc.Invoke(ctx, Dongles_ListDongles_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *donglesClient) GetDongle(ctx context.Context, in *GetDongleRequest, opts ...grpc.CallOption) (*Dongle, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Dongle)
+	err := c.cc.Invoke(ctx, Dongles_GetDongle_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *donglesClient) WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchEventsResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Dongles_ServiceDesc.Streams[0], Dongles_WatchEvents_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchEventsRequest, WatchEventsResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Dongles_WatchEventsClient = grpc.ServerStreamingClient[WatchEventsResponse]
+
+func (c *donglesClient) SendSMS(ctx context.Context, in *SendSMSRequest, opts ...grpc.CallOption) (*SendSMSResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SendSMSResponse)
+	err := c.cc.Invoke(ctx, Dongles_SendSMS_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *donglesClient) RunAT(ctx context.Context, in *RunATRequest, opts ...grpc.CallOption) (*RunATResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RunATResponse)
+	err := c.cc.Invoke(ctx, Dongles_RunAT_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *donglesClient) ResetDongle(ctx context.Context, in *ResetDongleRequest, opts ...grpc.CallOption) (*ResetDongleResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ResetDongleResponse)
+	err := c.cc.Invoke(ctx, Dongles_ResetDongle_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DonglesServer is the server API for Dongles service.
+// All implementations must embed UnimplementedDonglesServer
+// for forward compatibility.
+//
+// Dongles lists and follows the dongles, and sends them commands.
+//
+// Credentials are passed like in HTTP, in the authorization metadata as
+// "Bearer <token>" or "Basic <user:password in base64>". ListDongles,
+// GetDongle and WatchEvents need the read scope, SendSMS the sms scope and
+// RunAT and ResetDongle the control scope.
+type DonglesServer interface {
+	// ListDongles lists the dongles ordered by IMEI.
+	ListDongles(context.Context, *ListDonglesRequest) (*ListDonglesResponse, error)
+	// GetDongle returns a single dongle. It fails with NOT_FOUND when no
+	// dongle matches, and FAILED_PRECONDITION when several do.
+	GetDongle(context.Context, *GetDongleRequest) (*Dongle, error)
+	// WatchEvents streams the events. Unless it resumes from a sequence
+	// number, the stream starts with a snapshot of the dongles.
+	WatchEvents(*WatchEventsRequest, grpc.ServerStreamingServer[WatchEventsResponse]) error
+	// SendSMS sends an SMS from a dongle.
+	SendSMS(context.Context, *SendSMSRequest) (*SendSMSResponse, error)
+	// RunAT runs a single AT command on a dongle.
+	RunAT(context.Context, *RunATRequest) (*RunATResponse, error)
+	// ResetDongle restarts a dongle.
+	ResetDongle(context.Context, *ResetDongleRequest) (*ResetDongleResponse, error)
+	mustEmbedUnimplementedDonglesServer()
+}
+
+// UnimplementedDonglesServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedDonglesServer struct{}
+
+func (UnimplementedDonglesServer) ListDongles(context.Context, *ListDonglesRequest) (*ListDonglesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListDongles not implemented")
+}
+func (UnimplementedDonglesServer) GetDongle(context.Context, *GetDongleRequest) (*Dongle, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDongle not implemented")
+}
+func (UnimplementedDonglesServer) WatchEvents(*WatchEventsRequest, grpc.ServerStreamingServer[WatchEventsResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchEvents not implemented")
+}
+func (UnimplementedDonglesServer) SendSMS(context.Context, *SendSMSRequest) (*SendSMSResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendSMS not implemented")
+}
+func (UnimplementedDonglesServer) RunAT(context.Context, *RunATRequest) (*RunATResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RunAT not implemented")
+}
+func (UnimplementedDonglesServer) ResetDongle(context.Context, *ResetDongleRequest) (*ResetDongleResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResetDongle not implemented")
+}
+func (UnimplementedDonglesServer) mustEmbedUnimplementedDonglesServer() {}
+func (UnimplementedDonglesServer) testEmbeddedByValue()                 {}
+
+// UnsafeDonglesServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DonglesServer will
+// result in compilation errors.
+type UnsafeDonglesServer interface {
+	mustEmbedUnimplementedDonglesServer()
+}
+
+func RegisterDonglesServer(s grpc.ServiceRegistrar, srv DonglesServer) {
+	// If the following call pancis, it indicates UnimplementedDonglesServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Dongles_ServiceDesc, srv)
+}
+
+func _Dongles_ListDongles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListDonglesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DonglesServer).ListDongles(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Dongles_ListDongles_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DonglesServer).ListDongles(ctx, req.(*ListDonglesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Dongles_GetDongle_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDongleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DonglesServer).GetDongle(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Dongles_GetDongle_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DonglesServer).GetDongle(ctx, req.(*GetDongleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Dongles_WatchEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(DonglesServer).WatchEvents(m, &grpc.GenericServerStream[WatchEventsRequest, WatchEventsResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Dongles_WatchEventsServer = grpc.ServerStreamingServer[WatchEventsResponse]
+
+func _Dongles_SendSMS_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendSMSRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DonglesServer).SendSMS(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Dongles_SendSMS_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DonglesServer).SendSMS(ctx, req.(*SendSMSRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Dongles_RunAT_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RunATRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DonglesServer).RunAT(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Dongles_RunAT_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DonglesServer).RunAT(ctx, req.(*RunATRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Dongles_ResetDongle_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResetDongleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DonglesServer).ResetDongle(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Dongles_ResetDongle_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DonglesServer).ResetDongle(ctx, req.(*ResetDongleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Dongles_ServiceDesc is the grpc.ServiceDesc for Dongles service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Dongles_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "fdevices.v1.Dongles",
+	HandlerType: (*DonglesServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListDongles",
+			Handler:    _Dongles_ListDongles_Handler,
+		},
+		{
+			MethodName: "GetDongle",
+			Handler:    _Dongles_GetDongle_Handler,
+		},
+		{
+			MethodName: "SendSMS",
+			Handler:    _Dongles_SendSMS_Handler,
+		},
+		{
+			MethodName: "RunAT",
+			Handler:    _Dongles_RunAT_Handler,
+		},
+		{
+			MethodName: "ResetDongle",
+			Handler:    _Dongles_ResetDongle_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchEvents",
+			Handler:       _Dongles_WatchEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "fdevices.proto",
+}
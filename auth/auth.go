@@ -0,0 +1,149 @@
+// Package auth authenticates the clients of the fdevices API.
+//
+// Clients present either an API token, as "Authorization: Bearer <token>" or
+// as the access_token query parameter for clients which can not set headers
+// like browser websockets, or a user name and password with HTTP basic auth.
+// Both carry scopes which decide what the client is allowed to do.
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Scopes of tokens and users.
+const (
+	// Read allows listing dongles and following their events.
+	Read = "read"
+
+	// SMS allows sending SMS.
+	SMS = "sms"
+
+	// Control allows running AT commands and resetting dongles.
+	Control = "control"
+
+	// Admin allows everything, including looking at the subscribers and
+	// webhook deliveries.
+	Admin = "admin"
+)
+
+// Scopes are all the scopes.
+var Scopes = []string{Read, SMS, Control, Admin}
+
+// ValidScope returns true when s is one of Scopes.
+func ValidScope(s string) bool {
+	for _, v := range Scopes {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Identity is an authenticated client.
+type Identity struct {
+	// Name is the name of the token or user.
+	Name   string
+	Scopes []string
+}
+
+// Allowed returns true when the identity has scope, or the admin scope. Every
+// identity is allowed the empty scope.
+func (i *Identity) Allowed(scope string) bool {
+	if i == nil {
+		return false
+	}
+	if scope == "" {
+		return true
+	}
+	for _, v := range i.Scopes {
+		if v == scope || v == Admin {
+			return true
+		}
+	}
+	return false
+}
+
+// User is a client authenticating with HTTP basic auth.
+type User struct {
+	// PasswordBcrypt is the bcrypt hash of the password.
+	PasswordBcrypt string
+	Scopes         []string
+}
+
+// HashPassword returns the bcrypt hash of password.
+func HashPassword(password string) (string, error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// ValidHash returns an error when hash is not a bcrypt hash.
+func ValidHash(hash string) error {
+	_, err := bcrypt.Cost([]byte(hash))
+	return err
+}
+
+// unknownUser is compared with the password of users which do not exist, so
+// they take as long to refuse as a wrong password.
+var unknownUser, _ = HashPassword("")
+
+// Authenticator checks the credentials of requests.
+type Authenticator struct {
+	// Tokens are the API tokens, no token is accepted when it is nil.
+	Tokens *Store
+
+	// Users are the basic auth users by name.
+	Users map[string]User
+}
+
+type ctxKey struct{}
+
+// NewContext returns a copy of ctx carrying the identity i.
+func NewContext(ctx context.Context, i *Identity) context.Context {
+	return context.WithValue(ctx, ctxKey{}, i)
+}
+
+// FromContext returns the identity carried by ctx, or nil.
+func FromContext(ctx context.Context) *Identity {
+	i, _ := ctx.Value(ctxKey{}).(*Identity)
+	return i
+}
+
+// Authenticate returns the identity of the client making r. An error is
+// returned when the client gave no credentials or wrong ones.
+func (a *Authenticator) Authenticate(r *http.Request) (*Identity, error) {
+	if user, password, ok := r.BasicAuth(); ok {
+		u, ok := a.Users[user]
+		hash := u.PasswordBcrypt
+		if !ok {
+			hash = unknownUser
+		}
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if !ok || err != nil {
+			return nil, fmt.Errorf("auth: bad password for %s", user)
+		}
+		return &Identity{Name: user, Scopes: u.Scopes}, nil
+	}
+	token := r.URL.Query().Get("access_token")
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		token = strings.TrimSpace(h[len("Bearer "):])
+	}
+	if token == "" {
+		return nil, fmt.Errorf("auth: no credentials")
+	}
+	if a.Tokens == nil {
+		return nil, fmt.Errorf("auth: bad token")
+	}
+	t, err := a.Tokens.Lookup(token)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{Name: t.Name, Scopes: t.Scopes}, nil
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "tokens.json")
+	s := NewStore(path)
+
+	_, _, err = s.Create("bad", []string{"write"})
+	if err == nil {
+		t.Error("expected an error for an unknown scope")
+	}
+	tok, secret, err := s.Create("sms gateway", []string{Read, SMS})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) == 0 || strings.Contains(string(b), secret) {
+		t.Error("expected the secret not to be stored")
+	}
+	got, err := s.Lookup(secret)
+	if err != nil || got.ID != tok.ID {
+		t.Errorf("expected token %s got %v %v", tok.ID, got, err)
+	}
+	if _, err = s.Lookup("nope"); err != ErrBadToken {
+		t.Errorf("expected %v got %v", ErrBadToken, err)
+	}
+
+	// another process revokes the token
+	err = NewStore(path).Revoke(tok.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Lookup(secret); err != ErrBadToken {
+		t.Errorf("expected a revoked token got %v", err)
+	}
+	all, err := s.List()
+	if err != nil || len(all) != 0 {
+		t.Errorf("expected no tokens got %v %v", all, err)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	hash, err := HashPassword("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ValidHash(hash); err != nil {
+		t.Fatal(err)
+	}
+	a := &Authenticator{
+		Tokens: NewStore(filepath.Join(dir, "tokens.json")),
+		Users: map[string]User{
+			"ops": {PasswordBcrypt: hash, Scopes: []string{Control}},
+		},
+	}
+	_, secret, err := a.Tokens.Create("reader", []string{Read})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sample := []struct {
+		req   func(r *http.Request)
+		name  string
+		scope string
+	}{
+		{func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+secret) }, "reader", Read},
+		{func(r *http.Request) { r.URL.RawQuery = "access_token=" + secret }, "reader", Read},
+		{func(r *http.Request) { r.SetBasicAuth("ops", "s3cret") }, "ops", Control},
+		{func(r *http.Request) { r.SetBasicAuth("ops", "wrong") }, "", ""},
+		{func(r *http.Request) { r.SetBasicAuth("nobody", "") }, "", ""},
+		{func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong") }, "", ""},
+		{func(r *http.Request) {}, "", ""},
+	}
+	for i, v := range sample {
+		r, _ := http.NewRequest("GET", "http://localhost/", nil)
+		v.req(r)
+		id, err := a.Authenticate(r)
+		if v.name == "" {
+			if err == nil {
+				t.Errorf("%d: expected an error got %v", i, id)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		if id.Name != v.name || !id.Allowed(v.scope) || id.Allowed(Admin) {
+			t.Errorf("%d: unexpected identity %v", i, id)
+		}
+	}
+	reader := &Identity{Name: "reader", Scopes: []string{Read}}
+	if !reader.Allowed(Read) || !reader.Allowed("") || reader.Allowed(SMS) {
+		t.Error("expected a reader to only read")
+	}
+}
@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrBadToken is returned for tokens which are unknown or revoked.
+var ErrBadToken = errors.New("auth: bad token")
+
+// Token is an API token as it is stored. Only the SHA-256 of the secret is
+// kept, the secret itself is shown once when the token is created.
+type Token struct {
+	// ID identifies the token when listing or revoking it.
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash"`
+	Scopes    []string  `json:"scopes"`
+	CreatedOn time.Time `json:"created_on"`
+}
+
+// Store keeps API tokens in a JSON file. The file is read again when it
+// changes, so tokens created or revoked from the command line are picked up
+// by a running server.
+type Store struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	tokens  []*Token
+}
+
+// NewStore returns the token store kept in the file at path.
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// load reads the file when it changed since the last time, it must be
+// called with the lock held. A missing file holds no tokens.
+func (s *Store) load() error {
+	st, err := os.Stat(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.tokens, s.modTime = nil, time.Time{}
+			return nil
+		}
+		return err
+	}
+	if st.ModTime().Equal(s.modTime) && st.Size() == s.size && s.tokens != nil {
+		return nil
+	}
+	b, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var tokens []*Token
+	err = json.Unmarshal(b, &tokens)
+	if err != nil {
+		return fmt.Errorf("auth: %s: %v", s.path, err)
+	}
+	if tokens == nil {
+		tokens = []*Token{}
+	}
+	s.tokens, s.modTime, s.size = tokens, st.ModTime(), st.Size()
+	return nil
+}
+
+// save writes the tokens, it must be called with the lock held. The file is
+// replaced atomically and only readable by its owner.
+func (s *Store) save() error {
+	b, err := json.MarshalIndent(s.tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(s.path)
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(s.path))
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	err = os.Rename(tmp.Name(), s.path)
+	if err != nil {
+		return err
+	}
+	// the next lookup reads the file back
+	s.modTime = time.Time{}
+	return nil
+}
+
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create adds a token with name and scopes, and returns it along with its
+// secret.
+func (s *Store) Create(name string, scopes []string) (*Token, string, error) {
+	if len(scopes) == 0 {
+		return nil, "", errors.New("auth: a token needs at least one scope")
+	}
+	for _, v := range scopes {
+		if !ValidScope(v) {
+			return nil, "", fmt.Errorf("auth: unknown scope %q", v)
+		}
+	}
+	b := make([]byte, 24)
+	_, err := rand.Read(b)
+	if err != nil {
+		return nil, "", err
+	}
+	secret := hex.EncodeToString(b)
+	hash := hashToken(secret)
+	t := &Token{
+		ID:        hash[:8],
+		Name:      name,
+		Hash:      hash,
+		Scopes:    scopes,
+		CreatedOn: time.Now().UTC(),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err = s.load()
+	if err != nil {
+		return nil, "", err
+	}
+	s.tokens = append(s.tokens, t)
+	err = s.save()
+	if err != nil {
+		return nil, "", err
+	}
+	return t, secret, nil
+}
+
+// List returns the tokens ordered by creation.
+func (s *Store) List() ([]*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	o := make([]*Token, len(s.tokens))
+	copy(o, s.tokens)
+	sort.SliceStable(o, func(i, j int) bool {
+		return o[i].CreatedOn.Before(o[j].CreatedOn)
+	})
+	return o, nil
+}
+
+// Revoke removes the token with the given id.
+func (s *Store) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.load()
+	if err != nil {
+		return err
+	}
+	for i, t := range s.tokens {
+		if t.ID == id {
+			s.tokens = append(s.tokens[:i], s.tokens[i+1:]...)
+			return s.save()
+		}
+	}
+	return fmt.Errorf("auth: no token %s", id)
+}
+
+// Lookup returns the token with the given secret.
+func (s *Store) Lookup(secret string) (*Token, error) {
+	hash := hashToken(secret)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hash)) == 1 {
+			return t, nil
+		}
+	}
+	return nil, ErrBadToken
+}
@@ -0,0 +1,343 @@
+// Package client talks to the HTTP API of fdevices.
+//
+//	c := client.New("http://localhost:8090")
+//	dongles, err := c.Dongles(ctx, nil)
+//
+// Watch follows the dongles and their events, reconnecting and resuming
+// after the last event it received when the connection is lost.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/FarmRadioHangar/fdevices/control"
+	"github.com/FarmRadioHangar/fdevices/schema"
+)
+
+var _ control.Controller = (*Client)(nil)
+
+// Client is a client of an fdevices server.
+type Client struct {
+	// URL is the address of the server, like http://localhost:8090.
+	URL string
+
+	// HTTP is the client used for requests. It must not have a timeout for
+	// Watch to work, the default client is used when it is nil.
+	HTTP *http.Client
+
+	// Token is the API token sent with every request, when the server has
+	// authentication enabled.
+	Token string
+}
+
+// New returns a client of the server at u.
+func New(u string) *Client {
+	return &Client{URL: strings.TrimSuffix(u, "/")}
+}
+
+// Filter selects dongles and events, like the query parameters of the API.
+// Within a field the values are alternatives, every field which is set has
+// to match.
+type Filter struct {
+	Types  []schema.Type
+	IMEI   []string
+	IMSI   []string
+	ICCID  []string
+	Labels map[string]string
+}
+
+func (f *Filter) values() url.Values {
+	q := make(url.Values)
+	if f == nil {
+		return q
+	}
+	for _, t := range f.Types {
+		q.Add("type", string(t))
+	}
+	for _, v := range f.IMEI {
+		q.Add("imei", v)
+	}
+	for _, v := range f.IMSI {
+		q.Add("imsi", v)
+	}
+	for _, v := range f.ICCID {
+		q.Add("iccid", v)
+	}
+	for k, v := range f.Labels {
+		q.Add("label", k+"="+v)
+	}
+	return q
+}
+
+func (c *Client) authorize(req *http.Request) {
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+}
+
+func (c *Client) http() *http.Client {
+	if c.HTTP != nil {
+		return c.HTTP
+	}
+	return http.DefaultClient
+}
+
+// do sends a request and decodes the JSON response into v. Responses with an
+// error status are returned as *schema.Error.
+func (c *Client) do(ctx context.Context, method, path string, q url.Values, body, v interface{}) error {
+	u := c.URL + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, u, r)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	c.authorize(req)
+	res, err := c.http().Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return responseError(res)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+func responseError(res *http.Response) error {
+	b, _ := ioutil.ReadAll(io.LimitReader(res.Body, 64*1024))
+	e := &schema.Error{}
+	if json.Unmarshal(b, e) != nil || e.Code == "" {
+		e = &schema.Error{Message: strings.TrimSpace(string(b))}
+	}
+	e.Status = res.StatusCode
+	return e
+}
+
+// Dongles lists the dongles passing f, all of them when f is nil. The types
+// of the filter are not used.
+func (c *Client) Dongles(ctx context.Context, f *Filter) ([]*schema.Dongle, error) {
+	var o []*schema.Dongle
+	q := f.values()
+	q.Del("type")
+	err := c.do(ctx, http.MethodGet, "/api/v1/dongles", q, nil, &o)
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Dongle returns the dongle with id as IMEI, IMSI or ICCID, or matching id as
+// a label selector like port=1-1.3.
+func (c *Client) Dongle(ctx context.Context, id string) (*schema.Dongle, error) {
+	d := &schema.Dongle{}
+	err := c.do(ctx, http.MethodGet, "/api/v1/dongles/"+url.PathEscape(id), nil, nil, d)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Ports lists the serial devices which are not probed.
+func (c *Client) Ports(ctx context.Context) ([]*schema.Port, error) {
+	var o []*schema.Port
+	err := c.do(ctx, http.MethodGet, "/api/v1/ports", nil, nil, &o)
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Command runs the command name on the dongle id. The server must have
+// commands enabled.
+func (c *Client) Command(ctx context.Context, id, name string, cmd *schema.Command) (*schema.Result, error) {
+	res := &schema.Result{}
+	path := fmt.Sprintf("/api/v1/dongles/%s/commands/%s", url.PathEscape(id), url.PathEscape(name))
+	err := c.do(ctx, http.MethodPost, path, nil, cmd, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// SendSMS sends an SMS with text to number from the dongle imei.
+func (c *Client) SendSMS(ctx context.Context, imei, number, text string) error {
+	_, err := c.Command(ctx, imei, control.SMS, &schema.Command{Number: number, Text: text})
+	return err
+}
+
+// RunAT runs the AT command cmd on the dongle imei.
+func (c *Client) RunAT(ctx context.Context, imei, cmd string) (string, error) {
+	res, err := c.Command(ctx, imei, control.AT, &schema.Command{Command: cmd})
+	if err != nil {
+		return "", err
+	}
+	return res.Output, nil
+}
+
+// Reset restarts the dongle imei.
+func (c *Client) Reset(ctx context.Context, imei string) error {
+	_, err := c.Command(ctx, imei, control.Reset, &schema.Command{})
+	return err
+}
+
+// Watcher receives the dongles and events followed by Watch.
+type Watcher struct {
+	Filter *Filter
+
+	// Snapshot is called with the dongles when Watch starts, and again when
+	// events were missed while reconnecting.
+	Snapshot func(dongles []*schema.Dongle)
+
+	// Event is called with every event, including gap events which are
+	// followed by a snapshot.
+	Event func(e *schema.Event)
+
+	// Retry is the wait before the first reconnection, it doubles for every
+	// failed attempt up to a minute. It defaults to a second.
+	Retry time.Duration
+}
+
+// Watch follows the dongles and their events until ctx is done, and returns
+// the error of ctx. A lost connection is reconnected, resuming after the last
+// event received. Watch gives up on errors which a retry does not fix, like
+// a bad filter.
+func (c *Client) Watch(ctx context.Context, w *Watcher) error {
+	retry := w.Retry
+	if retry <= 0 {
+		retry = time.Second
+	}
+	wait := retry
+	var last string
+	for {
+		connected, err := c.watch(ctx, w, &last)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if e, ok := err.(*schema.Error); ok && e.Status >= 400 && e.Status < 500 {
+			return err
+		}
+		if connected {
+			wait = retry
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+		if wait > time.Minute {
+			wait = time.Minute
+		}
+	}
+}
+
+// watch reads the event stream once, keeping the id of the last event in
+// last. It returns true when the server accepted the connection.
+func (c *Client) watch(ctx context.Context, w *Watcher, last *string) (bool, error) {
+	u := c.URL + "/api/events"
+	if q := w.Filter.values(); len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "text/event-stream")
+	c.authorize(req)
+	if *last != "" {
+		req.Header.Set("Last-Event-ID", *last)
+	}
+	res, err := c.http().Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return false, responseError(res)
+	}
+	r := bufio.NewReader(res.Body)
+	var id, event, data string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return true, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "":
+			err = w.dispatch(id, event, data, last)
+			if err != nil {
+				return true, err
+			}
+			id, event, data = "", "", ""
+		case strings.HasPrefix(line, ":"):
+			// comments keep the connection alive
+		case strings.HasPrefix(line, "id:"):
+			id = strings.TrimSpace(line[len("id:"):])
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(line[len("event:"):])
+		case strings.HasPrefix(line, "data:"):
+			if data != "" {
+				data += "\n"
+			}
+			data += strings.TrimPrefix(line[len("data:"):], " ")
+		}
+	}
+}
+
+func (w *Watcher) dispatch(id, event, data string, last *string) error {
+	if data == "" {
+		return nil
+	}
+	if event == "snapshot" {
+		var o []*schema.Dongle
+		err := json.Unmarshal([]byte(data), &o)
+		if err != nil {
+			return err
+		}
+		// the snapshot is taken at the event in its id
+		if id != "" {
+			*last = id
+		}
+		if w.Snapshot != nil {
+			w.Snapshot(o)
+		}
+		return nil
+	}
+	e, err := schema.Decode([]byte(data))
+	if err != nil {
+		return err
+	}
+	if e.Type != schema.Gap {
+		*last = schema.ID(e.Boot, e.Seq)
+	}
+	if w.Event != nil {
+		w.Event(e)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/FarmRadioHangar/fdevices/db"
+	"github.com/FarmRadioHangar/fdevices/db/dbtest"
+	"github.com/FarmRadioHangar/fdevices/events"
+	"github.com/FarmRadioHangar/fdevices/schema"
+	"github.com/FarmRadioHangar/fdevices/web"
+)
+
+type fakeController struct {
+	sms chan string
+}
+
+func (c *fakeController) SendSMS(ctx context.Context, imei, number, text string) error {
+	c.sms <- imei + " " + number + " " + text
+	return nil
+}
+
+func (c *fakeController) RunAT(ctx context.Context, imei, cmd string) (string, error) {
+	return "", errors.New("ERROR")
+}
+
+func (c *fakeController) Reset(ctx context.Context, imei string) error {
+	return nil
+}
+
+// testDongles are the dongles of the test database.
+var testDongles = []*db.Dongle{{IMEI: "123", IMSI: "456", Path: "/dev/ttyUSB0"}}
+
+func TestClient(t *testing.T) {
+	ql := dbtest.DB(t, testDongles, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := events.NewStream(10)
+	s.Start(ctx)
+	ctl := &fakeController{sms: make(chan string, 1)}
+	ts := httptest.NewServer(web.New(ql, s, web.Options{Commands: ctl}))
+	defer ts.Close()
+	c := New(ts.URL)
+
+	dongles, err := c.Dongles(ctx, &Filter{IMSI: []string{"456"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dongles) != 1 || dongles[0].IMEI != "123" {
+		t.Errorf("expected dongle 123 got %v", dongles)
+	}
+	d, err := c.Dongle(ctx, "456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.IMEI != "123" {
+		t.Errorf("expected dongle 123 got %v", d)
+	}
+	_, err = c.Dongle(ctx, "999")
+	if e, ok := err.(*schema.Error); !ok || e.Status != http.StatusNotFound || e.Code != schema.CodeNotFound {
+		t.Errorf("expected not found got %#v", err)
+	}
+	ports, err := c.Ports(ctx)
+	if err != nil || len(ports) != 0 {
+		t.Errorf("expected no ports got %v %v", ports, err)
+	}
+
+	err = c.SendSMS(ctx, "123", "+255", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := <-ctl.sms; v != "123 +255 hello" {
+		t.Errorf("unexpected sms %s", v)
+	}
+	_, err = c.RunAT(ctx, "123", "AT+CSQ")
+	if e, ok := err.(*schema.Error); !ok || e.Code != schema.CodeCommandFailed {
+		t.Errorf("expected a failed command got %#v", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := events.NewStream(10)
+	s.Start(ctx)
+	ts := httptest.NewServer(web.New(dbtest.DB(t, testDongles, nil), s, web.Options{}))
+	defer ts.Close()
+	wctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	snapshots := make(chan []*schema.Dongle, 10)
+	evts := make(chan *schema.Event, 10)
+	go New(ts.URL).Watch(wctx, &Watcher{
+		Filter:   &Filter{Types: []schema.Type{schema.Add}},
+		Snapshot: func(d []*schema.Dongle) { snapshots <- d },
+		Event:    func(e *schema.Event) { evts <- e },
+		Retry:    10 * time.Millisecond,
+	})
+	receive := func() *schema.Event {
+		select {
+		case e := <-evts:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for event")
+		}
+		return nil
+	}
+
+	<-snapshots
+	for len(s.Stats()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	s.Send(events.New(schema.Add, schema.Device{IMEI: "1"}, nil))
+	s.Send(events.New(schema.Remove, schema.Device{IMEI: "1"}, nil))
+	if e := receive(); e.Seq != 1 {
+		t.Errorf("expected 1 got %d", e.Seq)
+	}
+
+	// events sent while the client is reconnecting are resumed
+	ts.CloseClientConnections()
+	for len(s.Stats()) != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	s.Send(events.New(schema.Add, schema.Device{IMEI: "2"}, nil))
+	if e := receive(); e.Seq != 3 || e.Device.IMEI != "2" {
+		t.Errorf("expected 3 got %d", e.Seq)
+	}
+	select {
+	case <-snapshots:
+		t.Error("expected no snapshot on resume")
+	default:
+	}
+}
@@ -0,0 +1,334 @@
+// Package config loads the fdevices configuration file.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/FarmRadioHangar/fdevices/auth"
+)
+
+// DefaultPath is where the configuration file is looked up when none is
+// given on the command line.
+const DefaultPath = "/etc/fdevices/config.json"
+
+// DefaultStateDir is where fdevices keeps the files it needs across restarts.
+const DefaultStateDir = "/var/lib/fdevices"
+
+// Config is the fdevices configuration. It is stored as JSON, for instance
+//
+//	{
+//	  "ports": {
+//	    "1-1.3": "news",
+//	    "1-1.4": "callin"
+//	  },
+//	  "symlinks": {
+//	    "root": "/dev",
+//	    "links": [
+//	      "{{.IMEI}}.imei",
+//	      "fdevices/by-iccid/{{.ICCID}}",
+//	      "fdevices/by-name/{{.Name}}/control"
+//	    ]
+//	  }
+//	}
+type Config struct {
+	// StateDir is the directory fdevices keeps its state in.
+	StateDir string `json:"state_dir"`
+
+	// Symlinks is the layout of the symlinks created for dongles.
+	Symlinks Symlinks `json:"symlinks"`
+
+	// Ports maps physical USB port locations to friendly names. The location
+	// is the USB device name found in the sysfs devpath, like 1-1.3, which is
+	// also used for the /dev/fdevices/by-port symlinks.
+	Ports map[string]string `json:"ports"`
+
+	// Labels are set on dongles, with the IMEI as key. Clients use them to
+	// select the events they receive. The port and name labels are set from
+	// the USB port a dongle is plugged into.
+	Labels map[string]map[string]string `json:"labels"`
+
+	// Devices decide what is done with a serial device when it shows up. The
+	// first rule that matches wins, devices matching no rule are probed.
+	Devices []DeviceRule `json:"devices"`
+
+	// Webhooks are HTTP endpoints events are posted to.
+	Webhooks []Webhook `json:"webhooks"`
+
+	// API configures the HTTP API.
+	API API `json:"api"`
+
+	// Journal configures the rotation of the event journal, which is kept in
+	// the journal directory of StateDir.
+	Journal Journal `json:"journal"`
+
+	// MQTT is the broker events are published to, nothing is published when
+	// it is nil.
+	MQTT *MQTT `json:"mqtt"`
+
+	// TLS serves the HTTP API over HTTPS.
+	TLS *TLS `json:"tls"`
+
+	// Auth configures the authentication of the clients of the HTTP API.
+	Auth Auth `json:"auth"`
+
+	// GRPC serves the gRPC API, it is not served when it is nil. It uses the
+	// TLS and Auth settings of the HTTP API.
+	GRPC *GRPC `json:"grpc"`
+}
+
+// Actions of a DeviceRule.
+const (
+	// Probe talks AT commands to the device to find out if it is a modem.
+	Probe = "probe"
+
+	// Ignore leaves the device alone.
+	Ignore = "ignore"
+
+	// Passive tracks the device without ever writing to it.
+	Passive = "passive"
+)
+
+// DeviceRule matches serial devices by their udev properties. The fields are
+// shell patterns as accepted by path.Match, an empty field matches anything.
+//
+//	{"vendor": "0403", "product": "6001", "action": "ignore", "reason": "relay board"}
+type DeviceRule struct {
+	// Vendor is matched against ID_VENDOR_ID
+	Vendor string `json:"vendor"`
+
+	// Product is matched against ID_MODEL_ID
+	Product string `json:"product"`
+
+	// Driver is matched against ID_USB_DRIVER
+	Driver string `json:"driver"`
+
+	// Serial is matched against ID_SERIAL
+	Serial string `json:"serial"`
+
+	// Port is matched against the physical USB port location, like 1-1.3
+	Port string `json:"port"`
+
+	// Action is one of probe, ignore or passive.
+	Action string `json:"action"`
+
+	// Reason is reported for devices which are not probed.
+	Reason string `json:"reason"`
+}
+
+// Webhook is an HTTP endpoint events are posted to. The remaining fields
+// select the events which are posted, like the query parameters of the
+// websocket. Within a field the values are alternatives, empty fields match
+// anything.
+//
+//	{"url": "https://example.com/hook", "secret": "s3cret", "types": ["add", "remove"]}
+type Webhook struct {
+	URL string `json:"url"`
+
+	// Secret is the key of the HMAC-SHA256 signature of every request.
+	Secret string `json:"secret"`
+
+	Types  []string          `json:"types"`
+	IMEI   []string          `json:"imei"`
+	IMSI   []string          `json:"imsi"`
+	ICCID  []string          `json:"iccid"`
+	Labels map[string]string `json:"labels"`
+}
+
+// API configures the HTTP API.
+type API struct {
+	// Commands enables POST /api/v1/dongles/{id}/commands/{name}, which can
+	// send SMS, run AT commands and reset dongles.
+	Commands bool `json:"commands"`
+
+	// Origins are the origins allowed to open websockets, like
+	// https://example.com, or * for any origin. Only pages served by
+	// fdevices itself are allowed when it is empty.
+	Origins []string `json:"origins"`
+
+	// Unix serves the API on a Unix socket as well, for local clients.
+	Unix *Unix `json:"unix"`
+
+	// DisableTCP stops serving the API on the TCP port, so it is only served
+	// on the Unix socket or the sockets passed by systemd.
+	DisableTCP bool `json:"disable_tcp"`
+}
+
+// Unix is a Unix socket the API is served on.
+//
+//	{"path": "/run/fdevices/api.sock", "mode": "0660", "group": "asterisk"}
+type Unix struct {
+	Path string `json:"path"`
+
+	// Mode is the octal mode of the socket, it defaults to 0660.
+	Mode string `json:"mode"`
+
+	// Group is the group the socket is given to, members of it can connect
+	// when the mode allows.
+	Group string `json:"group"`
+}
+
+// TLS is the certificate the HTTP API is served with, as PEM files.
+//
+//	{"cert": "/etc/fdevices/cert.pem", "key": "/etc/fdevices/key.pem"}
+type TLS struct {
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+}
+
+// GRPC configures the gRPC API defined in api/fdevices.proto.
+//
+//	{"addr": ":9090"}
+type GRPC struct {
+	// Addr is the address the gRPC API listens on.
+	Addr string `json:"addr"`
+}
+
+// Auth configures the authentication of the clients of the HTTP API. When it
+// is enabled every request needs an API token, managed with the tokens
+// command, or the password of a user. When it is disabled clients can only
+// read, and run commands when they are enabled in API.
+//
+//	{
+//	  "enabled": true,
+//	  "users": {
+//	    "admin": {"password_bcrypt": "$2a$10$...", "scopes": ["admin"]}
+//	  }
+//	}
+type Auth struct {
+	Enabled bool `json:"enabled"`
+
+	// Users authenticate with HTTP basic auth.
+	Users map[string]User `json:"users"`
+}
+
+// User is a client of the HTTP API using HTTP basic auth.
+type User struct {
+	// PasswordBcrypt is the bcrypt hash of the password, as printed by
+	// fdevices hash-password.
+	PasswordBcrypt string `json:"password_bcrypt"`
+
+	// Scopes are some of read, sms, control and admin.
+	Scopes []string `json:"scopes"`
+}
+
+// Journal configures the rotation of the event journal, zero values keep
+// the defaults of the journal package.
+//
+//	{"max_size": 1048576, "max_age": "24h", "max_segments": 30}
+type Journal struct {
+	// MaxSize is the size in bytes after which a new segment is started.
+	MaxSize int64 `json:"max_size"`
+
+	// MaxAge is the age after which a new segment is started, like 24h.
+	MaxAge string `json:"max_age"`
+
+	// MaxSegments is the number of segments which are kept.
+	MaxSegments int `json:"max_segments"`
+}
+
+// MQTT configures the connection to an MQTT broker.
+//
+//	{"broker": "tcp://localhost:1883", "commands": true}
+type MQTT struct {
+	// Broker is the address of the broker, like tcp://localhost:1883.
+	Broker   string `json:"broker"`
+	ClientID string `json:"client_id"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	// Prefix is prepended to every topic, it defaults to
+	// fdevices/<hostname>.
+	Prefix string `json:"prefix"`
+
+	// Commands enables the command topics, which can send SMS, run AT
+	// commands and reset dongles.
+	Commands bool `json:"commands"`
+}
+
+// Symlinks configures where symlinks for dongles are created. Links are
+// text/template names relative to Root, which can use the fields IMEI, IMSI,
+// ICCID, Port and Name. The default layout is used when Links is empty.
+type Symlinks struct {
+	Root  string   `json:"root"`
+	Links []string `json:"links"`
+}
+
+// Default returns the configuration used when there is no config file.
+func Default() *Config {
+	return &Config{
+		StateDir: DefaultStateDir,
+		Ports:    make(map[string]string),
+	}
+}
+
+// Load reads the configuration file at path. A missing file is not an error,
+// the default configuration is returned instead.
+func Load(path string) (*Config, error) {
+	c := Default()
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, err
+	}
+	err = json.Unmarshal(b, c)
+	if err != nil {
+		return nil, err
+	}
+	if c.Ports == nil {
+		c.Ports = make(map[string]string)
+	}
+	for i, r := range c.Devices {
+		switch r.Action {
+		case Probe, Ignore, Passive:
+		default:
+			return nil, fmt.Errorf("config: devices[%d]: unknown action %q", i, r.Action)
+		}
+	}
+	if c.Journal.MaxAge != "" {
+		if _, err := time.ParseDuration(c.Journal.MaxAge); err != nil {
+			return nil, fmt.Errorf("config: journal: max_age: %v", err)
+		}
+	}
+	if c.MQTT != nil && c.MQTT.Broker == "" {
+		return nil, fmt.Errorf("config: mqtt: missing broker")
+	}
+	for i, h := range c.Webhooks {
+		if h.URL == "" {
+			return nil, fmt.Errorf("config: webhooks[%d]: missing url", i)
+		}
+	}
+	if c.TLS != nil && (c.TLS.Cert == "" || c.TLS.Key == "") {
+		return nil, fmt.Errorf("config: tls: both cert and key are needed")
+	}
+	if u := c.API.Unix; u != nil {
+		if u.Path == "" {
+			return nil, fmt.Errorf("config: api: unix: missing path")
+		}
+		if u.Mode != "" {
+			if m, err := strconv.ParseUint(u.Mode, 8, 32); err != nil || m > 0777 {
+				return nil, fmt.Errorf("config: api: unix: bad mode %q", u.Mode)
+			}
+		}
+	}
+	if c.GRPC != nil && c.GRPC.Addr == "" {
+		return nil, fmt.Errorf("config: grpc: missing addr")
+	}
+	for name, u := range c.Auth.Users {
+		if err := auth.ValidHash(u.PasswordBcrypt); err != nil {
+			return nil, fmt.Errorf("config: auth: users: %s: password_bcrypt: %v", name, err)
+		}
+		for _, v := range u.Scopes {
+			if !auth.ValidScope(v) {
+				return nil, fmt.Errorf("config: auth: users: %s: unknown scope %q", name, v)
+			}
+		}
+	}
+	return c, nil
+}
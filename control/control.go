@@ -0,0 +1,75 @@
+// Package control defines the commands which can be sent to dongles.
+//
+// It only depends on the standard library and the schema package, so the
+// transports accepting commands, like MQTT, do not need to know how dongles
+// are talked to.
+package control
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/FarmRadioHangar/fdevices/schema"
+)
+
+// Names of the commands.
+const (
+	SMS   = "sms"
+	AT    = "at"
+	Reset = "reset"
+)
+
+// ErrUnknownDongle is returned for commands to a dongle which is not plugged
+// in.
+var ErrUnknownDongle = errors.New("control: unknown dongle")
+
+// Controller sends commands to dongles, which are identified by IMEI.
+type Controller interface {
+	// SendSMS sends an SMS with text to number.
+	SendSMS(ctx context.Context, imei, number, text string) error
+
+	// RunAT runs the AT command cmd and returns the response of the dongle.
+	RunAT(ctx context.Context, imei, cmd string) (string, error)
+
+	// Reset restarts the dongle.
+	Reset(ctx context.Context, imei string) error
+}
+
+// Run runs the command with the given name on the dongle with the given
+// imei, and returns the output of the dongle.
+func Run(ctx context.Context, c Controller, imei, name string, cmd *schema.Command) (string, error) {
+	switch name {
+	case SMS:
+		return "", c.SendSMS(ctx, imei, cmd.Number, cmd.Text)
+	case AT:
+		return c.RunAT(ctx, imei, cmd.Command)
+	case Reset:
+		return "", c.Reset(ctx, imei)
+	}
+	return "", UnknownCommandError(name)
+}
+
+// UnknownCommandError is returned by Run for commands which do not exist.
+type UnknownCommandError string
+
+func (e UnknownCommandError) Error() string {
+	return fmt.Sprintf("control: unknown command %s", string(e))
+}
+
+// ValidNumber returns true when number can be passed to the dongle as the
+// destination of an SMS, an optional + followed by digits.
+func ValidNumber(number string) bool {
+	if len(number) > 0 && number[0] == '+' {
+		number = number[1:]
+	}
+	if number == "" || len(number) > 20 {
+		return false
+	}
+	for _, c := range number {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 	// load ql drier
 	"github.com/FarmRadioHangar/fdevices/log"
+	"github.com/FarmRadioHangar/fdevices/schema"
 	_ "github.com/cznic/ql/driver"
 )
 
@@ -20,15 +21,29 @@ BEGIN TRANSACTION ;
 	CREATE TABLE IF NOT EXISTS dongles(
 		imei string,
 		imsi string,
+		iccid string,
 		path string,
 		symlink bool,
 		tty  int,
 		ati string,
 		properties blob,
 		created_on time,
-		updated_on time);
+		updated_on time,
+		operator string,
+		signal int,
+		sim string,
+		health string);
 
 		CREATE UNIQUE INDEX UQE_dongels on dongles(path);
+
+	CREATE TABLE IF NOT EXISTS ports(
+		path string,
+		status string,
+		reason string,
+		properties blob,
+		created_on time);
+
+		CREATE UNIQUE INDEX UQE_ports on ports(path);
 COMMIT;
 `
 
@@ -38,18 +53,92 @@ COMMIT;
 type Dongle struct {
 	IMEI        string            `json:"imei"`
 	IMSI        string            `json:"imsi"`
+	ICCID       string            `json:"iccid"`
 	Path        string            `json:"path"`
 	IsSymlinked bool              `json:"symlink"`
 	TTY         int               `json:"-"`
 	ATI         string            `json:"ati"`
 	Properties  map[string]string `json:"properties"`
 
+	// Operator and Signal are what the dongle last reported to AT+COPS? and
+	// AT+CSQ, Signal is nil when it is not known.
+	Operator string `json:"operator"`
+	Signal   *int   `json:"signal"`
+
+	// SIM is the state of the SIM reported to AT+CPIN?, and Health tells
+	// whether the dongle answered when it was last polled, see schema.Dongle.
+	SIM    string `json:"sim"`
+	Health string `json:"health"`
+
 	CreatedOn time.Time `json:"-"`
 	UpdatedOn time.Time `json:"-"`
 }
 
+// signal returns Signal as it is stored, NULL when it is not known.
+func (d *Dongle) signal() interface{} {
+	if d.Signal == nil {
+		return nil
+	}
+	return int64(*d.Signal)
+}
+
+// Device returns the identity of the dongle used in events.
+func (d *Dongle) Device() schema.Device {
+	return schema.Device{
+		IMEI:  d.IMEI,
+		IMSI:  d.IMSI,
+		ICCID: d.ICCID,
+		Path:  d.Path,
+	}
+}
+
+// Schema returns the dongle as it is sent in events.
+func (d *Dongle) Schema() *schema.Dongle {
+	return &schema.Dongle{
+		IMEI:        d.IMEI,
+		IMSI:        d.IMSI,
+		ICCID:       d.ICCID,
+		Path:        d.Path,
+		IsSymlinked: d.IsSymlinked,
+		ATI:         d.ATI,
+		Properties:  d.Properties,
+		Operator:    d.Operator,
+		Signal:      d.Signal,
+		SIM:         d.SIM,
+		Health:      d.Health,
+	}
+}
+
 type Dongles []*Dongle
 
+// Port statuses of serial devices which are not probed for a modem.
+const (
+	PortIgnored = "ignored"
+	PortPassive = "passive"
+)
+
+//Port is a serial device which is not a dongle. It is tracked so it is known
+//why fdevices left it alone.
+type Port struct {
+	Path       string            `json:"path"`
+	Status     string            `json:"status"`
+	Reason     string            `json:"reason"`
+	Properties map[string]string `json:"properties"`
+
+	CreatedOn time.Time `json:"created_on"`
+}
+
+// Schema returns the port as it is sent in events.
+func (p *Port) Schema() *schema.Port {
+	return &schema.Port{
+		Path:       p.Path,
+		Status:     p.Status,
+		Reason:     p.Reason,
+		Properties: p.Properties,
+		CreatedOn:  p.CreatedOn,
+	}
+}
+
 func (a Dongles) Len() int           { return len(a) }
 func (a Dongles) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a Dongles) Less(i, j int) bool { return a[i].TTY < a[j].TTY }
@@ -99,6 +188,7 @@ func GetAllDongles(db *sql.DB) ([]*Dongle, error) {
 		err := rows.Scan(
 			&d.IMEI,
 			&d.IMSI,
+			&d.ICCID,
 			&d.Path,
 			&d.IsSymlinked,
 			&d.TTY,
@@ -106,6 +196,10 @@ func GetAllDongles(db *sql.DB) ([]*Dongle, error) {
 			&prop,
 			&d.CreatedOn,
 			&d.UpdatedOn,
+			&d.Operator,
+			&d.Signal,
+			&d.SIM,
+			&d.Health,
 		)
 		if err != nil {
 			return nil, err
@@ -154,8 +248,8 @@ func GetDistinct(db *sql.DB) ([]*Dongle, error) {
 func CreateDongle(db *sql.DB, d *Dongle) error {
 	query := `
 	BEGIN TRANSACTION;
-	  INSERT INTO dongles  (imei,imsi,path,symlink,tty,ati,properties,created_on,updated_on)
-		VALUES ($1,$2,$3,$4,$5,$6,$7,now(),now());
+	  INSERT INTO dongles  (imei,imsi,iccid,path,symlink,tty,ati,properties,created_on,updated_on,operator,signal,sim,health)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,now(),now(),$9,$10,$11,$12);
 	COMMIT;
 	`
 	var prop []byte
@@ -171,8 +265,8 @@ func CreateDongle(db *sql.DB, d *Dongle) error {
 		return err
 	}
 
-	_, err = tx.Exec(query, d.IMEI, d.IMSI,
-		d.Path, d.IsSymlinked, d.TTY, d.ATI, prop)
+	_, err = tx.Exec(query, d.IMEI, d.IMSI, d.ICCID,
+		d.Path, d.IsSymlinked, d.TTY, d.ATI, prop, d.Operator, d.signal(), d.SIM, d.Health)
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -186,7 +280,8 @@ func UpdateDongle(db *sql.DB, d *Dongle) error {
 	  UPDATE dongles
 	  imei=$1,imsi=$2 ,path=$3,symlink=$4,
 	  tty=$5,properties=$6,
-	  created_on=$7 ,updated_on=now(),
+	  created_on=$7 ,iccid=$8,updated_on=now(),
+	  operator=$9,signal=$10,sim=$11,health=$12,
 	  WHERE path=$3&&imei=$1;
 	COMMIT;
 	`
@@ -203,7 +298,7 @@ func UpdateDongle(db *sql.DB, d *Dongle) error {
 		return err
 	}
 
-	_, err = tx.Exec(query, d.IMEI, d.IMSI, d.Path, d.IsSymlinked, d.TTY, prop, d.CreatedOn)
+	_, err = tx.Exec(query, d.IMEI, d.IMSI, d.Path, d.IsSymlinked, d.TTY, prop, d.CreatedOn, d.ICCID, d.Operator, d.signal(), d.SIM, d.Health)
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -240,6 +335,7 @@ func GetDongle(db *sql.DB, path string) (*Dongle, error) {
 	err := db.QueryRow(query, path).Scan(
 		&d.IMEI,
 		&d.IMSI,
+		&d.ICCID,
 		&d.Path,
 		&d.IsSymlinked,
 		&d.TTY,
@@ -247,6 +343,10 @@ func GetDongle(db *sql.DB, path string) (*Dongle, error) {
 		&prop,
 		&d.CreatedOn,
 		&d.UpdatedOn,
+		&d.Operator,
+		&d.Signal,
+		&d.SIM,
+		&d.Health,
 	)
 	if err != nil {
 		return nil, err
@@ -269,6 +369,7 @@ func GetDongleByIMEI(db *sql.DB, imei string) (*Dongle, error) {
 	err := db.QueryRow(query, imei).Scan(
 		&d.IMEI,
 		&d.IMSI,
+		&d.ICCID,
 		&d.Path,
 		&d.IsSymlinked,
 		&d.TTY,
@@ -276,6 +377,10 @@ func GetDongleByIMEI(db *sql.DB, imei string) (*Dongle, error) {
 		&prop,
 		&d.CreatedOn,
 		&d.UpdatedOn,
+		&d.Operator,
+		&d.Signal,
+		&d.SIM,
+		&d.Health,
 	)
 	if err != nil {
 		return nil, err
@@ -316,3 +421,114 @@ func DongleExists(db *sql.DB, modem *Dongle) bool {
 	}
 	return count > 0
 }
+
+// CreatePort records the port p, replacing any port with the same path.
+func CreatePort(db *sql.DB, p *Port) error {
+	query := `
+	BEGIN TRANSACTION;
+	  DELETE FROM ports WHERE path=$1;
+	  INSERT INTO ports (path,status,reason,properties,created_on)
+		VALUES ($1,$2,$3,$4,now());
+	COMMIT;
+	`
+	var prop []byte
+	var err error
+	if p.Properties != nil {
+		prop, err = json.Marshal(p.Properties)
+		if err != nil {
+			return err
+		}
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(query, p.Path, p.Status, p.Reason, prop)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetPort returns the port with the given path.
+func GetPort(db *sql.DB, path string) (*Port, error) {
+	var query = `
+	SELECT * from ports  WHERE path=$1 LIMIT 1;
+	`
+	p := &Port{}
+	var prop []byte
+	err := db.QueryRow(query, path).Scan(
+		&p.Path,
+		&p.Status,
+		&p.Reason,
+		&prop,
+		&p.CreatedOn,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if prop != nil {
+		err = json.Unmarshal(prop, &p.Properties)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// GetAllPorts returns all the ports ordered by path.
+func GetAllPorts(db *sql.DB) ([]*Port, error) {
+	query := "select * from ports order by path"
+	var rst []*Port
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		p := &Port{}
+		var prop []byte
+		err := rows.Scan(
+			&p.Path,
+			&p.Status,
+			&p.Reason,
+			&prop,
+			&p.CreatedOn,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if prop != nil {
+			err = json.Unmarshal(prop, &p.Properties)
+			if err != nil {
+				return nil, err
+			}
+		}
+		rst = append(rst, p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return rst, nil
+}
+
+// RemovePort deletes the port with the given path.
+func RemovePort(db *sql.DB, path string) error {
+	var query = `
+BEGIN TRANSACTION;
+   DELETE FROM ports
+  WHERE path=$1;
+COMMIT;
+	`
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(query, path)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
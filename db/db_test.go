@@ -134,3 +134,87 @@ func TestRemoveDongle(t *testing.T) {
 	}
 
 }
+
+func TestUpdateDongle(t *testing.T) {
+	q, err := dbWIthName("update.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	d := &Dongle{IMEI: "123", IMSI: "456", ICCID: "789", Path: "/dev/ttyUSB0"}
+	err = CreateDongle(q, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err = GetDongle(q, d.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.ICCID != "789" {
+		t.Errorf("expected 789 got %s", d.ICCID)
+	}
+	if d.Signal != nil {
+		t.Errorf("expected no signal got %d", *d.Signal)
+	}
+	d.IsSymlinked = true
+	d.ICCID = "790"
+	d.Operator = "Vodacom"
+	d.SIM = "ready"
+	d.Health = "ok"
+	signal := 17
+	d.Signal = &signal
+	err = UpdateDongle(q, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err = GetDongle(q, d.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.IsSymlinked {
+		t.Error("expected the dongle to be symlinked")
+	}
+	if d.ICCID != "790" {
+		t.Errorf("expected 790 got %s", d.ICCID)
+	}
+	if d.Operator != "Vodacom" || d.Signal == nil || *d.Signal != 17 || d.SIM != "ready" || d.Health != "ok" {
+		t.Errorf("expected Vodacom with a signal of 17 got %s %v %s %s", d.Operator, d.Signal, d.SIM, d.Health)
+	}
+}
+
+func TestPorts(t *testing.T) {
+	q, err := dbWIthName("ports.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	sample := []*Port{
+		{Path: "/dev/ttyUSB3", Status: PortIgnored, Reason: "relay"},
+		{Path: "/dev/ttyUSB1", Status: PortPassive, Reason: "gps"},
+		{Path: "/dev/ttyUSB3", Status: PortIgnored, Reason: "relay board"},
+	}
+	for _, v := range sample {
+		err = CreatePort(q, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ports, err := GetAllPorts(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ports) != 2 {
+		t.Fatalf("expected 2 ports got %d", len(ports))
+	}
+	if ports[0].Path != "/dev/ttyUSB1" || ports[1].Reason != "relay board" {
+		t.Errorf("unexpected ports %v %v", ports[0], ports[1])
+	}
+	err = RemovePort(q, "/dev/ttyUSB1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = GetPort(q, "/dev/ttyUSB1")
+	if err != sql.ErrNoRows {
+		t.Errorf("expected %v got %v", sql.ErrNoRows, err)
+	}
+}
@@ -0,0 +1,44 @@
+// Package dbtest provides the database of the tests of the packages using db.
+package dbtest
+
+import (
+	"database/sql"
+	"sync"
+	"testing"
+
+	"github.com/FarmRadioHangar/fdevices/db"
+)
+
+var (
+	once sync.Once
+	ql   *sql.DB
+	err  error
+)
+
+// DB returns the in memory database shared by the tests of a package. It is
+// filled with dongles and ports by the first call, later calls get it as it
+// is, because the in memory database can only be opened once per process.
+func DB(t testing.TB, dongles []*db.Dongle, ports []*db.Port) *sql.DB {
+	once.Do(func() {
+		ql, err = db.DB()
+		if err != nil {
+			return
+		}
+		for _, d := range dongles {
+			err = db.CreateDongle(ql, d)
+			if err != nil {
+				return
+			}
+		}
+		for _, p := range ports {
+			err = db.CreatePort(ql, p)
+			if err != nil {
+				return
+			}
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ql
+}
@@ -2,68 +2,399 @@ package events
 
 import (
 	"context"
+	"errors"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/FarmRadioHangar/fdevices/metrics"
+	"github.com/FarmRadioHangar/fdevices/schema"
 	uuid "github.com/satori/go.uuid"
 )
 
-type Event struct {
-	Name string      `json:"name"`
-	Data interface{} `json:"data"`
+// Default limits of the event history.
+const (
+	DefaultHistorySize = 1000
+	DefaultHistoryAge  = time.Hour
+)
+
+var sent = metrics.NewCounter("fdevices_events_total", "Events sent, by type.", "type")
+
+// ErrGap is returned when a subscriber asks for events which are no longer in
+// the history. The subscriber has missed events and must fetch the state of
+// the dongles again.
+var ErrGap = errors.New("events: requested events are no longer in the history")
+
+// Policy decides what happens to events for a subscriber which does not keep
+// up with the stream.
+type Policy string
+
+// Policies for slow subscribers.
+const (
+	// DropOldest discards the oldest buffered event to make room for the new
+	// one.
+	DropOldest Policy = "drop-oldest"
+
+	// DropNewest discards the new event.
+	DropNewest Policy = "drop-newest"
+
+	// Disconnect closes the subscription once the subscriber lags MaxLag
+	// events behind. The subscriber can resume from the last event it got.
+	Disconnect Policy = "disconnect"
+)
+
+// ParsePolicy returns the policy named p.
+func ParsePolicy(p string) (Policy, error) {
+	switch Policy(p) {
+	case DropOldest, DropNewest, Disconnect:
+		return Policy(p), nil
+	}
+	return "", errors.New("events: unknown policy " + p)
+}
+
+// New returns an event of type t about device, carrying the payload data. The
+// sequence number and boot are assigned when the event goes through a Stream.
+func New(t schema.Type, device schema.Device, data interface{}) *schema.Event {
+	return &schema.Event{
+		Version: schema.Version,
+		Time:    time.Now(),
+		Type:    t,
+		Device:  device,
+		Data:    data,
+	}
+}
+
+// Options configure a subscription.
+type Options struct {
+	// Since is the sequence number of the last event the subscriber has
+	// seen. The events after it are replayed from the history.
+	Since uint64
+
+	// Boot is the boot of the event Since refers to. Since is from another
+	// process, and the events after it are lost, unless Boot is the boot of
+	// the stream.
+	Boot string
+
+	// Buffer is the number of events buffered for the subscriber. Defaults to
+	// the size the stream was created with.
+	Buffer int
+
+	// Policy is what is done when the buffer is full. Defaults to DropOldest.
+	Policy Policy
+
+	// MaxLag is the number of buffered events at which a subscriber with the
+	// Disconnect policy is disconnected. Defaults to Buffer.
+	MaxLag int
+
+	// Filter selects the events the subscriber receives, including the ones
+	// replayed from the history.
+	Filter *Filter
+}
+
+// Stats are the counters of a subscription.
+type Stats struct {
+	ID           string    `json:"id"`
+	Policy       Policy    `json:"policy"`
+	Since        time.Time `json:"since"`
+	Delivered    uint64    `json:"delivered"`
+	Dropped      uint64    `json:"dropped"`
+	Lag          int       `json:"lag"`
+	Disconnected bool      `json:"disconnected"`
+}
+
+// Subscription receives the events of a Stream on C. C is closed when the
+// subscription ends, either by Unsubscribe or because the subscriber was
+// disconnected by its policy.
+type Subscription struct {
+	ID string
+	C  <-chan *schema.Event
+
+	// Seq is the sequence number of the last event sent before the
+	// subscription was made. Apart from replayed events, the events received
+	// on C come after it.
+	Seq uint64
+
+	c      chan *schema.Event
+	stream *Stream
+	filter *Filter
+	policy Policy
+	maxLag int
+	since  time.Time
+
+	// guarded by the stream lock
+	delivered    uint64
+	dropped      uint64
+	disconnected bool
+	closed       bool
 }
 
+// deliver hands ev to the subscriber without ever blocking. It returns false
+// when the subscriber has to be disconnected.
+func (s *Subscription) deliver(ev *schema.Event) bool {
+	if !s.filter.Match(ev) {
+		return true
+	}
+	if s.policy == Disconnect && len(s.c) >= s.maxLag {
+		s.disconnected = true
+		s.dropped++
+		return false
+	}
+	for {
+		select {
+		case s.c <- ev:
+			s.delivered++
+			return true
+		default:
+		}
+		if s.policy != DropOldest {
+			s.dropped++
+			return true
+		}
+		select {
+		case <-s.c:
+			s.dropped++
+		default:
+		}
+	}
+}
+
+func (s *Subscription) close() {
+	if !s.closed {
+		s.closed = true
+		close(s.c)
+	}
+}
+
+// Stats returns the counters of the subscription.
+func (s *Subscription) Stats() Stats {
+	s.stream.mu.RLock()
+	defer s.stream.mu.RUnlock()
+	return s.stats()
+}
+
+func (s *Subscription) stats() Stats {
+	return Stats{
+		ID:           s.ID,
+		Policy:       s.policy,
+		Since:        s.since,
+		Delivered:    s.delivered,
+		Dropped:      s.dropped,
+		Lag:          len(s.c),
+		Disconnected: s.disconnected,
+	}
+}
+
+// Stream fans out events to subscribers. The last events are kept in a
+// history, so subscribers that reconnect can pick up where they left off.
+//
+// Events are numbered and handed to the subscribers in the order Send was
+// called, so events about the same device always reach a subscriber in the
+// order they were produced. Subscribers may miss events depending on their
+// policy, but never get them out of order.
 type Stream struct {
-	evts chan *Event
-	subs map[string]chan *Event
-	mu   sync.RWMutex
+	// HistorySize is the maximum number of events kept in the history, no
+	// history is kept when it is zero or less.
+	HistorySize int
+
+	// HistoryAge is how long events are kept in the history.
+	HistoryAge time.Duration
+
+	size    int
+	subs    map[string]*Subscription
+	boot    string
+	seq     uint64
+	history []*schema.Event
+	stopped bool
+	mu      sync.RWMutex
 }
 
+// NewStream returns a stream buffering size events for each subscriber. The
+// stream is given a new boot, which tells its sequence numbers from those of
+// other streams.
 func NewStream(size int) *Stream {
 	return &Stream{
-		evts: make(chan *Event, size),
-		subs: make(map[string]chan *Event),
+		HistorySize: DefaultHistorySize,
+		HistoryAge:  DefaultHistoryAge,
+		size:        size,
+		subs:        make(map[string]*Subscription),
+		boot:        uuid.NewV4().String()[:8],
 	}
 }
 
-func (s *Stream) Subscribe() (string, <-chan *Event) {
-	id := uuid.NewV4()
-	e := make(chan *Event, 10)
+// Boot returns the boot set on the events of the stream.
+func (s *Stream) Boot() string {
+	return s.boot
+}
+
+// Subscribe returns a subscription to the events of the stream. When
+// opts.Since is not zero, the events from the history with a sequence number
+// after it are received first.
+//
+// ErrGap is returned when some of the events after opts.Since are no longer in
+// the history, or opts.Boot is not the boot of the stream.
+func (s *Stream) Subscribe(opts Options) (*Subscription, error) {
+	if opts.Buffer <= 0 {
+		opts.Buffer = s.size
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = 1
+	}
+	if opts.Policy == "" {
+		opts.Policy = DropOldest
+	}
 	s.mu.Lock()
-	s.subs[id.String()] = e
-	s.mu.Unlock()
-	return id.String(), e
+	defer s.mu.Unlock()
+	var replay []*schema.Event
+	if opts.Since > 0 {
+		if opts.Boot != s.boot {
+			return nil, ErrGap
+		}
+		all, err := s.after(opts.Since)
+		if err != nil {
+			return nil, err
+		}
+		for _, ev := range all {
+			if opts.Filter.Match(ev) {
+				replay = append(replay, ev)
+			}
+		}
+	}
+	size := opts.Buffer + len(replay)
+	if opts.MaxLag <= 0 || opts.MaxLag > size {
+		opts.MaxLag = size
+	}
+	c := make(chan *schema.Event, size)
+	sub := &Subscription{
+		ID:     uuid.NewV4().String(),
+		C:      c,
+		Seq:    s.seq,
+		c:      c,
+		stream: s,
+		filter: opts.Filter,
+		policy: opts.Policy,
+		maxLag: opts.MaxLag,
+		since:  time.Now(),
+	}
+	for _, ev := range replay {
+		sub.c <- ev
+		sub.delivered++
+	}
+	s.subs[sub.ID] = sub
+	return sub, nil
+}
 
+// after returns the events in the history with a sequence number after since.
+func (s *Stream) after(since uint64) ([]*schema.Event, error) {
+	s.expire()
+	if since > s.seq {
+		return nil, ErrGap
+	}
+	oldest := s.seq + 1
+	if len(s.history) > 0 {
+		oldest = s.history[0].Seq
+	}
+	if since+1 < oldest {
+		return nil, ErrGap
+	}
+	i := len(s.history) - int(s.seq-since)
+	return append([]*schema.Event(nil), s.history[i:]...), nil
 }
 
-func (s *Stream) Send(evt *Event) {
-	go s.send(evt)
+// Oldest returns the sequence number of the oldest event in the history, or
+// zero when the history is empty.
+func (s *Stream) Oldest() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+	if len(s.history) == 0 {
+		return 0
+	}
+	return s.history[0].Seq
+}
+
+// record adds ev to the history, dropping events which are too old or over
+// the size limit.
+func (s *Stream) record(ev *schema.Event) {
+	s.history = append(s.history, ev)
+	size := s.HistorySize
+	if size < 0 {
+		size = 0
+	}
+	if n := len(s.history) - size; n > 0 {
+		s.history = append(s.history[:0], s.history[n:]...)
+	}
+	s.expire()
+}
+
+func (s *Stream) expire() {
+	if s.HistoryAge <= 0 {
+		return
+	}
+	limit := time.Now().Add(-s.HistoryAge)
+	n := 0
+	for n < len(s.history) && s.history[n].Time.Before(limit) {
+		n++
+	}
+	if n > 0 {
+		s.history = append(s.history[:0], s.history[n:]...)
+	}
 }
 
-func (s *Stream) send(evt *Event) {
-	s.evts <- evt
+// Send numbers evt, records it in the history and hands it to every
+// subscriber. It never blocks on slow subscribers.
+func (s *Stream) Send(evt *schema.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return
+	}
+	s.seq++
+	evt.Seq = s.seq
+	evt.Boot = s.boot
+	s.record(evt)
+	sent.Add(1, string(evt.Type))
+	for id, sub := range s.subs {
+		if !sub.deliver(evt) {
+			sub.close()
+			delete(s.subs, id)
+		}
+	}
 }
 
+// Start ties the stream to ctx. When ctx is done all subscriptions are closed,
+// and events which are sent afterwards are discarded.
 func (s *Stream) Start(ctx context.Context) {
 	go func() {
-		for {
-			select {
-			case ev := <-s.evts:
-				s.mu.RLock()
-				for _, ch := range s.subs {
-					go func(c chan *Event) {
-						ch <- ev
-					}(ch)
-				}
-				s.mu.RUnlock()
-			case <-ctx.Done():
-				return
-			}
+		<-ctx.Done()
+		s.mu.Lock()
+		s.stopped = true
+		for id, sub := range s.subs {
+			sub.close()
+			delete(s.subs, id)
 		}
+		s.mu.Unlock()
 	}()
 }
 
+// Unsubscribe ends the subscription with the given id, and closes its channel.
 func (s *Stream) Unsubscribe(id string) {
 	s.mu.Lock()
-	delete(s.subs, id)
+	if sub, ok := s.subs[id]; ok {
+		sub.close()
+		delete(s.subs, id)
+	}
 	s.mu.Unlock()
 }
+
+// Stats returns the counters of the current subscriptions, ordered by the
+// time they subscribed.
+func (s *Stream) Stats() []Stats {
+	s.mu.RLock()
+	o := make([]Stats, 0, len(s.subs))
+	for _, sub := range s.subs {
+		o = append(o, sub.stats())
+	}
+	s.mu.RUnlock()
+	sort.Slice(o, func(i, j int) bool { return o[i].Since.Before(o[j].Since) })
+	return o
+}
@@ -0,0 +1,254 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/FarmRadioHangar/fdevices/schema"
+)
+
+func receive(t *testing.T, ch <-chan *schema.Event) *schema.Event {
+	select {
+	case ev := <-ch:
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+	return nil
+}
+
+func TestSubscribeSince(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := NewStream(10)
+	s.HistorySize = 3
+	s.Start(ctx)
+	live, err := s.Subscribe(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		s.Send(New(schema.Update, schema.Device{Path: "/dev/ttyUSB0"}, nil))
+		receive(t, live.C)
+	}
+	s.Unsubscribe(live.ID)
+
+	sub, err := s.Subscribe(Options{Since: 3, Boot: s.Boot()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.Seq != 5 {
+		t.Errorf("expected the subscription at 5 got %d", sub.Seq)
+	}
+	for _, seq := range []uint64{4, 5} {
+		ev := receive(t, sub.C)
+		if ev.Seq != seq {
+			t.Errorf("expected %d got %d", seq, ev.Seq)
+		}
+	}
+	if _, err = s.Subscribe(Options{Since: 5, Boot: s.Boot()}); err != nil {
+		t.Errorf("expected no error got %v", err)
+	}
+	if _, err = s.Subscribe(Options{Since: 1, Boot: s.Boot()}); err != ErrGap {
+		t.Errorf("expected %v got %v", ErrGap, err)
+	}
+	if _, err = s.Subscribe(Options{Since: 9, Boot: s.Boot()}); err != ErrGap {
+		t.Errorf("expected %v got %v", ErrGap, err)
+	}
+	// the same sequence number sent by another process
+	if _, err = s.Subscribe(Options{Since: 4, Boot: NewStream(10).Boot()}); err != ErrGap {
+		t.Errorf("expected %v for another boot got %v", ErrGap, err)
+	}
+	if o := s.Oldest(); o != 3 {
+		t.Errorf("expected 3 got %d", o)
+	}
+}
+
+func TestHistoryAge(t *testing.T) {
+	s := NewStream(10)
+	s.HistoryAge = time.Minute
+	old := New(schema.Add, schema.Device{}, nil)
+	old.Time = time.Now().Add(-2 * time.Minute)
+	old.Seq = 1
+	recent := New(schema.Add, schema.Device{}, nil)
+	recent.Seq = 2
+	s.seq = 2
+	s.record(old)
+	s.record(recent)
+	if _, err := s.Subscribe(Options{Since: 1, Boot: s.Boot()}); err != nil {
+		t.Errorf("expected no error got %v", err)
+	}
+	if o := s.Oldest(); o != 2 {
+		t.Errorf("expected 2 got %d", o)
+	}
+
+	s.HistorySize = -1
+	s.Send(New(schema.Add, schema.Device{}, nil))
+	if o := s.Oldest(); o != 0 {
+		t.Errorf("expected no history got %d", o)
+	}
+}
+
+func TestPolicies(t *testing.T) {
+	s := NewStream(10)
+	oldest, _ := s.Subscribe(Options{Buffer: 2, Policy: DropOldest})
+	newest, _ := s.Subscribe(Options{Buffer: 2, Policy: DropNewest})
+	slow, _ := s.Subscribe(Options{Buffer: 5, Policy: Disconnect, MaxLag: 3})
+	for i := 0; i < 5; i++ {
+		s.Send(New(schema.Update, schema.Device{}, nil))
+	}
+	expect := []struct {
+		sub  *Subscription
+		seqs []uint64
+	}{
+		{oldest, []uint64{4, 5}},
+		{newest, []uint64{1, 2}},
+		{slow, []uint64{1, 2, 3}},
+	}
+	for _, v := range expect {
+		var got []uint64
+		for ev := range v.sub.C {
+			got = append(got, ev.Seq)
+			if len(got) == len(v.seqs) && v.sub != slow {
+				break
+			}
+		}
+		if len(got) != len(v.seqs) {
+			t.Fatalf("%s: expected %v got %v", v.sub.policy, v.seqs, got)
+		}
+		for i := range got {
+			if got[i] != v.seqs[i] {
+				t.Errorf("%s: expected %v got %v", v.sub.policy, v.seqs, got)
+				break
+			}
+		}
+	}
+	st := oldest.Stats()
+	if st.Delivered != 5 || st.Dropped != 3 {
+		t.Errorf("expected 5 delivered 3 dropped got %d %d", st.Delivered, st.Dropped)
+	}
+	st = newest.Stats()
+	if st.Delivered != 2 || st.Dropped != 3 {
+		t.Errorf("expected 2 delivered 3 dropped got %d %d", st.Delivered, st.Dropped)
+	}
+	st = slow.Stats()
+	if !st.Disconnected || st.Delivered != 3 {
+		t.Errorf("expected disconnected after 3 delivered got %v %d", st.Disconnected, st.Delivered)
+	}
+	if n := len(s.Stats()); n != 2 {
+		t.Errorf("expected 2 subscriptions got %d", n)
+	}
+}
+
+func TestUnsubscribeCloses(t *testing.T) {
+	s := NewStream(10)
+	sub, _ := s.Subscribe(Options{})
+	s.Unsubscribe(sub.ID)
+	select {
+	case _, ok := <-sub.C:
+		if ok {
+			t.Error("expected no event")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the channel to be closed")
+	}
+	s.Send(New(schema.Update, schema.Device{}, nil))
+	if n := len(s.Stats()); n != 0 {
+		t.Errorf("expected no subscriptions got %d", n)
+	}
+}
+
+// ordered checks that the events of every device, numbered by their producer,
+// are received in increasing order.
+func ordered(t *testing.T, name string, sub *Subscription, done <-chan struct{}) int {
+	last := make(map[string]int)
+	var seq uint64
+	var n int
+	for {
+		select {
+		case ev, ok := <-sub.C:
+			if !ok {
+				return n
+			}
+			n++
+			if ev.Seq <= seq {
+				t.Errorf("%s: seq %d received after %d", name, ev.Seq, seq)
+				return n
+			}
+			seq = ev.Seq
+			i := ev.Data.(int)
+			if p, ok := last[ev.Device.IMEI]; ok && i <= p {
+				t.Errorf("%s: %s event %d received after %d", name, ev.Device.IMEI, i, p)
+				return n
+			}
+			last[ev.Device.IMEI] = i
+		case <-done:
+			return n
+		}
+	}
+}
+
+func TestPerDeviceOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := NewStream(64)
+	s.Start(ctx)
+	const devices, perDevice = 20, 500
+	subs := []*Subscription{}
+	for _, o := range []Options{
+		{Buffer: devices * perDevice},
+		{Buffer: 8, Policy: DropOldest},
+		{Buffer: 8, Policy: DropNewest},
+		{Buffer: 16, Policy: Disconnect},
+	} {
+		sub, err := s.Subscribe(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		subs = append(subs, sub)
+	}
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	counts := make([]int, len(subs))
+	for i, sub := range subs {
+		readers.Add(1)
+		go func(i int, sub *Subscription) {
+			defer readers.Done()
+			counts[i] = ordered(t, string(sub.policy), sub, done)
+		}(i, sub)
+	}
+	var producers sync.WaitGroup
+	for d := 0; d < devices; d++ {
+		producers.Add(1)
+		go func(imei string) {
+			defer producers.Done()
+			for i := 0; i < perDevice; i++ {
+				s.Send(New(schema.Update, schema.Device{IMEI: imei}, i))
+			}
+		}(fmt.Sprintf("imei-%d", d))
+	}
+	producers.Wait()
+	time.Sleep(100 * time.Millisecond)
+	close(done)
+	readers.Wait()
+	if counts[0] != devices*perDevice {
+		t.Errorf("expected %d events got %d", devices*perDevice, counts[0])
+	}
+}
+
+func TestSendOrder(t *testing.T) {
+	s := NewStream(10)
+	sub, _ := s.Subscribe(Options{})
+	for _, v := range []schema.Type{schema.Add, schema.Update, schema.Remove} {
+		s.Send(New(v, schema.Device{IMEI: "123"}, nil))
+	}
+	for _, v := range []schema.Type{schema.Add, schema.Update, schema.Remove} {
+		ev := receive(t, sub.C)
+		if ev.Type != v {
+			t.Errorf("expected %s got %s", v, ev.Type)
+		}
+	}
+}
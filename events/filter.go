@@ -0,0 +1,89 @@
+package events
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/FarmRadioHangar/fdevices/schema"
+)
+
+// Filter selects the events a subscriber receives. Within a field the values
+// are alternatives, an event has to match every field which is set. A nil
+// Filter matches everything.
+type Filter struct {
+	Types []schema.Type
+	IMEI  []string
+	IMSI  []string
+	ICCID []string
+
+	// Labels is a selector, every label in it must be set to the same value
+	// on the device.
+	Labels map[string]string
+}
+
+// Match returns true when e passes the filter. Gap events concern the
+// subscription rather than a device, and always pass.
+func (f *Filter) Match(e *schema.Event) bool {
+	if f == nil || e.Type == schema.Gap {
+		return true
+	}
+	if len(f.Types) > 0 {
+		ok := false
+		for _, t := range f.Types {
+			if t == e.Type {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return f.MatchDevice(e.Device)
+}
+
+// MatchDevice returns true when the device d passes the filter, the event
+// types are not considered.
+func (f *Filter) MatchDevice(d schema.Device) bool {
+	if f == nil {
+		return true
+	}
+	if !oneOf(f.IMEI, d.IMEI) || !oneOf(f.IMSI, d.IMSI) || !oneOf(f.ICCID, d.ICCID) {
+		return false
+	}
+	for k, v := range f.Labels {
+		if l, ok := d.Labels[k]; !ok || l != v {
+			return false
+		}
+	}
+	return true
+}
+
+func oneOf(set []string, v string) bool {
+	if len(set) == 0 {
+		return true
+	}
+	for _, s := range set {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseSelector parses a label selector of the form key=value,key=value.
+func ParseSelector(s string) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		i := strings.Index(kv, "=")
+		if i <= 0 {
+			return nil, errors.New("events: bad label selector " + kv)
+		}
+		m[strings.TrimSpace(kv[:i])] = strings.TrimSpace(kv[i+1:])
+	}
+	return m, nil
+}
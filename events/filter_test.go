@@ -0,0 +1,83 @@
+package events
+
+import (
+	"context"
+	"testing"
+
+	"github.com/FarmRadioHangar/fdevices/schema"
+)
+
+func TestFilterMatch(t *testing.T) {
+	dev := schema.Device{IMEI: "123", IMSI: "456", Path: "/dev/ttyUSB0",
+		Labels: map[string]string{"port": "1-1.3", "name": "news"}}
+	sample := []struct {
+		filter *Filter
+		typ    schema.Type
+		match  bool
+	}{
+		{nil, schema.Add, true},
+		{&Filter{}, schema.Add, true},
+		{&Filter{Types: []schema.Type{schema.Add, schema.Remove}}, schema.Add, true},
+		{&Filter{Types: []schema.Type{schema.Remove}}, schema.Add, false},
+		{&Filter{Types: []schema.Type{schema.Remove}}, schema.Gap, true},
+		{&Filter{IMEI: []string{"999", "123"}}, schema.Update, true},
+		{&Filter{IMEI: []string{"123"}, IMSI: []string{"999"}}, schema.Update, false},
+		{&Filter{ICCID: []string{"890"}}, schema.Update, false},
+		{&Filter{Labels: map[string]string{"port": "1-1.3"}}, schema.Update, true},
+		{&Filter{Labels: map[string]string{"port": "1-1.3", "name": "sport"}}, schema.Update, false},
+		{&Filter{Labels: map[string]string{"room": ""}}, schema.Update, false},
+	}
+	for i, v := range sample {
+		e := New(v.typ, dev, nil)
+		if m := v.filter.Match(e); m != v.match {
+			t.Errorf("%d: expected %v got %v", i, v.match, m)
+		}
+	}
+}
+
+func TestParseSelector(t *testing.T) {
+	l, err := ParseSelector("port=1-1.3, name = news,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l) != 2 || l["port"] != "1-1.3" || l["name"] != "news" {
+		t.Errorf("unexpected selector %v", l)
+	}
+	if _, err = ParseSelector("port"); err == nil {
+		t.Error("expected an error")
+	}
+	if _, err = ParseSelector("=news"); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestSubscribeFilter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := NewStream(10)
+	s.Start(ctx)
+	s.Send(New(schema.Add, schema.Device{IMEI: "1"}, nil))
+	s.Send(New(schema.Add, schema.Device{IMEI: "2"}, nil))
+
+	sub, err := s.Subscribe(Options{Since: 0, Filter: &Filter{IMEI: []string{"2"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay, err := s.Subscribe(Options{Since: 1, Boot: s.Boot(), Filter: &Filter{IMEI: []string{"2"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev := receive(t, replay.C); ev.Seq != 2 {
+		t.Errorf("expected replay of 2 got %d", ev.Seq)
+	}
+	s.Send(New(schema.Remove, schema.Device{IMEI: "1"}, nil))
+	s.Send(New(schema.Remove, schema.Device{IMEI: "2"}, nil))
+	for _, c := range []<-chan *schema.Event{sub.C, replay.C} {
+		if ev := receive(t, c); ev.Seq != 4 {
+			t.Errorf("expected 4 got %d", ev.Seq)
+		}
+	}
+	if st := sub.Stats(); st.Delivered != 1 || st.Dropped != 0 {
+		t.Errorf("expected filtered events not to be counted got %+v", st)
+	}
+}
@@ -0,0 +1,395 @@
+// Package journal keeps the events of fdevices on disk, so they can be looked
+// at after the fact.
+//
+// The journal is a directory of segments. A segment is a file holding one
+// JSON encoded event per line, named after the time it was started, like
+// 20170418T100000.000000000Z.jsonl. A new segment is started when the current
+// one is too big or too old, and the oldest segments are removed when there
+// are too many of them.
+//
+// Every event is written with a single write followed by fsync. A line which
+// was cut short by a crash is removed when the journal is opened again, and
+// skipped by readers. When writing falls so far behind that events are lost,
+// a gap event is written in their place.
+package journal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FarmRadioHangar/fdevices/events"
+	"github.com/FarmRadioHangar/fdevices/log"
+	"github.com/FarmRadioHangar/fdevices/schema"
+)
+
+// Defaults for the rotation of segments.
+const (
+	DefaultMaxSize     = 1 << 20
+	DefaultMaxAge      = 24 * time.Hour
+	DefaultMaxSegments = 30
+)
+
+// DefaultBuffer is the number of events Run holds while writing is behind.
+const DefaultBuffer = 10000
+
+const (
+	ext        = ".jsonl"
+	nameLayout = "20060102T150405.000000000Z"
+
+	// maxLine is the size of the longest event which can be read back.
+	maxLine = 1 << 20
+)
+
+// Journal appends events to the segments in a directory.
+//
+// This is safe to use concurrently in multiple goroutines
+type Journal struct {
+	// MaxSize is the size in bytes after which a new segment is started.
+	MaxSize int64
+
+	// MaxAge is the age after which a new segment is started.
+	MaxAge time.Duration
+
+	// MaxSegments is the number of segments which are kept.
+	MaxSegments int
+
+	// Buffer is the number of events Run holds while writing is behind.
+	Buffer int
+
+	dir string
+
+	mu    sync.Mutex
+	f     *os.File
+	size  int64
+	start time.Time
+}
+
+// Open opens the journal in dir, which is created when it does not exist.
+func Open(dir string) (*Journal, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{
+		MaxSize:     DefaultMaxSize,
+		MaxAge:      DefaultMaxAge,
+		MaxSegments: DefaultMaxSegments,
+		Buffer:      DefaultBuffer,
+		dir:         dir,
+	}
+	segs, err := segments(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(segs) == 0 {
+		return j, nil
+	}
+	last := segs[len(segs)-1]
+	f, err := os.OpenFile(last.path, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	size, err := repair(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("journal: %s: %v", last.path, err)
+	}
+	j.f = f
+	j.size = size
+	j.start = last.start
+	return j, nil
+}
+
+// repair truncates f after its last complete line, and returns the new size.
+func repair(f *os.File) (int64, error) {
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return 0, err
+	}
+	n := int64(strings.LastIndex(string(b), "\n") + 1)
+	if n == int64(len(b)) {
+		return n, nil
+	}
+	log.Info("journal: dropping %d bytes of a partial event in %s", int64(len(b))-n, f.Name())
+	err = f.Truncate(n)
+	if err != nil {
+		return 0, err
+	}
+	return n, f.Sync()
+}
+
+// Dir returns the directory of the journal.
+func (j *Journal) Dir() string {
+	return j.dir
+}
+
+// Append writes e to the journal.
+func (j *Journal) Append(e *schema.Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	if j.f == nil || j.size >= j.MaxSize || now.Sub(j.start) >= j.MaxAge {
+		err = j.rotate(now)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = j.f.Write(b)
+	if err != nil {
+		// do not leave a partial line behind for the next event
+		_ = j.f.Truncate(j.size)
+		return err
+	}
+	j.size += int64(len(b))
+	return j.f.Sync()
+}
+
+// rotate starts a new segment and removes the oldest segments, it must be
+// called with the lock held.
+func (j *Journal) rotate(now time.Time) error {
+	if j.f != nil {
+		j.f.Close()
+		j.f = nil
+	}
+	var f *os.File
+	var err error
+	for {
+		name := filepath.Join(j.dir, now.UTC().Format(nameLayout)+ext)
+		f, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL|os.O_APPEND, 0644)
+		if !os.IsExist(err) {
+			break
+		}
+		now = now.Add(time.Nanosecond)
+	}
+	if err != nil {
+		return err
+	}
+	j.f = f
+	j.size = 0
+	j.start = now
+	segs, err := segments(j.dir)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(segs)-j.MaxSegments; i++ {
+		err = os.Remove(segs[i].path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the current segment.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return nil
+	}
+	err := j.f.Close()
+	j.f = nil
+	return err
+}
+
+// Run appends the events of s to the journal until ctx is done.
+//
+// When more than Buffer events are waiting to be written, Run catches up from
+// the history of s. The events which are no longer there are lost, a gap event
+// is written instead.
+func (j *Journal) Run(ctx context.Context, s *events.Stream) error {
+	defer j.Close()
+	var last uint64
+	for {
+		opts := events.Options{
+			Since:  last,
+			Boot:   s.Boot(),
+			Buffer: j.Buffer,
+			Policy: events.Disconnect,
+		}
+		sub, err := s.Subscribe(opts)
+		if err == events.ErrGap {
+			oldest := s.Oldest()
+			log.Error("journal: lost the events after %d, the oldest available is %d", last, oldest)
+			err = j.Append(events.New(schema.Gap, schema.Device{}, &schema.Missed{Since: last, Oldest: oldest}))
+			if err != nil {
+				log.Error("journal: %v", err)
+			}
+			opts.Since = 0
+			sub, err = s.Subscribe(opts)
+		}
+		if err != nil {
+			return err
+		}
+		done := j.follow(ctx, sub, &last)
+		s.Unsubscribe(sub.ID)
+		if done {
+			return nil
+		}
+		log.Error("journal: fell behind after event %d, catching up", last)
+	}
+}
+
+// follow appends the events of sub, keeping the sequence number of the last
+// one in last. It returns false when sub was disconnected for falling behind.
+func (j *Journal) follow(ctx context.Context, sub *events.Subscription, last *uint64) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return true
+		case e, ok := <-sub.C:
+			if !ok {
+				return !sub.Stats().Disconnected
+			}
+			err := j.Append(e)
+			if err != nil {
+				log.Error("journal: %v", err)
+			}
+			*last = e.Seq
+		}
+	}
+}
+
+type segment struct {
+	path  string
+	start time.Time
+}
+
+// segments returns the segments in dir, oldest first.
+func segments(dir string) ([]segment, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var o []segment
+	for _, v := range files {
+		name := v.Name()
+		if v.IsDir() || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		t, err := time.Parse(nameLayout, strings.TrimSuffix(name, ext))
+		if err != nil {
+			continue
+		}
+		o = append(o, segment{path: filepath.Join(dir, name), start: t})
+	}
+	sort.Slice(o, func(i, k int) bool { return o[i].start.Before(o[k].start) })
+	return o, nil
+}
+
+// Query selects events from the journal.
+type Query struct {
+	// Since and Until bound the time of the events, they are ignored when
+	// zero.
+	Since time.Time
+	Until time.Time
+
+	Filter *events.Filter
+
+	// Limit is the maximum number of events returned, the most recent ones
+	// are kept. There is no limit when it is zero. Segments are read newest
+	// first, and the older ones are not read once Limit events are found.
+	Limit int
+}
+
+// Read returns the events in the journal in dir matching q, oldest first.
+// The sequence numbers of events start again at one whenever fdevices is
+// restarted, events are ordered by the order they were written in.
+func Read(dir string, q Query) ([]*schema.Event, error) {
+	segs, err := segments(dir)
+	if err != nil {
+		return nil, err
+	}
+	var o []*schema.Event
+	for i := len(segs) - 1; i >= 0; i-- {
+		if !q.Until.IsZero() && segs[i].start.After(q.Until) {
+			continue
+		}
+		if i+1 < len(segs) && !q.Since.IsZero() && !segs[i+1].start.After(q.Since) {
+			// every event in this segment and the older ones happened
+			// before the next segment started
+			break
+		}
+		found, err := readSegment(segs[i].path, q)
+		if err != nil {
+			return nil, err
+		}
+		o = append(found, o...)
+		if q.Limit > 0 && len(o) >= q.Limit {
+			break
+		}
+	}
+	if q.Limit > 0 && len(o) > q.Limit {
+		o = o[len(o)-q.Limit:]
+	}
+	return o, nil
+}
+
+// readSegment returns the events in the segment at path matching q, keeping
+// at most the last q.Limit of them.
+func readSegment(path string, q Query) ([]*schema.Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// removed by rotation since it was listed
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var o []*schema.Event
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64*1024), maxLine)
+	for s.Scan() {
+		e, err := schema.Decode(s.Bytes())
+		if err != nil {
+			// a partial line left by a crash
+			continue
+		}
+		if !q.Since.IsZero() && e.Time.Before(q.Since) {
+			continue
+		}
+		if !q.Until.IsZero() && e.Time.After(q.Until) {
+			continue
+		}
+		if !q.Filter.Match(e) {
+			continue
+		}
+		o = append(o, e)
+		if q.Limit > 0 && len(o) > q.Limit {
+			o = o[1:]
+		}
+	}
+	return o, s.Err()
+}
+
+// ParseTime parses a point in time given either as a duration before now,
+// like 2h, or as an RFC 3339 timestamp.
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	d, err := time.ParseDuration(s)
+	if err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("journal: %q is neither a duration nor an RFC 3339 time", s)
+	}
+	return t, nil
+}
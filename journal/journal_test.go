@@ -0,0 +1,190 @@
+package journal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/FarmRadioHangar/fdevices/events"
+	"github.com/FarmRadioHangar/fdevices/schema"
+)
+
+func sample(seq uint64, typ schema.Type, imei string, at time.Time) *schema.Event {
+	e := events.New(typ, schema.Device{IMEI: imei, Path: "/dev/ttyUSB0"}, &schema.Dongle{IMEI: imei})
+	e.Seq = seq
+	e.Time = at
+	return e
+}
+
+func TestAppendAndRead(t *testing.T) {
+	dir := t.TempDir()
+	j, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.MaxSize = 1
+	j.MaxSegments = 3
+	now := time.Now()
+	for i := 1; i <= 5; i++ {
+		typ := schema.Add
+		if i%2 == 0 {
+			typ = schema.Remove
+		}
+		err = j.Append(sample(uint64(i), typ, "123", now.Add(time.Duration(i)*time.Minute)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	segs, err := segments(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segs) != 3 {
+		t.Errorf("expected 3 segments got %d", len(segs))
+	}
+	all, err := Read(dir, Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 || all[0].Seq != 3 || all[2].Seq != 5 {
+		t.Fatalf("expected events 3 to 5 got %v", all)
+	}
+	if _, ok := all[0].Data.(*schema.Dongle); !ok {
+		t.Errorf("expected *schema.Dongle got %T", all[0].Data)
+	}
+	o, err := Read(dir, Query{
+		Since:  now.Add(4 * time.Minute),
+		Filter: &events.Filter{Types: []schema.Type{schema.Add}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(o) != 1 || o[0].Seq != 5 {
+		t.Errorf("expected event 5 got %v", o)
+	}
+	o, err = Read(dir, Query{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(o) != 2 || o[0].Seq != 4 {
+		t.Errorf("expected events 4 and 5 got %v", o)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	dir := t.TempDir()
+	j, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = j.Append(sample(1, schema.Add, "123", time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a crash in the middle of a write
+	_, err = j.f.Write([]byte(`{"version":1,"seq":2,"ty`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	o, err := Read(dir, Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(o) != 1 {
+		t.Errorf("expected the partial event to be skipped got %v", o)
+	}
+	j, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = j.Append(sample(3, schema.Remove, "123", time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err = Read(dir, Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(o) != 2 || o[1].Seq != 3 {
+		t.Errorf("expected events 1 and 3 got %v", o)
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	j, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Buffer = 1
+	ctx, cancel := context.WithCancel(context.Background())
+	s := events.NewStream(10)
+	s.HistorySize = 1
+	s.Start(ctx)
+	ran := make(chan struct{})
+	go func() {
+		j.Run(ctx, s)
+		close(ran)
+	}()
+	defer func() {
+		cancel()
+		<-ran
+	}()
+	// wait until Run is subscribed and holds no event
+	waitLag := func(delivered uint64) {
+		for {
+			st := s.Stats()
+			if len(st) == 1 && st[0].Delivered == delivered && st[0].Lag == 0 {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	waitLag(0)
+
+	// writing hangs while holding event 1, event 2 waits in the buffer and
+	// event 3 disconnects Run
+	j.mu.Lock()
+	s.Send(events.New(schema.Add, schema.Device{IMEI: "1"}, nil))
+	waitLag(1)
+	s.Send(events.New(schema.Add, schema.Device{IMEI: "2"}, nil))
+	s.Send(events.New(schema.Add, schema.Device{IMEI: "3"}, nil))
+	s.Send(events.New(schema.Add, schema.Device{IMEI: "4"}, nil))
+	j.mu.Unlock()
+
+	// only event 4 is left in the history
+	waitLag(0)
+	s.Send(events.New(schema.Add, schema.Device{IMEI: "5"}, nil))
+	var o []*schema.Event
+	for i := 0; i < 500 && len(o) < 4; i++ {
+		time.Sleep(10 * time.Millisecond)
+		o, err = Read(dir, Query{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(o) != 4 || o[0].Seq != 1 || o[1].Seq != 2 || o[2].Type != schema.Gap || o[3].Seq != 5 {
+		t.Fatalf("expected events 1, 2, a gap and 5 got %v", o)
+	}
+	m, ok := o[2].Data.(*schema.Missed)
+	if !ok || m.Since != 2 || m.Oldest != 4 {
+		t.Errorf("expected a gap since 2 with 4 the oldest got %v", o[2].Data)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2017, 4, 18, 10, 0, 0, 0, time.UTC)
+	v, err := ParseTime("2h", now)
+	if err != nil || !v.Equal(now.Add(-2*time.Hour)) {
+		t.Errorf("unexpected %v %v", v, err)
+	}
+	v, err = ParseTime("2017-04-18T03:00:00Z", now)
+	if err != nil || v.Hour() != 3 {
+		t.Errorf("unexpected %v %v", v, err)
+	}
+	if _, err = ParseTime("yesterday", now); err == nil {
+		t.Error("expected an error")
+	}
+}
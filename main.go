@@ -1,18 +1,39 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/FarmRadioHangar/fdevices/auth"
+	"github.com/FarmRadioHangar/fdevices/config"
 	"github.com/FarmRadioHangar/fdevices/db"
 	"github.com/FarmRadioHangar/fdevices/events"
+	"github.com/FarmRadioHangar/fdevices/journal"
 	"github.com/FarmRadioHangar/fdevices/log"
+	"github.com/FarmRadioHangar/fdevices/mqtt"
+	"github.com/FarmRadioHangar/fdevices/rules"
+	"github.com/FarmRadioHangar/fdevices/schema"
+	"github.com/FarmRadioHangar/fdevices/socket"
+	"github.com/FarmRadioHangar/fdevices/symlink"
 	"github.com/FarmRadioHangar/fdevices/udev"
 	"github.com/FarmRadioHangar/fdevices/web"
+	"github.com/FarmRadioHangar/fdevices/webhook"
 	"github.com/okzk/sdnotify"
 	"github.com/urfave/cli"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 func main() {
@@ -30,9 +51,138 @@ func main() {
 					Usage: "ports to bind the server",
 					Value: 8090,
 				},
+				cli.StringFlag{
+					Name:  "config",
+					Usage: "path to the configuration file",
+					Value: config.DefaultPath,
+				},
+				cli.DurationFlag{
+					Name:  "settle",
+					Usage: "time to wait for udev events of a usb device to settle",
+					Value: udev.DefaultSettle,
+				},
+				cli.DurationFlag{
+					Name:  "poll",
+					Usage: "how often the dongles are asked for their signal and operator, 0 never asks",
+					Value: udev.DefaultPollInterval,
+				},
+				cli.IntFlag{
+					Name:  "history-size",
+					Usage: "number of events kept for clients resuming a stream",
+					Value: events.DefaultHistorySize,
+				},
+				cli.DurationFlag{
+					Name:  "history-age",
+					Usage: "how long events are kept for clients resuming a stream",
+					Value: events.DefaultHistoryAge,
+				},
 			},
 			Action: Server,
 		},
+		{
+			Name:  "udev-rules",
+			Usage: "Writes udev rules creating symlinks for the dongles seen so far",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "config",
+					Usage: "path to the configuration file",
+					Value: config.DefaultPath,
+				},
+				cli.StringFlag{
+					Name:  "output",
+					Usage: "path to the rules file",
+					Value: rules.DefaultPath,
+				},
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "print the changes to the rules file without installing it",
+				},
+				cli.BoolFlag{
+					Name:  "reload",
+					Usage: "run udevadm control --reload after installing the rules",
+				},
+			},
+			Action: UdevRules,
+		},
+		{
+			Name:  "events",
+			Usage: "Prints the events kept in the journal",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "config",
+					Usage: "path to the configuration file",
+					Value: config.DefaultPath,
+				},
+				cli.StringFlag{
+					Name:  "since",
+					Usage: "only events after this, a duration like 2h or an RFC 3339 time",
+					Value: "24h",
+				},
+				cli.StringFlag{
+					Name:  "until",
+					Usage: "only events before this, a duration like 2h or an RFC 3339 time",
+				},
+				cli.StringFlag{
+					Name:  "type",
+					Usage: "only events of these comma separated types",
+				},
+				cli.StringFlag{
+					Name:  "imei",
+					Usage: "only events of the dongles with these comma separated IMEIs",
+				},
+				cli.IntFlag{
+					Name:  "limit",
+					Usage: "print only the most recent events",
+				},
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "print the events as JSON, one per line",
+				},
+			},
+			Action: Events,
+		},
+		{
+			Name:  "tokens",
+			Usage: "Manages the tokens of the HTTP API",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "config",
+					Usage: "path to the configuration file",
+					Value: config.DefaultPath,
+				},
+			},
+			Subcommands: []cli.Command{
+				{
+					Name:      "create",
+					Usage:     "Creates a token and prints it",
+					ArgsUsage: "<name>",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "scope",
+							Usage: "comma separated scopes, some of read, sms, control and admin",
+							Value: auth.Read,
+						},
+					},
+					Action: CreateToken,
+				},
+				{
+					Name:   "list",
+					Usage:  "Lists the tokens",
+					Action: ListTokens,
+				},
+				{
+					Name:      "revoke",
+					Usage:     "Revokes a token",
+					ArgsUsage: "<id>",
+					Action:    RevokeToken,
+				},
+			},
+		},
+		{
+			Name:   "hash-password",
+			Usage:  "Reads a password on stdin and prints its hash for the users of the configuration",
+			Action: HashPassword,
+		},
 	}
 	err := app.Run(os.Args)
 	if err != nil {
@@ -43,7 +193,16 @@ func main() {
 
 // Server starts a service that manages the Dongles
 func Server(cxt *cli.Context) error {
+	cfg, err := config.Load(cxt.String("config"))
+	if err != nil {
+		return err
+	}
+	if cxt.Int("history-size") < 0 {
+		return errors.New("history-size must not be negative")
+	}
 	s := events.NewStream(1000)
+	s.HistorySize = cxt.Int("history-size")
+	s.HistoryAge = cxt.Duration("history-age")
 	ql, err := db.DB()
 	if err != nil {
 		return err
@@ -52,20 +211,132 @@ func Server(cxt *cli.Context) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	s.Start(ctx)
+	j, err := openJournal(cfg)
+	if err != nil {
+		return err
+	}
+	go func() {
+		err := j.Run(ctx, s)
+		if err != nil {
+			log.Error("journal: %v", err)
+		}
+	}()
+	links, err := symlink.New(symlink.Layout{
+		Root:  cfg.Symlinks.Root,
+		Links: cfg.Symlinks.Links,
+	}, filepath.Join(cfg.StateDir, "symlinks.json"))
+	if err != nil {
+		return err
+	}
 	log.Info("removing all symlinks managed by this application")
-	err = udev.ClearSymlinks()
+	removed, err := links.Reconcile()
 	if err != nil {
 		return err
 	}
+	for _, v := range removed {
+		log.Info("unlink: %s", v)
+	}
 	log.Info("OK")
 
-	m := udev.New(ql, s)
-	m.Startup(ctx)
-	go m.Run(ctx)
+	m := udev.New(ql, s, links)
+	m.Known = rules.NewStore(knownPath(cfg))
+	m.Settle = cxt.Duration("settle")
+	m.PollInterval = cxt.Duration("poll")
+	m.Ports = cfg.Ports
+	m.Devices = cfg.Devices
+	if cfg.Labels != nil {
+		m.Labels = cfg.Labels
+	}
+	// The devices present at startup are probed while the API is already
+	// served, /readyz tells when it is done. The monitor only stops on its
+	// own on failure, which ends the process so that it is restarted.
+	monitorErr := make(chan error, 1)
+	go func() {
+		m.Startup(ctx)
+		monitorErr <- m.Run(ctx)
+	}()
+	go m.Poll(ctx)
+
+	hooks, err := webhook.New(endpoints(cfg), filepath.Join(cfg.StateDir, "webhooks.json"))
+	if err != nil {
+		return err
+	}
+	go func() {
+		err := hooks.Run(ctx, s)
+		if err != nil {
+			log.Error("webhook: %v", err)
+		}
+	}()
+
+	if cfg.MQTT != nil {
+		clientID := cfg.MQTT.ClientID
+		if clientID == "" {
+			host, _ := os.Hostname()
+			clientID = "fdevices-" + host
+		}
+		p := mqtt.New(mqtt.NewClient(mqtt.Options{
+			Broker:   cfg.MQTT.Broker,
+			ClientID: clientID,
+			Username: cfg.MQTT.Username,
+			Password: cfg.MQTT.Password,
+		}), ql)
+		if cfg.MQTT.Prefix != "" {
+			p.Prefix = cfg.MQTT.Prefix
+		}
+		if cfg.MQTT.Commands {
+			p.Controller = m
+		}
+		go func() {
+			err := p.Run(ctx, s)
+			if err != nil {
+				log.Error("mqtt: %v", err)
+			}
+		}()
+	}
 
-	w := web.New(ql, s)
-	port := cxt.Int("port")
-	log.Info("listening on port :%d", port)
+	opts := web.Options{DeviceOf: m.Device, Origins: cfg.API.Origins}
+	if cfg.API.Commands {
+		opts.Commands = m
+	}
+	switch {
+	case cfg.Auth.Enabled:
+		opts.Auth = authenticator(cfg)
+	case cfg.API.Commands:
+		log.Info("authentication is disabled, every client can read the API and run commands")
+	default:
+		log.Info("authentication is disabled, every client can read the API")
+	}
+	w := web.New(ql, s, opts)
+	w.Get("/api/events/history", web.GetHistory(j.Dir()))
+	w.Get("/api/v1/webhooks/deliveries", hooks.ServeHTTP)
+	w.Get("/readyz", web.GetReady(map[string]web.Check{
+		"startup": m.Started,
+		"udev":    m.Monitoring,
+	}))
+	listeners, err := apiListeners(cfg, cxt.Int("port"))
+	if err != nil {
+		return err
+	}
+	srvErr := make(chan error, len(listeners)+1)
+	if cfg.GRPC != nil {
+		var serverOpts []grpc.ServerOption
+		if cfg.TLS != nil {
+			creds, err := credentials.NewServerTLSFromFile(cfg.TLS.Cert, cfg.TLS.Key)
+			if err != nil {
+				return err
+			}
+			serverOpts = append(serverOpts, grpc.Creds(creds))
+		}
+		l, err := net.Listen("tcp", cfg.GRPC.Addr)
+		if err != nil {
+			return err
+		}
+		log.Info("serving the gRPC API on %s", cfg.GRPC.Addr)
+		g := web.GRPC(ql, s, opts, serverOpts...)
+		go func() {
+			srvErr <- g.Serve(l)
+		}()
+	}
 	log.Info("sending systeemd notify ready signal")
 	err = sdnotify.SdNotifyReady()
 	if err != nil {
@@ -73,5 +344,307 @@ func Server(cxt *cli.Context) error {
 	} else {
 		log.Info("OK")
 	}
-	return http.ListenAndServe(fmt.Sprintf(":%d", port), w)
+	srv := &http.Server{Handler: w}
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			// Unix sockets are only reachable locally and are served
+			// without TLS
+			if cfg.TLS != nil && l.Addr().Network() == "tcp" {
+				srvErr <- srv.ServeTLS(l, cfg.TLS.Cert, cfg.TLS.Key)
+				return
+			}
+			srvErr <- srv.Serve(l)
+		}(l)
+	}
+	select {
+	case err = <-srvErr:
+		return err
+	case err = <-monitorErr:
+		if err == nil {
+			err = errors.New("udev monitor stopped")
+		}
+		log.Error("udev: %v", err)
+		return err
+	}
+}
+
+// apiListeners returns the sockets the HTTP API is served on. The sockets
+// passed by systemd socket activation are used when there are some,
+// otherwise the TCP port and the Unix socket of the configuration.
+func apiListeners(cfg *config.Config, port int) ([]net.Listener, error) {
+	ls, err := socket.Systemd()
+	if err != nil {
+		return nil, err
+	}
+	if len(ls) > 0 {
+		for _, l := range ls {
+			log.Info("listening on %s passed by systemd", l.Addr())
+		}
+		return ls, nil
+	}
+	if !cfg.API.DisableTCP {
+		l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+		if err != nil {
+			return nil, err
+		}
+		log.Info("listening on port :%d", port)
+		ls = append(ls, l)
+	}
+	if u := cfg.API.Unix; u != nil {
+		mode := socket.DefaultMode
+		if u.Mode != "" {
+			// checked by config.Load
+			m, _ := strconv.ParseUint(u.Mode, 8, 32)
+			mode = os.FileMode(m)
+		}
+		l, err := socket.Unix(u.Path, mode, u.Group)
+		if err != nil {
+			for _, v := range ls {
+				v.Close()
+			}
+			return nil, err
+		}
+		log.Info("listening on %s", u.Path)
+		ls = append(ls, l)
+	}
+	if len(ls) == 0 {
+		return nil, errors.New("the API is not served anywhere, api.disable_tcp is set without api.unix")
+	}
+	return ls, nil
+}
+
+func tokenStore(cfg *config.Config) *auth.Store {
+	return auth.NewStore(filepath.Join(cfg.StateDir, "tokens.json"))
+}
+
+// authenticator returns the authenticator of the HTTP API.
+func authenticator(cfg *config.Config) *auth.Authenticator {
+	a := &auth.Authenticator{
+		Tokens: tokenStore(cfg),
+		Users:  make(map[string]auth.User),
+	}
+	for name, u := range cfg.Auth.Users {
+		a.Users[name] = auth.User{PasswordBcrypt: u.PasswordBcrypt, Scopes: u.Scopes}
+	}
+	return a
+}
+
+// endpoints returns the webhook endpoints of the configuration.
+func endpoints(cfg *config.Config) []webhook.Endpoint {
+	var o []webhook.Endpoint
+	for _, h := range cfg.Webhooks {
+		e := webhook.Endpoint{URL: h.URL, Secret: h.Secret}
+		f := &events.Filter{
+			IMEI:   h.IMEI,
+			IMSI:   h.IMSI,
+			ICCID:  h.ICCID,
+			Labels: h.Labels,
+		}
+		for _, t := range h.Types {
+			f.Types = append(f.Types, schema.Type(t))
+		}
+		if len(f.Types) > 0 || len(f.IMEI) > 0 || len(f.IMSI) > 0 ||
+			len(f.ICCID) > 0 || len(f.Labels) > 0 {
+			e.Filter = f
+		}
+		o = append(o, e)
+	}
+	return o
+}
+
+func journalDir(cfg *config.Config) string {
+	return filepath.Join(cfg.StateDir, "journal")
+}
+
+func openJournal(cfg *config.Config) (*journal.Journal, error) {
+	j, err := journal.Open(journalDir(cfg))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Journal.MaxSize > 0 {
+		j.MaxSize = cfg.Journal.MaxSize
+	}
+	if cfg.Journal.MaxAge != "" {
+		// validated by config.Load
+		j.MaxAge, _ = time.ParseDuration(cfg.Journal.MaxAge)
+	}
+	if cfg.Journal.MaxSegments > 0 {
+		j.MaxSegments = cfg.Journal.MaxSegments
+	}
+	return j, nil
+}
+
+func knownPath(cfg *config.Config) string {
+	return filepath.Join(cfg.StateDir, "dongles.json")
+}
+
+// UdevRules writes udev rules for the dongles fdevices has seen.
+func UdevRules(cxt *cli.Context) error {
+	cfg, err := config.Load(cxt.String("config"))
+	if err != nil {
+		return err
+	}
+	links, err := symlink.New(symlink.Layout{
+		Root:  cfg.Symlinks.Root,
+		Links: cfg.Symlinks.Links,
+	}, "")
+	if err != nil {
+		return err
+	}
+	dongles, err := rules.NewStore(knownPath(cfg)).Dongles()
+	if err != nil {
+		return err
+	}
+	r := rules.Generate(dongles, links)
+	path := cxt.String("output")
+	old, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	diff := rules.Diff(old, r)
+	if cxt.Bool("dry-run") {
+		fmt.Print(diff)
+		return nil
+	}
+	if diff == "" {
+		fmt.Printf("%s is up to date\n", path)
+		return nil
+	}
+	err = rules.Install(path, r)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("installed %s\n", path)
+	if cxt.Bool("reload") {
+		return rules.Reload()
+	}
+	return nil
+}
+
+// Events prints the events kept in the journal.
+func Events(cxt *cli.Context) error {
+	cfg, err := config.Load(cxt.String("config"))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	q := journal.Query{Limit: cxt.Int("limit")}
+	if v := cxt.String("since"); v != "" {
+		q.Since, err = journal.ParseTime(v, now)
+		if err != nil {
+			return err
+		}
+	}
+	if v := cxt.String("until"); v != "" {
+		q.Until, err = journal.ParseTime(v, now)
+		if err != nil {
+			return err
+		}
+	}
+	f := &events.Filter{}
+	for _, t := range splitList(cxt.String("type")) {
+		f.Types = append(f.Types, schema.Type(t))
+	}
+	f.IMEI = splitList(cxt.String("imei"))
+	if len(f.Types) > 0 || len(f.IMEI) > 0 {
+		q.Filter = f
+	}
+	all, err := journal.Read(journalDir(cfg), q)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	for _, e := range all {
+		if cxt.Bool("json") {
+			err = enc.Encode(e)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Printf("%s  %-6d %-12s imei=%s imsi=%s path=%s\n",
+			e.Time.Local().Format(time.RFC3339), e.Seq, e.Type,
+			e.Device.IMEI, e.Device.IMSI, e.Device.Path)
+	}
+	return nil
+}
+
+// CreateToken creates an API token and prints its secret, which can not be
+// found again later.
+func CreateToken(cxt *cli.Context) error {
+	cfg, err := config.Load(cxt.Parent().String("config"))
+	if err != nil {
+		return err
+	}
+	name := cxt.Args().First()
+	if name == "" {
+		return fmt.Errorf("tokens create: missing name")
+	}
+	t, secret, err := tokenStore(cfg).Create(name, splitList(cxt.String("scope")))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created token %s for %s with scopes %s\n", t.ID, t.Name, strings.Join(t.Scopes, ","))
+	fmt.Println(secret)
+	return nil
+}
+
+// ListTokens prints the API tokens.
+func ListTokens(cxt *cli.Context) error {
+	cfg, err := config.Load(cxt.Parent().String("config"))
+	if err != nil {
+		return err
+	}
+	all, err := tokenStore(cfg).List()
+	if err != nil {
+		return err
+	}
+	for _, t := range all {
+		fmt.Printf("%s  %s  %-20s %s\n", t.ID, t.CreatedOn.Local().Format(time.RFC3339),
+			t.Name, strings.Join(t.Scopes, ","))
+	}
+	return nil
+}
+
+// RevokeToken removes an API token, a running server stops accepting it
+// right away.
+func RevokeToken(cxt *cli.Context) error {
+	cfg, err := config.Load(cxt.Parent().String("config"))
+	if err != nil {
+		return err
+	}
+	id := cxt.Args().First()
+	if id == "" {
+		return fmt.Errorf("tokens revoke: missing id")
+	}
+	return tokenStore(cfg).Revoke(id)
+}
+
+// HashPassword prints the bcrypt hash of the first line of stdin, for the
+// password_bcrypt of a user.
+func HashPassword(cxt *cli.Context) error {
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return fmt.Errorf("hash-password: empty password")
+	}
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	fmt.Println(hash)
+	return nil
+}
+
+func splitList(s string) []string {
+	var o []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			o = append(o, v)
+		}
+	}
+	return o
 }
@@ -0,0 +1,369 @@
+// Package metrics keeps counters, gauges and histograms and writes them in
+// the Prometheus text format.
+//
+// Metrics are declared once as package variables of the code they measure
+//
+//	var udevEvents = metrics.NewCounter("fdevices_udev_events_total",
+//		"udev events received for USB serial devices.", "action")
+//
+//	udevEvents.Add(1, "add")
+//
+// and are written along with the families computed when scraping, like the
+// dongles in the database, by Write. Tests declare their metrics in a
+// registry of their own, so they can run more than once.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Types of metric families.
+const (
+	Counter   = "counter"
+	Gauge     = "gauge"
+	Histogram = "histogram"
+)
+
+// Label is the name and value of a label of a sample.
+type Label struct {
+	Name, Value string
+}
+
+// Sample is a single value of a family. Suffix is appended to the name of the
+// family, histograms use it for _bucket, _sum and _count.
+type Sample struct {
+	Suffix string
+	Labels []Label
+	Value  float64
+}
+
+// Family is a metric with all its samples.
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+// collector returns the families of a metric.
+type collector interface {
+	collect() *Family
+}
+
+// Registry holds declared metrics.
+type Registry struct {
+	mu         sync.Mutex
+	registered map[string]collector
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{registered: make(map[string]collector)}
+}
+
+// Default is the registry of the metrics declared with the package functions.
+var Default = NewRegistry()
+
+func (r *Registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.registered[name]; ok {
+		panic("metrics: " + name + " is declared twice")
+	}
+	r.registered[name] = c
+}
+
+// Collect returns the families of every metric declared in r, ordered by
+// name.
+func (r *Registry) Collect() []*Family {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.registered))
+	for name := range r.registered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	cs := make([]collector, len(names))
+	for i, name := range names {
+		cs[i] = r.registered[name]
+	}
+	r.mu.Unlock()
+	o := make([]*Family, len(cs))
+	for i, c := range cs {
+		o[i] = c.collect()
+	}
+	return o
+}
+
+// Collect returns the families of every metric declared in Default.
+func Collect() []*Family {
+	return Default.Collect()
+}
+
+// vec holds the values of a metric by label values.
+type vec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]*value
+}
+
+type value struct {
+	labels []string
+	v      float64
+
+	// histograms only
+	counts []uint64
+	count  uint64
+}
+
+// newVec returns the values of a metric. A metric without labels starts at
+// zero, so it is reported before anything is recorded.
+func newVec(name, help string, labels []string) *vec {
+	v := &vec{name: name, help: help, labels: labels, values: make(map[string]*value)}
+	if len(labels) == 0 {
+		v.get(nil)
+	}
+	return v
+}
+
+// get returns the value for the label values lv, it must be called with the
+// lock held.
+func (v *vec) get(lv []string) *value {
+	if len(lv) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", v.name, len(v.labels), len(lv)))
+	}
+	key := strings.Join(lv, "\xff")
+	x, ok := v.values[key]
+	if !ok {
+		x = &value{labels: append([]string(nil), lv...)}
+		v.values[key] = x
+	}
+	return x
+}
+
+// Delete forgets the value for the label values lv, for things which went
+// away like an unplugged dongle.
+func (v *vec) Delete(lv ...string) {
+	v.mu.Lock()
+	delete(v.values, strings.Join(lv, "\xff"))
+	v.mu.Unlock()
+}
+
+func (v *vec) sampleLabels(x *value) []Label {
+	o := make([]Label, len(v.labels))
+	for i, name := range v.labels {
+		o[i] = Label{Name: name, Value: x.labels[i]}
+	}
+	return o
+}
+
+// sorted returns the values ordered by label values, it must be called with
+// the lock held.
+func (v *vec) sorted() []*value {
+	keys := make([]string, 0, len(v.values))
+	for k := range v.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	o := make([]*value, len(keys))
+	for i, k := range keys {
+		o[i] = v.values[k]
+	}
+	return o
+}
+
+func (v *vec) collectValues(typ string) *Family {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	f := &Family{Name: v.name, Help: v.help, Type: typ}
+	for _, x := range v.sorted() {
+		f.Samples = append(f.Samples, Sample{Labels: v.sampleLabels(x), Value: x.v})
+	}
+	return f
+}
+
+// CounterVec is a value which only goes up.
+type CounterVec struct {
+	*vec
+}
+
+// NewCounter declares a counter with the given label names in Default.
+func NewCounter(name, help string, labels ...string) *CounterVec {
+	return Default.NewCounter(name, help, labels...)
+}
+
+// NewCounter declares a counter with the given label names.
+func (r *Registry) NewCounter(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newVec(name, help, labels)}
+	r.register(name, c)
+	return c
+}
+
+// Add adds n to the counter with the label values lv.
+func (c *CounterVec) Add(n float64, lv ...string) {
+	c.mu.Lock()
+	c.get(lv).v += n
+	c.mu.Unlock()
+}
+
+func (c *CounterVec) collect() *Family {
+	return c.collectValues(Counter)
+}
+
+// GaugeVec is a value which goes up and down.
+type GaugeVec struct {
+	*vec
+}
+
+// NewGauge declares a gauge with the given label names in Default.
+func NewGauge(name, help string, labels ...string) *GaugeVec {
+	return Default.NewGauge(name, help, labels...)
+}
+
+// NewGauge declares a gauge with the given label names.
+func (r *Registry) NewGauge(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{newVec(name, help, labels)}
+	r.register(name, g)
+	return g
+}
+
+// Set sets the gauge with the label values lv to n.
+func (g *GaugeVec) Set(n float64, lv ...string) {
+	g.mu.Lock()
+	g.get(lv).v = n
+	g.mu.Unlock()
+}
+
+// Add adds n, which can be negative, to the gauge with the label values lv.
+func (g *GaugeVec) Add(n float64, lv ...string) {
+	g.mu.Lock()
+	g.get(lv).v += n
+	g.mu.Unlock()
+}
+
+func (g *GaugeVec) collect() *Family {
+	return g.collectValues(Gauge)
+}
+
+// HistogramVec counts observations in buckets.
+type HistogramVec struct {
+	*vec
+	buckets []float64
+}
+
+// DurationBuckets suit durations in seconds from 10ms to a minute.
+var DurationBuckets = []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// NewHistogram declares a histogram in Default, see Registry.NewHistogram.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return Default.NewHistogram(name, help, buckets, labels...)
+}
+
+// NewHistogram declares a histogram with the upper bounds buckets, in
+// increasing order, and the given label names.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{newVec(name, help, labels), buckets}
+	r.register(name, h)
+	return h
+}
+
+// Observe adds the observation n to the histogram with the label values lv.
+func (h *HistogramVec) Observe(n float64, lv ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	x := h.get(lv)
+	if x.counts == nil {
+		x.counts = make([]uint64, len(h.buckets))
+	}
+	for i, b := range h.buckets {
+		if n <= b {
+			x.counts[i]++
+		}
+	}
+	x.count++
+	x.v += n
+}
+
+func (h *HistogramVec) collect() *Family {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f := &Family{Name: h.name, Help: h.help, Type: Histogram}
+	for _, x := range h.sorted() {
+		labels := h.sampleLabels(x)
+		for i, b := range h.buckets {
+			var n uint64
+			if x.counts != nil {
+				n = x.counts[i]
+			}
+			le := append(labels[:len(labels):len(labels)], Label{"le", formatFloat(b)})
+			f.Samples = append(f.Samples, Sample{Suffix: "_bucket", Labels: le, Value: float64(n)})
+		}
+		inf := append(labels[:len(labels):len(labels)], Label{"le", "+Inf"})
+		f.Samples = append(f.Samples,
+			Sample{Suffix: "_bucket", Labels: inf, Value: float64(x.count)},
+			Sample{Suffix: "_sum", Labels: labels, Value: x.v},
+			Sample{Suffix: "_count", Labels: labels, Value: float64(x.count)},
+		)
+	}
+	return f
+}
+
+// ContentType is the content type of the text format written by Write.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Write writes the families in the Prometheus text format.
+func Write(w io.Writer, families []*Family) error {
+	b := bufio.NewWriter(w)
+	for _, f := range families {
+		fmt.Fprintf(b, "# HELP %s %s\n", f.Name, escape(f.Help, false))
+		fmt.Fprintf(b, "# TYPE %s %s\n", f.Name, f.Type)
+		for _, s := range f.Samples {
+			b.WriteString(f.Name)
+			b.WriteString(s.Suffix)
+			if len(s.Labels) > 0 {
+				b.WriteByte('{')
+				for i, l := range s.Labels {
+					if i > 0 {
+						b.WriteByte(',')
+					}
+					fmt.Fprintf(b, "%s=\"%s\"", l.Name, escape(l.Value, true))
+				}
+				b.WriteByte('}')
+			}
+			b.WriteByte(' ')
+			b.WriteString(formatFloat(s.Value))
+			b.WriteByte('\n')
+		}
+	}
+	return b.Flush()
+}
+
+func escape(s string, quote bool) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	if quote {
+		s = strings.Replace(s, `"`, `\"`, -1)
+	}
+	return s
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("test_events_total", "Events.", "type")
+	g := r.NewGauge("test_signal", "Signal \"quality\".", "imei")
+	h := r.NewHistogram("test_duration_seconds", "Durations.", []float64{.1, 1})
+	c.Add(1, "add")
+	c.Add(2, "add")
+	c.Add(1, `re"move`)
+	g.Set(20, "123")
+	g.Set(10, "124")
+	g.Delete("124")
+	h.Observe(.05)
+	h.Observe(.5)
+	h.Observe(5)
+
+	var buf bytes.Buffer
+	err := Write(&buf, r.Collect())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := `# HELP test_duration_seconds Durations.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{le="0.1"} 1
+test_duration_seconds_bucket{le="1"} 2
+test_duration_seconds_bucket{le="+Inf"} 3
+test_duration_seconds_sum 5.55
+test_duration_seconds_count 3
+# HELP test_events_total Events.
+# TYPE test_events_total counter
+test_events_total{type="add"} 3
+test_events_total{type="re\"move"} 1
+# HELP test_signal Signal "quality".
+# TYPE test_signal gauge
+test_signal{imei="123"} 20
+`
+	if buf.String() != e {
+		t.Errorf("expected\n%s\ngot\n%s", e, buf.String())
+	}
+	if len(r.Collect()) != 3 || len(NewRegistry().Collect()) != 0 {
+		t.Errorf("expected the 3 declared metrics got %d", len(r.Collect()))
+	}
+}
@@ -0,0 +1,297 @@
+// Package mqtt publishes the state of the dongles and their events to an MQTT
+// broker.
+//
+// With the default prefix fdevices/<hostname> the topics are
+//
+//	fdevices/<host>/status                          online or offline, retained
+//	fdevices/<host>/dongles/<imei>/state            the dongle, retained
+//	fdevices/<host>/events/<type>                   every event
+//	fdevices/<host>/dongles/<imei>/cmd/<name>       commands, when enabled
+//	fdevices/<host>/dongles/<imei>/cmd/<name>/result
+//
+// The payload of a command is a schema.Command, and its outcome is published
+// as a schema.Result.
+//
+// The broker publishes offline on the status topic when the connection is
+// lost, and the retained state of a dongle is cleared when it is removed.
+// Retained commands are ignored, they would run again on every connection.
+package mqtt
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FarmRadioHangar/fdevices/control"
+	"github.com/FarmRadioHangar/fdevices/db"
+	"github.com/FarmRadioHangar/fdevices/events"
+	"github.com/FarmRadioHangar/fdevices/log"
+	"github.com/FarmRadioHangar/fdevices/schema"
+)
+
+// Payloads of the status topic.
+const (
+	Online  = "online"
+	Offline = "offline"
+)
+
+// CommandTimeout is how long a command is given to complete.
+const CommandTimeout = time.Minute
+
+// Defaults for the retries of the first connection.
+const (
+	DefaultMinBackoff = time.Second
+	DefaultMaxBackoff = time.Minute
+)
+
+// Message is a message published to or received from the broker.
+type Message struct {
+	Topic    string
+	Payload  []byte
+	QoS      byte
+	Retained bool
+}
+
+// Client is a connection to a broker.
+type Client interface {
+	// Connect connects to the broker. The broker publishes will when the
+	// connection is lost. onConnect is called after every connection,
+	// including reconnections.
+	Connect(will Message, onConnect func()) error
+
+	Publish(m Message) error
+
+	// Subscribe calls h with the messages published to topic, which can
+	// contain wildcards.
+	Subscribe(topic string, h func(Message)) error
+
+	Disconnect()
+}
+
+// DefaultPrefix returns fdevices/<hostname>.
+func DefaultPrefix() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "localhost"
+	}
+	return "fdevices/" + host
+}
+
+// Publisher publishes the dongles and events of a stream.
+type Publisher struct {
+	// Prefix is prepended to every topic.
+	Prefix string
+
+	// Controller runs the commands received from the broker. No commands are
+	// accepted when it is nil.
+	Controller control.Controller
+
+	// MinBackoff is the wait after the first failed connection, it doubles
+	// with every attempt up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	client Client
+	db     *sql.DB
+	ctx    context.Context
+
+	// retained are the IMEIs of the dongles with a retained state.
+	mu       sync.Mutex
+	retained map[string]bool
+}
+
+// New returns a Publisher which publishes with c the dongles found in ql.
+func New(c Client, ql *sql.DB) *Publisher {
+	return &Publisher{
+		Prefix:     DefaultPrefix(),
+		MinBackoff: DefaultMinBackoff,
+		MaxBackoff: DefaultMaxBackoff,
+		client:     c,
+		db:         ql,
+		retained:   make(map[string]bool),
+	}
+}
+
+func (p *Publisher) topic(parts ...string) string {
+	return p.Prefix + "/" + strings.Join(parts, "/")
+}
+
+// Run connects to the broker and publishes the events of s until ctx is done.
+// The connection is retried until it succeeds, the client restores it once it
+// is made.
+func (p *Publisher) Run(ctx context.Context, s *events.Stream) error {
+	p.ctx = ctx
+	sub, err := s.Subscribe(events.Options{Policy: events.DropOldest})
+	if err != nil {
+		return err
+	}
+	defer s.Unsubscribe(sub.ID)
+	will := Message{Topic: p.topic("status"), Payload: []byte(Offline), QoS: 1, Retained: true}
+	wait := p.MinBackoff
+	for {
+		err = p.client.Connect(will, p.connected)
+		if err == nil {
+			break
+		}
+		log.Error("mqtt: %v, retrying in %v", err, wait)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+		// the state is published on connection, the events missed until
+		// then are not needed
+		for len(sub.C) > 0 {
+			<-sub.C
+		}
+		wait *= 2
+		if wait > p.MaxBackoff {
+			wait = p.MaxBackoff
+		}
+	}
+	defer func() {
+		_ = p.client.Publish(Message{Topic: will.Topic, Payload: []byte(Offline), QoS: 1, Retained: true})
+		p.client.Disconnect()
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e, ok := <-sub.C:
+			if !ok {
+				return nil
+			}
+			p.event(e)
+		}
+	}
+}
+
+// connected publishes the status and the state of every dongle, and
+// subscribes to the commands. The state of dongles which were removed while
+// the connection was down is cleared.
+func (p *Publisher) connected() {
+	p.publish(Message{Topic: p.topic("status"), Payload: []byte(Online), QoS: 1, Retained: true})
+	dongles, err := db.GetDistinct(p.db)
+	if err != nil {
+		log.Error("mqtt: %v", err)
+	}
+	present := make(map[string]bool)
+	for _, d := range dongles {
+		present[d.IMEI] = true
+		p.state(d.IMEI, d.Schema())
+	}
+	p.mu.Lock()
+	var gone []string
+	for imei := range p.retained {
+		if !present[imei] {
+			gone = append(gone, imei)
+		}
+	}
+	p.mu.Unlock()
+	for _, imei := range gone {
+		p.clear(imei)
+	}
+	if p.Controller == nil {
+		return
+	}
+	err = p.client.Subscribe(p.topic("dongles", "+", "cmd", "+"), p.command)
+	if err != nil {
+		log.Error("mqtt: %v", err)
+	}
+}
+
+func (p *Publisher) event(e *schema.Event) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		log.Error("mqtt: %v", err)
+		return
+	}
+	p.publish(Message{Topic: p.topic("events", string(e.Type)), Payload: b, QoS: 1})
+	if e.Device.IMEI == "" {
+		return
+	}
+	switch e.Type {
+	case schema.Add, schema.Update:
+		p.state(e.Device.IMEI, e.Data)
+	case schema.Remove:
+		p.clear(e.Device.IMEI)
+	}
+}
+
+func (p *Publisher) state(imei string, d interface{}) {
+	b, err := json.Marshal(d)
+	if err != nil {
+		log.Error("mqtt: %v", err)
+		return
+	}
+	err = p.publish(Message{Topic: p.topic("dongles", imei, "state"), Payload: b, QoS: 1, Retained: true})
+	if err == nil {
+		p.mu.Lock()
+		p.retained[imei] = true
+		p.mu.Unlock()
+	}
+}
+
+// clear clears the retained state of a dongle with an empty retained message.
+// It is cleared again on the next connection when this fails.
+func (p *Publisher) clear(imei string) {
+	err := p.publish(Message{Topic: p.topic("dongles", imei, "state"), QoS: 1, Retained: true})
+	if err == nil {
+		p.mu.Lock()
+		delete(p.retained, imei)
+		p.mu.Unlock()
+	}
+}
+
+func (p *Publisher) publish(m Message) error {
+	err := p.client.Publish(m)
+	if err != nil {
+		log.Error("mqtt: %s: %v", m.Topic, err)
+	}
+	return err
+}
+
+// command runs a command received on <prefix>/dongles/<imei>/cmd/<name>.
+// Retained commands are dropped.
+func (p *Publisher) command(m Message) {
+	if m.Retained {
+		log.Info("mqtt: ignoring the retained command on %s", m.Topic)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(m.Topic, p.Prefix+"/"), "/")
+	if len(parts) != 4 || parts[0] != "dongles" || parts[2] != "cmd" {
+		return
+	}
+	imei, name := parts[1], parts[3]
+	var cmd schema.Command
+	var res schema.Result
+	var err error
+	if len(m.Payload) > 0 {
+		err = json.Unmarshal(m.Payload, &cmd)
+	}
+	if err == nil {
+		res.ID = cmd.ID
+		res.Output, err = p.run(imei, name, &cmd)
+	}
+	if err != nil {
+		res.Error = err.Error()
+	} else {
+		res.OK = true
+	}
+	b, _ := json.Marshal(res)
+	p.publish(Message{Topic: m.Topic + "/result", Payload: b, QoS: 1})
+}
+
+func (p *Publisher) run(imei, name string, cmd *schema.Command) (string, error) {
+	ctx := p.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, CommandTimeout)
+	defer cancel()
+	return control.Run(ctx, p.Controller, imei, name, cmd)
+}
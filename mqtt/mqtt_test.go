@@ -0,0 +1,270 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/FarmRadioHangar/fdevices/db"
+	"github.com/FarmRadioHangar/fdevices/db/dbtest"
+	"github.com/FarmRadioHangar/fdevices/events"
+	"github.com/FarmRadioHangar/fdevices/schema"
+)
+
+// testDongles are the dongles of the test database.
+var testDongles = []*db.Dongle{{IMEI: "123", IMSI: "456", Path: "/dev/ttyUSB0"}}
+
+// fakeClient is an in-process broker with a single client.
+type fakeClient struct {
+	mu        sync.Mutex
+	fail      int
+	attempts  int
+	will      Message
+	published []Message
+	retained  map[string][]byte
+	subs      map[string]func(Message)
+	connected chan struct{}
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{
+		retained:  make(map[string][]byte),
+		subs:      make(map[string]func(Message)),
+		connected: make(chan struct{}),
+	}
+}
+
+// Connect refuses the first c.fail connections.
+func (c *fakeClient) Connect(will Message, onConnect func()) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.attempts++
+	if c.attempts <= c.fail {
+		return errors.New("connection refused")
+	}
+	c.will = will
+	go func() {
+		onConnect()
+		close(c.connected)
+	}()
+	return nil
+}
+
+func (c *fakeClient) Publish(m Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.published = append(c.published, m)
+	if m.Retained {
+		if len(m.Payload) == 0 {
+			delete(c.retained, m.Topic)
+		} else {
+			c.retained[m.Topic] = m.Payload
+		}
+	}
+	return nil
+}
+
+func (c *fakeClient) Subscribe(topic string, h func(Message)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subs[topic] = h
+	return nil
+}
+
+func (c *fakeClient) Disconnect() {}
+
+// send delivers m to the matching subscriptions.
+func (c *fakeClient) send(m Message) {
+	c.mu.Lock()
+	var hs []func(Message)
+	for topic, h := range c.subs {
+		if match(topic, m.Topic) {
+			hs = append(hs, h)
+		}
+	}
+	c.mu.Unlock()
+	for _, h := range hs {
+		h(m)
+	}
+}
+
+func (c *fakeClient) find(topic string) (Message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := len(c.published) - 1; i >= 0; i-- {
+		if c.published[i].Topic == topic {
+			return c.published[i], true
+		}
+	}
+	return Message{}, false
+}
+
+func (c *fakeClient) wait(t *testing.T, topic string) Message {
+	for i := 0; i < 100; i++ {
+		if m, ok := c.find(topic); ok {
+			return m
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("nothing published on %s", topic)
+	return Message{}
+}
+
+// match returns true when topic matches the filter, which can contain +.
+func match(filter, topic string) bool {
+	f := strings.Split(filter, "/")
+	p := strings.Split(topic, "/")
+	if len(f) != len(p) {
+		return false
+	}
+	for i := range f {
+		if f[i] != "+" && f[i] != p[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type fakeController struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (c *fakeController) record(s string) {
+	c.mu.Lock()
+	c.calls = append(c.calls, s)
+	c.mu.Unlock()
+}
+
+func (c *fakeController) SendSMS(ctx context.Context, imei, number, text string) error {
+	c.record("sms " + imei + " " + number + " " + text)
+	return nil
+}
+
+func (c *fakeController) RunAT(ctx context.Context, imei, cmd string) (string, error) {
+	c.record("at " + imei + " " + cmd)
+	return "OK", nil
+}
+
+func (c *fakeController) Reset(ctx context.Context, imei string) error {
+	c.record("reset " + imei)
+	return nil
+}
+
+func TestPublisher(t *testing.T) {
+	ql := dbtest.DB(t, testDongles, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := events.NewStream(10)
+	s.Start(ctx)
+	c := newFakeClient()
+	ctl := &fakeController{}
+	p := New(c, ql)
+	p.Prefix = "fdevices/pi"
+	p.Controller = ctl
+	go p.Run(ctx, s)
+	<-c.connected
+
+	if c.will.Topic != "fdevices/pi/status" || string(c.will.Payload) != Offline || !c.will.Retained {
+		t.Errorf("unexpected will %+v", c.will)
+	}
+	if m := c.wait(t, "fdevices/pi/status"); string(m.Payload) != Online {
+		t.Errorf("expected %s got %s", Online, m.Payload)
+	}
+	m := c.wait(t, "fdevices/pi/dongles/123/state")
+	var d schema.Dongle
+	_ = json.Unmarshal(m.Payload, &d)
+	if !m.Retained || d.IMSI != "456" {
+		t.Errorf("unexpected state %+v", m)
+	}
+
+	for len(s.Stats()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	s.Send(events.New(schema.Remove, schema.Device{IMEI: "123"}, &schema.Dongle{IMEI: "123"}))
+	m = c.wait(t, "fdevices/pi/events/remove")
+	e, err := schema.Decode(m.Payload)
+	if err != nil || e.Type != schema.Remove {
+		t.Errorf("unexpected event %s", m.Payload)
+	}
+	cleared := false
+	for i := 0; i < 100 && !cleared; i++ {
+		time.Sleep(10 * time.Millisecond)
+		c.mu.Lock()
+		_, ok := c.retained["fdevices/pi/dongles/123/state"]
+		c.mu.Unlock()
+		cleared = !ok
+	}
+	if !cleared {
+		t.Error("expected the retained state to be cleared")
+	}
+
+	c.send(Message{Topic: "fdevices/pi/dongles/123/cmd/reset", Retained: true})
+	c.send(Message{Topic: "fdevices/pi/dongles/123/cmd/sms", Payload: []byte(`{"id":"1","number":"+255","text":"hi"}`)})
+	c.send(Message{Topic: "fdevices/pi/dongles/123/cmd/reboot"})
+	m = c.wait(t, "fdevices/pi/dongles/123/cmd/sms/result")
+	var res schema.Result
+	_ = json.Unmarshal(m.Payload, &res)
+	if !res.OK || res.ID != "1" {
+		t.Errorf("unexpected result %s", m.Payload)
+	}
+	m = c.wait(t, "fdevices/pi/dongles/123/cmd/reboot/result")
+	res = schema.Result{}
+	_ = json.Unmarshal(m.Payload, &res)
+	if res.OK || res.Error == "" {
+		t.Errorf("expected an error got %s", m.Payload)
+	}
+	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+	if len(ctl.calls) != 1 || ctl.calls[0] != "sms 123 +255 hi" {
+		t.Errorf("unexpected calls %v", ctl.calls)
+	}
+}
+
+func TestConnectRetry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := events.NewStream(10)
+	s.Start(ctx)
+	c := newFakeClient()
+	c.fail = 2
+	p := New(c, dbtest.DB(t, testDongles, nil))
+	p.Prefix = "fdevices/pi"
+	p.MinBackoff = time.Millisecond
+	go p.Run(ctx, s)
+	select {
+	case <-c.connected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a connection")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.attempts != 3 {
+		t.Errorf("expected 3 attempts got %d", c.attempts)
+	}
+}
+
+func TestClearOnConnect(t *testing.T) {
+	c := newFakeClient()
+	p := New(c, dbtest.DB(t, testDongles, nil))
+	p.Prefix = "fdevices/pi"
+	// removed while the connection was down
+	c.retained["fdevices/pi/dongles/999/state"] = []byte("{}")
+	p.retained["999"] = true
+	p.connected()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.retained["fdevices/pi/dongles/999/state"]; ok {
+		t.Error("expected the state of 999 to be cleared")
+	}
+	if _, ok := c.retained["fdevices/pi/dongles/123/state"]; !ok {
+		t.Error("expected the state of 123 to be published")
+	}
+	if p.retained["999"] || !p.retained["123"] {
+		t.Errorf("unexpected retained dongles %v", p.retained)
+	}
+}
@@ -0,0 +1,68 @@
+package mqtt
+
+import (
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Options configure the connection to a broker.
+type Options struct {
+	// Broker is the address of the broker, like tcp://localhost:1883.
+	Broker   string
+	ClientID string
+	Username string
+	Password string
+}
+
+type pahoClient struct {
+	opts   *paho.ClientOptions
+	client paho.Client
+}
+
+// NewClient returns a Client connecting to the broker with the paho client.
+// The connection is restored when it is lost.
+func NewClient(o Options) Client {
+	opts := paho.NewClientOptions()
+	opts.AddBroker(o.Broker)
+	opts.SetClientID(o.ClientID)
+	opts.SetUsername(o.Username)
+	opts.SetPassword(o.Password)
+	opts.SetAutoReconnect(true)
+	opts.SetMaxReconnectInterval(time.Minute)
+	return &pahoClient{opts: opts}
+}
+
+func (c *pahoClient) Connect(will Message, onConnect func()) error {
+	c.opts.SetBinaryWill(will.Topic, will.Payload, will.QoS, will.Retained)
+	c.opts.SetOnConnectHandler(func(paho.Client) {
+		// Handlers must not block the client, and onConnect publishes.
+		go onConnect()
+	})
+	c.client = paho.NewClient(c.opts)
+	return wait(c.client.Connect())
+}
+
+func (c *pahoClient) Publish(m Message) error {
+	return wait(c.client.Publish(m.Topic, m.QoS, m.Retained, m.Payload))
+}
+
+func (c *pahoClient) Subscribe(topic string, h func(Message)) error {
+	return wait(c.client.Subscribe(topic, 1, func(_ paho.Client, m paho.Message) {
+		go h(Message{
+			Topic:    m.Topic(),
+			Payload:  m.Payload(),
+			QoS:      m.Qos(),
+			Retained: m.Retained(),
+		})
+	}))
+}
+
+func (c *pahoClient) Disconnect() {
+	c.client.Disconnect(250)
+}
+
+func wait(t paho.Token) error {
+	t.Wait()
+	return t.Error()
+}
@@ -0,0 +1,186 @@
+// Package rules writes persistent udev rules for the dongles fdevices has seen.
+//
+// The rules create the same symlinks fdevices creates, so they exist early in
+// boot before fdevices is started.
+package rules
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/FarmRadioHangar/fdevices/symlink"
+)
+
+// DefaultPath is where the rules file is installed.
+const DefaultPath = "/etc/udev/rules.d/99-fdevices.rules"
+
+// devDir is the directory udev SYMLINK names are relative to.
+const devDir = "/dev"
+
+const header = `# This file is generated by fdevices udev-rules, do not edit.
+#
+# Only symlinks which are bound to the dongle itself are created here, symlinks
+# for the SIM card or the USB port are left to fdevices.
+`
+
+// Generate returns the rules file for dongles. The symlink names are rendered
+// from the layout of links. Dongles which can not be matched reliably, because
+// udev does not know their serial number, are listed as comments.
+func Generate(dongles []Dongle, links *symlink.Manager) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	for _, d := range dongles {
+		fmt.Fprintf(&buf, "\n# dongle imei %s\n", d.IMEI)
+		if !valid(d.Serial) {
+			buf.WriteString("# skipped, no usable ID_SERIAL_SHORT\n")
+			continue
+		}
+		var names []string
+		for _, n := range links.Names(symlink.Info{IMEI: d.IMEI}) {
+			rel, err := filepath.Rel(devDir, n)
+			if err != nil || strings.HasPrefix(rel, "..") || !valid(rel) {
+				continue
+			}
+			names = append(names, rel)
+		}
+		if len(names) == 0 {
+			buf.WriteString("# skipped, no symlinks below /dev\n")
+			continue
+		}
+		var roles []string
+		for r := range d.Roles {
+			roles = append(roles, r)
+		}
+		sort.Strings(roles)
+		for _, role := range roles {
+			iface := d.Roles[role]
+			if !valid(iface) {
+				continue
+			}
+			match := []string{
+				`SUBSYSTEM=="tty"`,
+				fmt.Sprintf(`ENV{ID_SERIAL_SHORT}=="%s"`, d.Serial),
+				fmt.Sprintf(`ENV{ID_USB_INTERFACE_NUM}=="%s"`, iface),
+			}
+			if valid(d.Vendor) && valid(d.Model) {
+				match = append(match,
+					fmt.Sprintf(`ENV{ID_VENDOR_ID}=="%s"`, d.Vendor),
+					fmt.Sprintf(`ENV{ID_MODEL_ID}=="%s"`, d.Model),
+				)
+			}
+			for _, n := range names {
+				if role != "control" {
+					n += "." + role
+				}
+				match = append(match, fmt.Sprintf(`SYMLINK+="%s"`, n))
+			}
+			fmt.Fprintf(&buf, "# %s\n%s\n", role, strings.Join(match, ", "))
+		}
+	}
+	return buf.Bytes()
+}
+
+// valid returns true when v can be safely used inside a rule.
+func valid(v string) bool {
+	return v != "" && !strings.ContainsAny(v, "\"\\\n\r")
+}
+
+// Install writes the rules to path. The file is replaced atomically, so udev
+// never sees a partially written rules file.
+func Install(path string, rules []byte) error {
+	return writeFile(path, rules, 0644)
+}
+
+// Reload asks udev to reload its rules.
+func Reload() error {
+	o, err := exec.Command("udevadm", "control", "--reload").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("udevadm: %v: %s", err, bytes.TrimSpace(o))
+	}
+	return nil
+}
+
+func writeFile(path string, b []byte, mode os.FileMode) error {
+	dir := filepath.Dir(path)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = tmp.Chmod(mode)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Diff returns a line diff turning a into b, in the style of diff -u without
+// hunk headers. An empty string is returned when a and b are the same.
+func Diff(a, b []byte) string {
+	if bytes.Equal(a, b) {
+		return ""
+	}
+	x := splitLines(a)
+	y := splitLines(b)
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var buf bytes.Buffer
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			fmt.Fprintf(&buf, " %s\n", x[i])
+			i++
+			j++
+		case j < len(y) && (i == len(x) || lcs[i][j+1] >= lcs[i+1][j]):
+			fmt.Fprintf(&buf, "+%s\n", y[j])
+			j++
+		default:
+			fmt.Fprintf(&buf, "-%s\n", x[i])
+			i++
+		}
+	}
+	return buf.String()
+}
+
+func splitLines(b []byte) []string {
+	s := strings.TrimSuffix(string(b), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,96 @@
+package rules
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/FarmRadioHangar/fdevices/symlink"
+)
+
+func TestGenerate(t *testing.T) {
+	links, err := symlink.New(symlink.Layout{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dongles := []Dongle{
+		{
+			IMEI:   "123",
+			Serial: "ABC",
+			Vendor: "12d1",
+			Model:  "1001",
+			Roles:  map[string]string{"control": "02", "if00": "00"},
+		},
+		{IMEI: "456", Roles: map[string]string{"control": "00"}},
+	}
+	r := string(Generate(dongles, links))
+	for _, expect := range []string{
+		`SUBSYSTEM=="tty", ENV{ID_SERIAL_SHORT}=="ABC", ENV{ID_USB_INTERFACE_NUM}=="02", ` +
+			`ENV{ID_VENDOR_ID}=="12d1", ENV{ID_MODEL_ID}=="1001", ` +
+			`SYMLINK+="123.imei", SYMLINK+="fdevices/by-imei/123"`,
+		`SUBSYSTEM=="tty", ENV{ID_SERIAL_SHORT}=="ABC", ENV{ID_USB_INTERFACE_NUM}=="00", ` +
+			`ENV{ID_VENDOR_ID}=="12d1", ENV{ID_MODEL_ID}=="1001", ` +
+			`SYMLINK+="123.imei.if00", SYMLINK+="fdevices/by-imei/123.if00"`,
+	} {
+		if !strings.Contains(r, expect+"\n") {
+			t.Errorf("expected rule %s in\n%s", expect, r)
+		}
+	}
+	if !strings.Contains(r, "# dongle imei 456\n# skipped") {
+		t.Errorf("expected dongle without serial to be skipped in\n%s", r)
+	}
+	if strings.Contains(r, "imsi") || strings.Contains(r, "by-port") {
+		t.Errorf("expected only symlinks bound to the dongle in\n%s", r)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := []byte("a\nb\nc\n")
+	b := []byte("a\nc\nd\n")
+	expect := " a\n-b\n c\n+d\n"
+	if d := Diff(a, b); d != expect {
+		t.Errorf("expected %q got %q", expect, d)
+	}
+	if d := Diff(a, a); d != "" {
+		t.Errorf("expected no diff got %q", d)
+	}
+	if d := Diff(nil, []byte("a\n")); d != "+a\n" {
+		t.Errorf("expected %q got %q", "+a\n", d)
+	}
+}
+
+func TestStoreAndInstall(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fdevices-rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := NewStore(filepath.Join(dir, "state", "dongles.json"))
+	for _, v := range []string{"2", "1", "2"} {
+		err = s.Remember(Dongle{IMEI: v, Serial: "S" + v})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	d, err := s.Dongles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d) != 2 || d[0].IMEI != "1" || d[1].IMEI != "2" {
+		t.Fatalf("expected dongles 1 and 2 got %v", d)
+	}
+	path := filepath.Join(dir, "rules.d", "99-fdevices.rules")
+	err = Install(path, []byte("# rules\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "# rules\n" {
+		t.Errorf("expected # rules got %q", b)
+	}
+}
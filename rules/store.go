@@ -0,0 +1,94 @@
+package rules
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Dongle is what is remembered about a dongle to write udev rules for it.
+type Dongle struct {
+	IMEI string `json:"imei"`
+
+	// Serial is the ID_SERIAL_SHORT of the USB device.
+	Serial string `json:"serial"`
+
+	// Vendor and Model are the ID_VENDOR_ID and ID_MODEL_ID of the USB device.
+	Vendor string `json:"vendor"`
+	Model  string `json:"model"`
+
+	// Roles maps the role of a tty, like control or if01 for the other ttys,
+	// to the ID_USB_INTERFACE_NUM of the tty.
+	Roles map[string]string `json:"roles"`
+
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// Store keeps the dongles fdevices has seen in a JSON file, so rules can be
+// written for them when fdevices is not running.
+//
+// This is safe to use concurrently in multiple goroutines
+type Store struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewStore returns a store which keeps the dongles in the file at path.
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Remember adds d to the store, replacing what was known about the dongle
+// with the same IMEI.
+func (s *Store) Remember(d Dongle) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all, err := s.load()
+	if err != nil {
+		return err
+	}
+	if d.LastSeen.IsZero() {
+		d.LastSeen = time.Now()
+	}
+	all[d.IMEI] = d
+	b, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(s.path, b, 0644)
+}
+
+// Dongles returns all dongles in the store ordered by IMEI.
+func (s *Store) Dongles() ([]Dongle, error) {
+	s.mu.Lock()
+	all, err := s.load()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	var o []Dongle
+	for _, v := range all {
+		o = append(o, v)
+	}
+	sort.Slice(o, func(i, j int) bool { return o[i].IMEI < o[j].IMEI })
+	return o, nil
+}
+
+func (s *Store) load() (map[string]Dongle, error) {
+	all := make(map[string]Dongle)
+	b, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return all, nil
+		}
+		return nil, err
+	}
+	err = json.Unmarshal(b, &all)
+	if err != nil {
+		return nil, err
+	}
+	return all, nil
+}
@@ -0,0 +1,65 @@
+package schema
+
+import "fmt"
+
+// Error is the body of the REST API responses with an error status.
+type Error struct {
+	// Status is the HTTP status code of the response.
+	Status int `json:"status"`
+
+	// Code is a short machine readable description, like not_found.
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error codes of the REST API.
+const (
+	CodeBadRequest  = "bad_request"
+	CodeNotFound    = "not_found"
+	CodeAmbiguous   = "ambiguous"
+	CodeUnavailable = "unavailable"
+	CodeInternal    = "internal"
+
+	// CodeUnauthorized is returned when the credentials are missing or
+	// wrong, and CodeForbidden when they lack the scope a request needs.
+	CodeUnauthorized = "unauthorized"
+	CodeForbidden    = "forbidden"
+
+	// CodeCommandFailed is returned when the dongle did not carry out a
+	// command.
+	CodeCommandFailed = "command_failed"
+)
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("fdevices: %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// Command is the body of a command sent to a dongle. Only the fields the
+// command needs are used, sms needs Number and Text and at needs Command.
+type Command struct {
+	// ID is copied to the result, so clients can tell the results apart.
+	ID      string `json:"id,omitempty"`
+	Number  string `json:"number,omitempty"`
+	Text    string `json:"text,omitempty"`
+	Command string `json:"command,omitempty"`
+}
+
+// Result is the outcome of a command.
+type Result struct {
+	ID     string `json:"id,omitempty"`
+	OK     bool   `json:"ok"`
+	Error  string `json:"error,omitempty"`
+	Output string `json:"output,omitempty"`
+}
+
+// Readiness is the body of /readyz, it is ready when every check is.
+type Readiness struct {
+	Ready  bool             `json:"ready"`
+	Checks map[string]Check `json:"checks"`
+}
+
+// Check is the state of a subsystem, with the reason it is not ready.
+type Check struct {
+	Ready bool   `json:"ready"`
+	Error string `json:"error,omitempty"`
+}
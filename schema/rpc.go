@@ -0,0 +1,83 @@
+package schema
+
+import "encoding/json"
+
+// Methods of the websocket protocol. Clients send requests with the methods
+// subscribe, unsubscribe, snapshot, ping and command, the server sends
+// notifications with the methods event, snapshot and closed.
+const (
+	MethodSubscribe   = "subscribe"
+	MethodUnsubscribe = "unsubscribe"
+	MethodSnapshot    = "snapshot"
+	MethodPing        = "ping"
+	MethodCommand     = "command"
+	MethodEvent       = "event"
+	MethodClosed      = "closed"
+)
+
+// Request is a message sent by a websocket client. The response carries the
+// same ID, which the client picks.
+//
+//	{"id": "1", "method": "subscribe", "params": {"types": ["add"]}}
+type Request struct {
+	ID     string          `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// Response answers a Request, it has either a result or an error.
+//
+//	{"id": "1", "result": {"subscription": "3"}}
+type Response struct {
+	ID     string          `json:"id,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *Error          `json:"error,omitempty"`
+}
+
+// Notification is a message the server sends on its own, like the events of
+// a subscription.
+//
+//	{"method": "event", "params": {"subscription": "3", "event": {...}}}
+type Notification struct {
+	Method string       `json:"method"`
+	Params Subscription `json:"params"`
+}
+
+// Filter selects dongles and events. Within a field the values are
+// alternatives, every field which is set has to match.
+type Filter struct {
+	Types  []Type            `json:"types,omitempty"`
+	IMEI   []string          `json:"imei,omitempty"`
+	IMSI   []string          `json:"imsi,omitempty"`
+	ICCID  []string          `json:"iccid,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Subscribe are the params of the subscribe method. Since and Policy are
+// like the query parameters of the websocket, Since is the id of an event.
+type Subscribe struct {
+	Filter
+	Since  string `json:"since,omitempty"`
+	Policy string `json:"policy,omitempty"`
+}
+
+// Subscription identifies a subscription, it is the result of the subscribe
+// method and the params of unsubscribe and of notifications. Notifications
+// carry an event, the dongles of a snapshot along with the id of the event it
+// was taken at, or the reason the subscription was closed.
+type Subscription struct {
+	Subscription string    `json:"subscription"`
+	Event        *Event    `json:"event,omitempty"`
+	ID           string    `json:"id,omitempty"`
+	Dongles      []*Dongle `json:"dongles,omitempty"`
+	Reason       string    `json:"reason,omitempty"`
+}
+
+// CommandParams are the params of the command method. The command is run on
+// the dongle with Dongle as IMEI, IMSI or ICCID, or matching it as a label
+// selector. The result is a Result.
+type CommandParams struct {
+	Command
+	Dongle string `json:"dongle"`
+	Name   string `json:"name"`
+}
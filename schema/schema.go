@@ -0,0 +1,310 @@
+// Package schema defines the events fdevices streams to its clients.
+//
+// It only depends on the standard library, so clients can import it to decode
+// the events they receive
+//
+//	var e schema.Event
+//	err := json.Unmarshal(msg, &e)
+//	if err != nil {
+//		return err
+//	}
+//	switch e.Type {
+//	case schema.Add:
+//		d := e.Data.(*schema.Dongle)
+//		...
+//	}
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version is the version of the event schema. It is increased whenever a
+// change is made that old clients can not cope with.
+const Version = 1
+
+// Type is the type of an event. It decides the type of the event payload.
+type Type string
+
+// Event types, and the type of their payload.
+const (
+	// Add is sent when a dongle was found. The payload is a *Dongle.
+	Add Type = "add"
+
+	// Remove is sent when a dongle went away. The payload is a *Dongle.
+	Remove Type = "remove"
+
+	// Update is sent when the state of a dongle changed. The payload is a
+	// *Dongle.
+	Update Type = "update"
+
+	// PortAdd is sent when a passive serial device was found. The payload is
+	// a *Port.
+	PortAdd Type = "port-add"
+
+	// PortRemove is sent when a passive serial device went away. The payload
+	// is a *Port.
+	PortRemove Type = "port-remove"
+
+	// Gap is sent to a client resuming from a sequence number, when events
+	// after it are no longer available. The client must fetch the state of
+	// the dongles again. The payload is a *Missed.
+	Gap Type = "gap"
+)
+
+// Source is the part of fdevices which caused an event.
+type Source string
+
+// Sources of events.
+const (
+	// SourceUdev is the udev monitor, for devices which were removed.
+	SourceUdev Source = "udev"
+
+	// SourceProbe is the probing of a device with AT commands.
+	SourceProbe Source = "probe"
+
+	// SourcePoller is the periodic check of the dongles.
+	SourcePoller Source = "poller"
+
+	// SourceAPI is a request made to the fdevices API.
+	SourceAPI Source = "api"
+)
+
+// Change is a field of a device which changed. Properties are reported as
+// properties.<name>, and values which are not strings are formatted.
+type Change struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// Device identifies the device an event is about.
+type Device struct {
+	IMEI  string `json:"imei,omitempty"`
+	IMSI  string `json:"imsi,omitempty"`
+	ICCID string `json:"iccid,omitempty"`
+	Path  string `json:"path"`
+
+	// Labels are set on the device by the fdevices configuration, and from
+	// the USB port the device is plugged into.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Event is the envelope of every event.
+type Event struct {
+	// Version is the schema version the event was encoded with.
+	Version int `json:"version"`
+
+	// Seq increases by one for every event sent by an fdevices process.
+	Seq uint64 `json:"seq"`
+
+	// Boot identifies the fdevices process which sent the event. Sequence
+	// numbers start again with every process, so a sequence number only
+	// identifies an event along with its boot.
+	Boot string `json:"boot,omitempty"`
+
+	// Time is when the event happened.
+	Time time.Time `json:"time"`
+
+	Type   Type   `json:"type"`
+	Device Device `json:"device"`
+
+	// Source is the part of fdevices which caused the event.
+	Source Source `json:"source,omitempty"`
+
+	// Changes are the fields of the device which changed, they are set on
+	// update events.
+	Changes []Change `json:"changes,omitempty"`
+
+	// Data is the payload, its type depends on Type. Payloads of types this
+	// package does not know about are kept as json.RawMessage.
+	Data interface{} `json:"data"`
+}
+
+// SIM states of a dongle.
+const (
+	SIMReady  = "ready"
+	SIMPIN    = "pin"
+	SIMPUK    = "puk"
+	SIMAbsent = "absent"
+)
+
+// HealthOK is the health of a dongle which answers.
+const HealthOK = "ok"
+
+// Dongle is a 3G dongle.
+type Dongle struct {
+	IMEI        string            `json:"imei"`
+	IMSI        string            `json:"imsi"`
+	ICCID       string            `json:"iccid"`
+	Path        string            `json:"path"`
+	IsSymlinked bool              `json:"symlink"`
+	ATI         string            `json:"ati"`
+	Properties  map[string]string `json:"properties"`
+
+	// Operator is the network the dongle is registered on, as reported to
+	// AT+COPS?.
+	Operator string `json:"operator,omitempty"`
+
+	// Signal is the RSSI reported to AT+CSQ, from 0 to 31. It is nil when it
+	// is not known.
+	Signal *int `json:"signal,omitempty"`
+
+	// SIM is the state of the SIM reported to AT+CPIN?, one of SIMReady,
+	// SIMPIN, SIMPUK and SIMAbsent, or another state in lower case. It is
+	// empty when it is not known.
+	SIM string `json:"sim,omitempty"`
+
+	// Health is HealthOK when the dongle answered when it was last polled,
+	// otherwise why it did not, like timeout. It is empty before the first
+	// poll.
+	Health string `json:"health,omitempty"`
+
+	// Labels are only set by the REST API, events carry them on Device.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Diff returns the fields which differ between old and new, in the order of
+// the fields of Dongle followed by the properties ordered by name.
+func Diff(old, new *Dongle) []Change {
+	var o []Change
+	add := func(field, a, b string) {
+		if a != b {
+			o = append(o, Change{Field: field, Old: a, New: b})
+		}
+	}
+	add("imei", old.IMEI, new.IMEI)
+	add("imsi", old.IMSI, new.IMSI)
+	add("iccid", old.ICCID, new.ICCID)
+	add("path", old.Path, new.Path)
+	add("symlink", strconv.FormatBool(old.IsSymlinked), strconv.FormatBool(new.IsSymlinked))
+	add("ati", old.ATI, new.ATI)
+	add("operator", old.Operator, new.Operator)
+	add("signal", signal(old.Signal), signal(new.Signal))
+	add("sim", old.SIM, new.SIM)
+	add("health", old.Health, new.Health)
+	var keys []string
+	for k := range old.Properties {
+		keys = append(keys, k)
+	}
+	for k := range new.Properties {
+		if _, ok := old.Properties[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		add("properties."+k, old.Properties[k], new.Properties[k])
+	}
+	return o
+}
+
+// Port is a serial device which is not a dongle.
+type Port struct {
+	Path       string            `json:"path"`
+	Status     string            `json:"status"`
+	Reason     string            `json:"reason"`
+	Properties map[string]string `json:"properties"`
+	CreatedOn  time.Time         `json:"created_on"`
+}
+
+// Missed describes the events a client has missed.
+type Missed struct {
+	// Since is the sequence number the client asked to resume from.
+	Since uint64 `json:"since"`
+
+	// Oldest is the sequence number of the oldest event still available, it
+	// is zero when there are none.
+	Oldest uint64 `json:"oldest"`
+}
+
+// Snapshot is the list of dongles sent first on a websocket opened with
+// ?snapshot=id, along with the id of the event it was taken at. The id is
+// empty when there was no event yet.
+type Snapshot struct {
+	ID      string    `json:"id,omitempty"`
+	Dongles []*Dongle `json:"dongles"`
+}
+
+// signal formats the signal of a dongle for a Change, which is empty when it
+// is not known.
+func signal(v *int) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.Itoa(*v)
+}
+
+// ID returns the id of the event with sequence number seq sent by the process
+// boot, as used by clients to resume a stream.
+func ID(boot string, seq uint64) string {
+	return boot + "-" + strconv.FormatUint(seq, 10)
+}
+
+// ParseID returns the boot and sequence number of an id returned by ID. A
+// bare sequence number is accepted with an empty boot, it matches no process.
+func ParseID(id string) (boot string, seq uint64, err error) {
+	n := id
+	if i := strings.LastIndexByte(id, '-'); i >= 0 {
+		boot, n = id[:i], id[i+1:]
+	}
+	seq, err = strconv.ParseUint(n, 10, 64)
+	if err != nil {
+		return "", 0, errors.New("schema: bad event id " + id)
+	}
+	return boot, seq, nil
+}
+
+// payload returns a new value for the payload of events of type t.
+func payload(t Type) interface{} {
+	switch t {
+	case Add, Remove, Update:
+		return &Dongle{}
+	case PortAdd, PortRemove:
+		return &Port{}
+	case Gap:
+		return &Missed{}
+	}
+	return nil
+}
+
+// UnmarshalJSON decodes the event, and its payload into the type matching the
+// event type.
+func (e *Event) UnmarshalJSON(b []byte) error {
+	type event Event
+	var raw struct {
+		event
+		Data json.RawMessage `json:"data"`
+	}
+	err := json.Unmarshal(b, &raw)
+	if err != nil {
+		return err
+	}
+	*e = Event(raw.event)
+	e.Data = raw.Data
+	p := payload(e.Type)
+	if p == nil || len(raw.Data) == 0 || string(raw.Data) == "null" {
+		return nil
+	}
+	err = json.Unmarshal(raw.Data, p)
+	if err != nil {
+		return err
+	}
+	e.Data = p
+	return nil
+}
+
+// Decode decodes a single event.
+func Decode(b []byte) (*Event, error) {
+	e := &Event{}
+	err := json.Unmarshal(b, e)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
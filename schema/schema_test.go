@@ -0,0 +1,85 @@
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDecode(t *testing.T) {
+	now := time.Date(2017, 4, 18, 10, 0, 0, 0, time.UTC)
+	sample := []*Event{
+		{
+			Version: Version, Seq: 1, Time: now, Type: Add,
+			Device: Device{IMEI: "123", IMSI: "456", Path: "/dev/ttyUSB0",
+				Labels: map[string]string{"port": "1-1.3"}},
+			Data: &Dongle{IMEI: "123", IMSI: "456", Path: "/dev/ttyUSB0"},
+		},
+		{
+			Version: Version, Seq: 2, Time: now, Type: PortAdd,
+			Device: Device{Path: "/dev/ttyUSB3"},
+			Data:   &Port{Path: "/dev/ttyUSB3", Status: "passive"},
+		},
+	}
+	for _, v := range sample {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, err := Decode(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Seq != v.Seq || e.Type != v.Type || !reflect.DeepEqual(e.Device, v.Device) || !e.Time.Equal(v.Time) {
+			t.Errorf("expected %v got %v", v, e)
+		}
+		switch e.Type {
+		case Add:
+			d, ok := e.Data.(*Dongle)
+			if !ok || d.IMEI != "123" {
+				t.Errorf("expected *Dongle got %#v", e.Data)
+			}
+		case PortAdd:
+			p, ok := e.Data.(*Port)
+			if !ok || p.Status != "passive" {
+				t.Errorf("expected *Port got %#v", e.Data)
+			}
+		}
+	}
+}
+
+func TestDecodeUnknownType(t *testing.T) {
+	e, err := Decode([]byte(`{"version":1,"seq":3,"type":"future","data":{"a":1}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, ok := e.Data.(json.RawMessage)
+	if !ok {
+		t.Fatalf("expected json.RawMessage got %T", e.Data)
+	}
+	if string(raw) != `{"a":1}` {
+		t.Errorf("expected {\"a\":1} got %s", raw)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := &Dongle{IMEI: "123", IMSI: "456", Path: "/dev/ttyUSB0",
+		Properties: map[string]string{"ID_SERIAL": "a", "ID_MODEL": "E173"}}
+	new := &Dongle{IMEI: "123", IMSI: "789", Path: "/dev/ttyUSB0", IsSymlinked: true,
+		Properties: map[string]string{"ID_SERIAL": "b", "DEVNAME": "/dev/ttyUSB0"}}
+	expect := []Change{
+		{Field: "imsi", Old: "456", New: "789"},
+		{Field: "symlink", Old: "false", New: "true"},
+		{Field: "properties.DEVNAME", Old: "", New: "/dev/ttyUSB0"},
+		{Field: "properties.ID_MODEL", Old: "E173", New: ""},
+		{Field: "properties.ID_SERIAL", Old: "a", New: "b"},
+	}
+	c := Diff(old, new)
+	if !reflect.DeepEqual(c, expect) {
+		t.Errorf("expected %v got %v", expect, c)
+	}
+	if c := Diff(new, new); len(c) != 0 {
+		t.Errorf("expected no changes got %v", c)
+	}
+}
@@ -0,0 +1,117 @@
+// Package socket opens the sockets fdevices serves its API on, besides the
+// TCP port: a Unix socket, and the sockets passed by systemd socket
+// activation.
+package socket
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// DefaultMode is the mode of Unix sockets, which lets the owner and the group
+// connect.
+const DefaultMode os.FileMode = 0660
+
+// firstFD is the first file descriptor passed by systemd, SD_LISTEN_FDS_START.
+const firstFD = 3
+
+// dialTimeout is how long Unix waits for an answer from a socket left at its
+// path before it is taken as stale.
+const dialTimeout = time.Second
+
+// Unix listens on a Unix socket at path, with the given mode. When group is
+// set the socket is given to that group, so its members can connect. A socket
+// left at path by a previous run is removed, while a socket something still
+// listens on and any other file are errors.
+//
+// The mode is applied with the umask while the socket is created, so it is
+// never reachable with looser permissions. The umask is shared by the whole
+// process, Unix is meant to be called at startup.
+func Unix(path string, mode os.FileMode, group string) (net.Listener, error) {
+	gid := -1
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			return nil, err
+		}
+		gid, err = strconv.Atoi(g.Gid)
+		if err != nil {
+			return nil, fmt.Errorf("socket: group %s: bad gid %s", group, g.Gid)
+		}
+	}
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("socket: %s exists and is not a socket", path)
+		}
+		if c, err := net.DialTimeout("unix", path, dialTimeout); err == nil {
+			c.Close()
+			return nil, fmt.Errorf("socket: %s is in use by another process", path)
+		}
+		err = os.Remove(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	umask := syscall.Umask(int(^mode.Perm() & 0777))
+	l, err := net.Listen("unix", path)
+	syscall.Umask(umask)
+	if err != nil {
+		return nil, err
+	}
+	if gid >= 0 {
+		err = os.Chown(path, -1, gid)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// Systemd returns the sockets passed by systemd socket activation, as
+// described in sd_listen_fds(3). It returns nothing when the process was not
+// socket activated. The environment variables are cleared, so they are not
+// passed on to child processes.
+func Systemd() ([]net.Listener, error) {
+	pid, n := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if pid == "" || n == "" {
+		return nil, nil
+	}
+	if v, err := strconv.Atoi(pid); err != nil || v != os.Getpid() {
+		// meant for another process
+		return nil, nil
+	}
+	count, err := strconv.Atoi(n)
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("socket: bad LISTEN_FDS %q", n)
+	}
+	return listeners(firstFD, count)
+}
+
+// listeners returns the listeners of the count file descriptors starting at
+// first, which are closed once they are duplicated by the listeners.
+func listeners(first, count int) ([]net.Listener, error) {
+	var o []net.Listener
+	for fd := first; fd < first+count; fd++ {
+		syscall.CloseOnExec(fd)
+		f := os.NewFile(uintptr(fd), "systemd socket "+strconv.Itoa(fd))
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, v := range o {
+				v.Close()
+			}
+			return nil, fmt.Errorf("socket: file descriptor %d: %v", fd, err)
+		}
+		o = append(o, l)
+	}
+	return o, nil
+}
@@ -0,0 +1,98 @@
+package socket
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnix(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "api.sock")
+
+	// a socket left by a previous run
+	old, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old.(*net.UnixListener).SetUnlinkOnClose(false)
+	old.Close()
+
+	l, err := Unix(path, 0600, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600 got %v", fi.Mode().Perm())
+	}
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	c := &http.Client{Transport: &http.Transport{
+		Dial: func(network, addr string) (net.Conn, error) {
+			return net.Dial("unix", path)
+		},
+	}}
+	res, err := c.Get("http://fdevices/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusTeapot {
+		t.Errorf("expected %d got %d", http.StatusTeapot, res.StatusCode)
+	}
+
+	_, err = Unix(path, 0600, "")
+	if err == nil {
+		t.Error("expected a socket in use not to be replaced")
+	}
+	if _, err = os.Stat(path); err != nil {
+		t.Errorf("expected the socket in use to be kept got %v", err)
+	}
+
+	file := filepath.Join(dir, "file")
+	err = ioutil.WriteFile(file, nil, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Unix(file, 0600, "")
+	if err == nil {
+		t.Error("expected a regular file not to be replaced")
+	}
+}
+
+func TestSystemd(t *testing.T) {
+	os.Setenv("LISTEN_PID", "1")
+	os.Setenv("LISTEN_FDS", "1")
+	ls, err := Systemd()
+	if err != nil || len(ls) != 0 {
+		t.Errorf("expected no sockets for another process got %v %v", ls, err)
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Error("expected the environment to be cleared")
+	}
+
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+	f, err := ts.Listener.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ls, err = listeners(int(f.Fd()), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ls[0].Close()
+	if ls[0].Addr().String() != ts.Listener.Addr().String() {
+		t.Errorf("expected %s got %s", ts.Listener.Addr(), ls[0].Addr())
+	}
+}
@@ -0,0 +1,328 @@
+// Package symlink manages the symlinks fdevices creates for dongles.
+//
+// Symlink names are text/template strings which are rendered with the identity
+// of a dongle, and resolved relative to a root directory. Every symlink that is
+// created is recorded in a state file, so that links left behind by a previous
+// run can be cleaned up without touching anything fdevices did not create.
+package symlink
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// DefaultRoot is the directory symlinks are created in when the layout has no
+// root.
+const DefaultRoot = "/dev"
+
+// DefaultLinks are the symlink templates used when the layout has none. The
+// first two are the links fdevices has always created, and which existing
+// Asterisk configurations rely on.
+var DefaultLinks = []string{
+	"{{.IMEI}}.imei",
+	"{{.IMSI}}.imsi",
+	"fdevices/by-imei/{{.IMEI}}",
+	"fdevices/by-imsi/{{.IMSI}}",
+	"fdevices/by-iccid/{{.ICCID}}",
+	"fdevices/by-port/{{.Port}}/control",
+	"fdevices/by-name/{{.Name}}/control",
+}
+
+// Layout describes which symlinks are created for a dongle.
+type Layout struct {
+	// Root is the directory all symlinks are created in.
+	Root string
+
+	// Links are templates for the symlink names, relative to Root. They are
+	// rendered with Info. A link is skipped when a field it uses is empty.
+	Links []string
+}
+
+// Info identifies the dongle a symlink is created for.
+type Info struct {
+	IMEI  string
+	IMSI  string
+	ICCID string
+
+	// Port is the physical USB port location, like 1-1.3
+	Port string
+
+	// Name is the friendly name of the port.
+	Name string
+}
+
+func (i Info) data() map[string]string {
+	m := make(map[string]string)
+	add := func(k, v string) {
+		v = strings.TrimSpace(v)
+		v = strings.Replace(v, string(filepath.Separator), "-", -1)
+		if v != "" && v != "." && v != ".." {
+			m[k] = v
+		}
+	}
+	add("IMEI", i.IMEI)
+	add("IMSI", i.IMSI)
+	add("ICCID", i.ICCID)
+	add("Port", i.Port)
+	add("Name", i.Name)
+	return m
+}
+
+// Manager creates and removes symlinks according to a Layout, and keeps a
+// record of every symlink it created.
+//
+// This is safe to use concurrently in multiple goroutines
+type Manager struct {
+	root  string
+	links []*template.Template
+	state string
+
+	mu      sync.Mutex
+	created map[string]string
+}
+
+// New returns a Manager for the layout l. Symlinks which are created are
+// recorded in the file state, an empty state disables the record.
+func New(l Layout, state string) (*Manager, error) {
+	m := &Manager{
+		root:    l.Root,
+		state:   state,
+		created: make(map[string]string),
+	}
+	if m.root == "" {
+		m.root = DefaultRoot
+	}
+	m.root = filepath.Clean(m.root)
+	links := l.Links
+	if len(links) == 0 {
+		links = DefaultLinks
+	}
+	for _, v := range links {
+		t, err := template.New(v).Option("missingkey=error").Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("symlink: bad template %q: %v", v, err)
+		}
+		m.links = append(m.links, t)
+	}
+	return m, nil
+}
+
+// Root returns the directory symlinks are created in.
+func (m *Manager) Root() string {
+	return m.root
+}
+
+// Names renders the layout for i, and returns the absolute names of the
+// symlinks. Templates using fields which are empty in i are skipped.
+func (m *Manager) Names(i Info) []string {
+	data := i.data()
+	var names []string
+	for _, t := range m.links {
+		var buf bytes.Buffer
+		err := t.Execute(&buf, data)
+		if err != nil {
+			continue
+		}
+		name, err := m.resolve(buf.String())
+		if err != nil {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func (m *Manager) resolve(rel string) (string, error) {
+	rel = strings.TrimSpace(rel)
+	if rel == "" || filepath.IsAbs(rel) {
+		return "", errors.New("symlink: name must be relative to the root")
+	}
+	name := filepath.Join(m.root, rel)
+	if !strings.HasPrefix(name, m.root+string(filepath.Separator)) {
+		return "", errors.New("symlink: name is outside the root")
+	}
+	return name, nil
+}
+
+// Link creates all the symlinks of the layout pointing to target. The names of
+// the symlinks which were created are returned, when some of them failed the
+// last error is returned as well.
+func (m *Manager) Link(target string, i Info) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var done []string
+	var lastErr error
+	for _, name := range m.Names(i) {
+		err := m.link(target, name)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		done = append(done, name)
+	}
+	err := m.save()
+	if err != nil {
+		lastErr = err
+	}
+	return done, lastErr
+}
+
+func (m *Manager) link(target, name string) error {
+	if t, ok := m.created[name]; ok && t != target {
+		// the name was ours, but for another device.
+		m.remove(name)
+	} else if !ok {
+		fi, err := os.Lstat(name)
+		if err == nil && fi.Mode()&os.ModeSymlink == 0 {
+			return fmt.Errorf("symlink: %s exists and is not a symlink", name)
+		}
+	}
+	err := os.MkdirAll(filepath.Dir(name), 0755)
+	if err != nil {
+		return err
+	}
+	_ = os.Remove(name)
+	err = os.Symlink(target, name)
+	if err != nil {
+		return err
+	}
+	m.created[name] = target
+	return nil
+}
+
+// Unlink removes all symlinks created by the manager which point to target,
+// and returns their names.
+func (m *Manager) Unlink(target string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var names []string
+	for name, t := range m.created {
+		if t == target {
+			m.remove(name)
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, m.save()
+}
+
+// remove deletes the symlink name, only when it still points where it was
+// created to point to. Directories left empty are removed up to the root.
+func (m *Manager) remove(name string) {
+	target := m.created[name]
+	delete(m.created, name)
+	t, err := os.Readlink(name)
+	if err != nil || t != target {
+		return
+	}
+	if os.Remove(name) != nil {
+		return
+	}
+	for dir := filepath.Dir(name); dir != m.root && strings.HasPrefix(dir, m.root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+// Created returns the symlinks that are currently managed, mapped to the path
+// they point to.
+func (m *Manager) Created() map[string]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o := make(map[string]string, len(m.created))
+	for k, v := range m.created {
+		o[k] = v
+	}
+	return o
+}
+
+// Reconcile removes the symlinks recorded in the state file by a previous run.
+// Symlinks that were changed to point somewhere else, or replaced by something
+// which is not a symlink, are left alone.
+func (m *Manager) Reconcile() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for name := range m.created {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		m.remove(name)
+	}
+	return names, m.save()
+}
+
+// record is the on disk format of the state file.
+type record struct {
+	Root  string            `json:"root"`
+	Links map[string]string `json:"links"`
+}
+
+func (m *Manager) load() error {
+	if m.state == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(m.state)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	r := &record{}
+	err = json.Unmarshal(b, r)
+	if err != nil {
+		return fmt.Errorf("symlink: reading %s: %v", m.state, err)
+	}
+	for k, v := range r.Links {
+		m.created[k] = v
+	}
+	return nil
+}
+
+// save writes the record of created symlinks to the state file. The file is
+// replaced atomically so a crash never leaves a truncated record behind.
+func (m *Manager) save() error {
+	if m.state == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(&record{Root: m.root, Links: m.created}, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(m.state), 0755)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(m.state), ".symlinks")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), m.state)
+}
@@ -0,0 +1,136 @@
+package symlink
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newManager returns a manager with the links given, or the default ones,
+// under a temporary root.
+func newManager(t *testing.T, links ...string) *Manager {
+	dir := t.TempDir()
+	m, err := New(Layout{Root: filepath.Join(dir, "dev"), Links: links}, filepath.Join(dir, "state", "symlinks.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestNames(t *testing.T) {
+	m := newManager(t)
+	root := m.Root()
+	names := m.Names(Info{IMEI: "123", IMSI: "456", Port: "1-1.3", Name: "news/line"})
+	expect := []string{
+		filepath.Join(root, "123.imei"),
+		filepath.Join(root, "456.imsi"),
+		filepath.Join(root, "fdevices/by-imei/123"),
+		filepath.Join(root, "fdevices/by-imsi/456"),
+		filepath.Join(root, "fdevices/by-port/1-1.3/control"),
+		filepath.Join(root, "fdevices/by-name/news-line/control"),
+	}
+	if len(names) != len(expect) {
+		t.Fatalf("expected %v got %v", expect, names)
+	}
+	for i := range expect {
+		if names[i] != expect[i] {
+			t.Errorf("expected %s got %s", expect[i], names[i])
+		}
+	}
+}
+
+func TestNamesOutsideRoot(t *testing.T) {
+	m := newManager(t, "../{{.IMEI}}", "/tmp/{{.IMEI}}", "{{.IMEI}}")
+	names := m.Names(Info{IMEI: ".."})
+	if len(names) != 0 {
+		t.Errorf("expected no names got %v", names)
+	}
+	names = m.Names(Info{IMEI: "123"})
+	if len(names) != 1 {
+		t.Errorf("expected 1 name got %v", names)
+	}
+}
+
+func TestLinkAndUnlink(t *testing.T) {
+	m := newManager(t)
+	target := filepath.Join(t.TempDir(), "ttyUSB0")
+	names, err := m.Link(target, Info{IMEI: "123", IMSI: "456", Port: "1-1.3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 5 {
+		t.Fatalf("expected 5 symlinks got %v", names)
+	}
+	for _, n := range names {
+		l, err := os.Readlink(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l != target {
+			t.Errorf("expected %s got %s", target, l)
+		}
+	}
+	removed, err := m.Unlink(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != len(names) {
+		t.Errorf("expected %d removed got %d", len(names), len(removed))
+	}
+	for _, n := range names {
+		if _, err := os.Lstat(n); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed", n)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(m.Root(), "fdevices")); !os.IsNotExist(err) {
+		t.Error("expected empty directories to be removed")
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	m := newManager(t)
+	target := filepath.Join(t.TempDir(), "ttyUSB0")
+	names, err := m.Link(target, Info{IMEI: "123", IMSI: "456"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// somebody else took over one of the names
+	_ = os.Remove(names[0])
+	err = os.Symlink("/somewhere/else", names[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign := filepath.Join(m.Root(), "999.imei")
+	err = os.Symlink(target, foreign)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a new run of fdevices
+	n, err := New(Layout{Root: m.Root()}, m.state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded, err := n.Reconcile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recorded) != len(names) {
+		t.Errorf("expected %d recorded links got %d", len(names), len(recorded))
+	}
+	if _, err := os.Lstat(names[0]); err != nil {
+		t.Errorf("expected %s to be left alone", names[0])
+	}
+	for _, v := range names[1:] {
+		if _, err := os.Lstat(v); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed", v)
+		}
+	}
+	if _, err := os.Lstat(foreign); err != nil {
+		t.Error("expected symlinks not created by fdevices to be left alone")
+	}
+	if len(n.Created()) != 0 {
+		t.Errorf("expected empty record got %v", n.Created())
+	}
+}
@@ -0,0 +1,175 @@
+package udev
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/FarmRadioHangar/fdevices/control"
+	"github.com/FarmRadioHangar/fdevices/db"
+	"github.com/FarmRadioHangar/fdevices/log"
+	"github.com/FarmRadioHangar/fdevices/schema"
+	"github.com/tarm/serial"
+)
+
+var _ control.Controller = (*Manager)(nil)
+
+// readTimeout is how long a command waits for more of the reply of a dongle.
+const readTimeout = 5 * time.Second
+
+// conn returns a connection to the control tty of the dongle with the given
+// imei. Commands to a dongle are serialized, so only one of them talks to it
+// at a time, while commands to other dongles go ahead. Replies are not waited
+// for past the deadline of ctx.
+func (m *Manager) conn(ctx context.Context, imei string) (*Conn, func(), error) {
+	d, err := db.GetSymlinkCandidate(m.db, imei)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, control.ErrUnknownDongle
+		}
+		return nil, nil, err
+	}
+	unlock, err := m.lock(ctx, imei)
+	if err != nil {
+		return nil, nil, err
+	}
+	timeout := readTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		if left := time.Until(deadline); left < timeout {
+			timeout = left
+		}
+	}
+	if timeout <= 0 {
+		unlock()
+		return nil, nil, context.DeadlineExceeded
+	}
+	c := &Conn{imei: imei, device: serial.Config{Name: d.Path, Baud: 9600, ReadTimeout: timeout}}
+	err = c.Open()
+	if err != nil {
+		unlock()
+		return nil, nil, err
+	}
+	return c, func() {
+		c.Close()
+		unlock()
+	}, nil
+}
+
+// lock waits until no other command talks to the dongle with the given imei,
+// or ctx is done. The function returned releases the dongle.
+func (m *Manager) lock(ctx context.Context, imei string) (func(), error) {
+	m.ctlMu.Lock()
+	if m.ctl == nil {
+		m.ctl = make(map[string]chan struct{})
+	}
+	l, ok := m.ctl[imei]
+	if !ok {
+		l = make(chan struct{}, 1)
+		m.ctl[imei] = l
+	}
+	m.ctlMu.Unlock()
+	select {
+	case l <- struct{}{}:
+		return func() { <-l }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// SendSMS sends an SMS in text mode.
+func (m *Manager) SendSMS(ctx context.Context, imei, number, text string) error {
+	if !control.ValidNumber(number) {
+		return fmt.Errorf("control: bad number %q", number)
+	}
+	if strings.ContainsAny(text, "\x1a\x1b") {
+		return errors.New("control: text contains control characters")
+	}
+	c, done, err := m.conn(ctx, imei)
+	if err != nil {
+		return err
+	}
+	defer done()
+	_, err = c.Run("AT+CMGF=1")
+	if err != nil {
+		return err
+	}
+	log.Info("sending sms from %s to %s", imei, number)
+	_, err = c.Exec(fmt.Sprintf("AT+CMGS=\"%s\"\r%s\x1a", number, text))
+	return err
+}
+
+// RunAT runs a single AT command.
+func (m *Manager) RunAT(ctx context.Context, imei, cmd string) (string, error) {
+	cmd = strings.TrimSpace(cmd)
+	if !strings.HasPrefix(strings.ToUpper(cmd), "AT") || strings.ContainsAny(cmd, "\r\n\x1a") {
+		return "", fmt.Errorf("control: bad AT command %q", cmd)
+	}
+	c, done, err := m.conn(ctx, imei)
+	if err != nil {
+		return "", err
+	}
+	defer done()
+	o, err := c.Run(cmd)
+	m.report(imei, cmd, o, err, schema.SourceAPI)
+	if err != nil {
+		return "", err
+	}
+	return string(o), nil
+}
+
+// report stores what the reply res to cmd, or the error err it failed with,
+// tells about the dongle imei: the signal for AT+CSQ, the operator for
+// AT+COPS? and the SIM state for AT+CPIN?. An update from source is sent when
+// it changed. Other commands are ignored.
+func (m *Manager) report(imei, cmd string, res []byte, err error, source schema.Source) {
+	cmd = strings.ToUpper(strings.TrimSpace(cmd))
+	var set func(d *db.Dongle)
+	switch {
+	case err != nil && cmd != "AT+CPIN?":
+		return
+	case cmd == "AT+CSQ" && csq.Match(res):
+		set = func(d *db.Dongle) {
+			d.Signal = nil
+			if n, ok := signal(res); ok {
+				d.Signal = &n
+			}
+		}
+	case cmd == "AT+COPS?":
+		op, ok := operator(res)
+		if !ok {
+			return
+		}
+		set = func(d *db.Dongle) { d.Operator = op }
+	case cmd == "AT+CPIN?":
+		state, ok := sim(res, err)
+		if !ok {
+			return
+		}
+		set = func(d *db.Dongle) { d.SIM = state }
+	default:
+		return
+	}
+	d, err := db.GetSymlinkCandidate(m.db, imei)
+	if err != nil {
+		log.Error("report %s : %v", imei, err)
+		return
+	}
+	set(d)
+	m.update(d, source)
+}
+
+// Reset restarts the dongle with AT+CFUN=1,1. The dongle goes away and comes
+// back, which is picked up by udev like any other replug.
+func (m *Manager) Reset(ctx context.Context, imei string) error {
+	c, done, err := m.conn(ctx, imei)
+	if err != nil {
+		return err
+	}
+	defer done()
+	log.Info("resetting %s", imei)
+	_, err = c.Run("AT+CFUN=1,1")
+	return err
+}
@@ -0,0 +1,84 @@
+package udev
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/FarmRadioHangar/fdevices/db"
+	"github.com/FarmRadioHangar/fdevices/events"
+	"github.com/FarmRadioHangar/fdevices/schema"
+)
+
+func TestLock(t *testing.T) {
+	m := &Manager{}
+	unlock, err := m.lock(context.Background(), "123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// other dongles are not held up
+	other, err := m.lock(context.Background(), "456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err = m.lock(ctx, "123"); err != context.DeadlineExceeded {
+		t.Errorf("expected %v got %v", context.DeadlineExceeded, err)
+	}
+
+	unlock()
+	again, err := m.lock(context.Background(), "123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again()
+}
+
+func TestReport(t *testing.T) {
+	ql, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ql.Close()
+	err = db.CreateDongle(ql, &db.Dongle{IMEI: "123", IMSI: "456", Path: "/dev/ttyUSB0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := events.NewStream(10)
+	s.Start(ctx)
+	sub, err := s.Subscribe(events.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New(ql, s, nil)
+	m.report("123", "AT+CSQ", []byte("+CSQ: 17,99\r\n\r\nOK"), nil, schema.SourceAPI)
+	m.report("123", "at+cops?", []byte("+COPS: 0,0,\"Vodacom TZ\",2\r\n\r\nOK"), nil, schema.SourceAPI)
+	m.report("123", "ATI", []byte("OK"), nil, schema.SourceAPI)
+	m.report("123", "AT+CSQ", []byte("+CSQ: 17,99\r\n\r\nOK"), nil, schema.SourceAPI)
+	m.report("123", "AT+CPIN?", nil, errors.New("+CME ERROR: 10"), schema.SourceAPI)
+	m.report("123", "AT+COPS?", nil, errors.New("ERROR"), schema.SourceAPI)
+	m.setHealth("123", healthTimeout)
+	s.Unsubscribe(sub.ID)
+
+	var got []string
+	for e := range sub.C {
+		if e.Source != schema.SourceAPI && e.Source != schema.SourcePoller {
+			t.Errorf("expected source %s got %s", schema.SourceAPI, e.Source)
+		}
+		for _, c := range e.Changes {
+			got = append(got, c.Field+"="+c.New)
+		}
+	}
+	expect := []string{"signal=17", "operator=Vodacom TZ", "sim=absent", "health=timeout"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected %v got %v", expect, got)
+	}
+}
@@ -0,0 +1,193 @@
+package udev
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jochenvg/go-udev"
+)
+
+// DefaultSettle is the default time the manager waits for udev events of a
+// USB device to settle before acting on them.
+const DefaultSettle = 2 * time.Second
+
+// hotplug is a udev action on a single tty.
+type hotplug struct {
+	action string
+	path   string
+	device *udev.Device
+}
+
+// pending is the coalesced state of a tty inside a settle window.
+type pending struct {
+	last      *hotplug
+	sawRemove bool
+	received  int
+}
+
+// batch is all the work that has been queued for a single USB device.
+type batch struct {
+	ports   map[string]*pending
+	timer   *time.Timer
+	running bool
+}
+
+// debouncer coalesces hotplug events per USB device. Events are held until no
+// new event for the same USB device arrived for the settle window, only then
+// the final state of each tty is handed over to fn.
+//
+// Calls to fn for the same USB device are never concurrent, events that arrive
+// while a batch is being processed are queued for the next batch.
+type debouncer struct {
+	settle     time.Duration
+	fn         func(key string, work []*hotplug)
+	mu         sync.Mutex
+	batches    map[string]*batch
+	suppressed uint64
+	stopped    bool
+}
+
+func newDebouncer(settle time.Duration, fn func(string, []*hotplug)) *debouncer {
+	return &debouncer{
+		settle:  settle,
+		fn:      fn,
+		batches: make(map[string]*batch),
+	}
+}
+
+// push queues the event e for the USB device identified by key.
+func (d *debouncer) push(key string, e *hotplug) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		return
+	}
+	b, ok := d.batches[key]
+	if !ok {
+		b = &batch{ports: make(map[string]*pending)}
+		d.batches[key] = b
+	}
+	p, ok := b.ports[e.path]
+	if !ok {
+		p = &pending{}
+		b.ports[e.path] = p
+	}
+	p.last = e
+	p.received++
+	if e.action == "remove" {
+		p.sawRemove = true
+	}
+	if b.running {
+		// the timer is armed again once the running batch is done.
+		return
+	}
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	b.timer = time.AfterFunc(d.settle, func() { d.fire(key) })
+}
+
+func (d *debouncer) fire(key string) {
+	d.mu.Lock()
+	b, ok := d.batches[key]
+	if !ok || b.running || d.stopped {
+		d.mu.Unlock()
+		return
+	}
+	work, suppressed := b.take()
+	b.running = true
+	d.mu.Unlock()
+
+	if suppressed > 0 {
+		atomic.AddUint64(&d.suppressed, uint64(suppressed))
+	}
+	d.fn(key, work)
+
+	d.mu.Lock()
+	b.running = false
+	if len(b.ports) == 0 {
+		delete(d.batches, key)
+	} else if !d.stopped {
+		b.timer = time.AfterFunc(d.settle, func() { d.fire(key) })
+	}
+	d.mu.Unlock()
+}
+
+// take returns the work for the final state of each tty in the batch, and the
+// number of events that were coalesced away. A tty that went away and came
+// back within the window is removed before it is added again, so the manager
+// never holds on to stale state for the path.
+func (b *batch) take() ([]*hotplug, int) {
+	var removes, adds []*hotplug
+	var received int
+	for path, p := range b.ports {
+		received += p.received
+		switch p.last.action {
+		case "add":
+			if p.sawRemove {
+				removes = append(removes, &hotplug{action: "remove", path: path})
+			}
+			adds = append(adds, p.last)
+		case "remove":
+			removes = append(removes, p.last)
+		}
+	}
+	b.ports = make(map[string]*pending)
+	sortHotplug(removes)
+	sortHotplug(adds)
+	work := append(removes, adds...)
+	return work, received - len(work)
+}
+
+// Suppressed returns the total number of events that were coalesced away.
+func (d *debouncer) Suppressed() uint64 {
+	return atomic.LoadUint64(&d.suppressed)
+}
+
+// stop drops all queued events. Batches which are already being processed
+// are allowed to finish.
+func (d *debouncer) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stopped = true
+	for k, b := range d.batches {
+		if b.timer != nil {
+			b.timer.Stop()
+		}
+		if !b.running {
+			delete(d.batches, k)
+		}
+	}
+}
+
+// sortHotplug orders events by tty number, the lowest tty of a dongle has to
+// be seen first for the symlink candidate to be picked correctly.
+func sortHotplug(h []*hotplug) {
+	sort.Slice(h, func(i, j int) bool {
+		a, errA := getttyNum(h[i].path)
+		b, errB := getttyNum(h[j].path)
+		if errA != nil || errB != nil {
+			return h[i].path < h[j].path
+		}
+		return a < b
+	})
+}
+
+// usbKey returns the name of the USB device that owns the interface found in
+// devpath, for instance 1-1.3 for
+// /devices/platform/soc/3f980000.usb/usb1/1-1/1-1.3/1-1.3:1.0/ttyUSB0/tty/ttyUSB0
+//
+// devpath is returned as is when it is not below a USB interface.
+func usbKey(devpath string) string {
+	parts := strings.Split(devpath, "/")
+	for i := 1; i < len(parts); i++ {
+		c := strings.IndexByte(parts[i], ':')
+		if c > 0 && parts[i][:c] == parts[i-1] {
+			return parts[i-1]
+		}
+	}
+	return devpath
+}
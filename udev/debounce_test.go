@@ -0,0 +1,111 @@
+package udev
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUSBKey(t *testing.T) {
+	sample := []struct {
+		devpath, key string
+	}{
+		{"/devices/platform/soc/3f980000.usb/usb1/1-1/1-1.3/1-1.3:1.0/ttyUSB0/tty/ttyUSB0", "1-1.3"},
+		{"/devices/pci0000:00/0000:00:14.0/usb2/2-1/2-1:1.2/ttyUSB2/tty/ttyUSB2", "2-1"},
+		{"/devices/virtual/tty/ttyUSB9", "/devices/virtual/tty/ttyUSB9"},
+	}
+	for _, v := range sample {
+		k := usbKey(v.devpath)
+		if k != v.key {
+			t.Errorf("expected %s got %s", v.key, k)
+		}
+	}
+}
+
+func TestDebouncer(t *testing.T) {
+	var mu sync.Mutex
+	var got [][]*hotplug
+	done := make(chan struct{}, 10)
+	d := newDebouncer(50*time.Millisecond, func(key string, work []*hotplug) {
+		mu.Lock()
+		got = append(got, work)
+		mu.Unlock()
+		done <- struct{}{}
+	})
+	defer d.stop()
+	burst := []*hotplug{
+		{action: "add", path: "/dev/ttyUSB1"},
+		{action: "add", path: "/dev/ttyUSB0"},
+		{action: "remove", path: "/dev/ttyUSB0"},
+		{action: "remove", path: "/dev/ttyUSB1"},
+		{action: "add", path: "/dev/ttyUSB0"},
+		{action: "add", path: "/dev/ttyUSB1"},
+		{action: "remove", path: "/dev/ttyUSB2"},
+	}
+	for _, h := range burst {
+		d.push("1-1.3", h)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for settled events")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 1 {
+		t.Fatalf("expected 1 batch got %d", len(got))
+	}
+	expect := []struct{ action, path string }{
+		{"remove", "/dev/ttyUSB0"},
+		{"remove", "/dev/ttyUSB1"},
+		{"remove", "/dev/ttyUSB2"},
+		{"add", "/dev/ttyUSB0"},
+		{"add", "/dev/ttyUSB1"},
+	}
+	if len(got[0]) != len(expect) {
+		t.Fatalf("expected %d events got %d", len(expect), len(got[0]))
+	}
+	for i, v := range expect {
+		if got[0][i].action != v.action || got[0][i].path != v.path {
+			t.Errorf("%d: expected %s %s got %s %s", i,
+				v.action, v.path, got[0][i].action, got[0][i].path)
+		}
+	}
+	if n := d.Suppressed(); n != 2 {
+		t.Errorf("expected 2 suppressed events got %d", n)
+	}
+}
+
+func TestDebouncerSerializes(t *testing.T) {
+	var mu sync.Mutex
+	var running, batches int
+	release := make(chan struct{})
+	d := newDebouncer(10*time.Millisecond, func(key string, work []*hotplug) {
+		mu.Lock()
+		running++
+		if running > 1 {
+			t.Error("concurrent work for the same usb device")
+		}
+		batches++
+		first := batches == 1
+		mu.Unlock()
+		if first {
+			<-release
+		}
+		mu.Lock()
+		running--
+		mu.Unlock()
+	})
+	defer d.stop()
+	d.push("1-1", &hotplug{action: "add", path: "/dev/ttyUSB0"})
+	time.Sleep(50 * time.Millisecond)
+	d.push("1-1", &hotplug{action: "remove", path: "/dev/ttyUSB0"})
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if batches != 2 {
+		t.Errorf("expected 2 batches got %d", batches)
+	}
+}
@@ -7,27 +7,29 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 	"unicode"
 	"unicode/utf8"
 
+	"github.com/FarmRadioHangar/fdevices/config"
 	"github.com/FarmRadioHangar/fdevices/db"
 	"github.com/FarmRadioHangar/fdevices/events"
 	"github.com/FarmRadioHangar/fdevices/log"
+	"github.com/FarmRadioHangar/fdevices/rules"
+	"github.com/FarmRadioHangar/fdevices/schema"
+	"github.com/FarmRadioHangar/fdevices/symlink"
 	"github.com/jochenvg/go-udev"
 	"github.com/tarm/serial"
 )
 
 var modemCommands = struct {
-	IMEI, IMSI string
+	IMEI, IMSI, ICCID, HuaweiICCID string
 }{
-	"AT+GSN", "AT+CIMI",
+	"AT+GSN", "AT+CIMI", "AT+CCID", "AT^ICCID?",
 }
 
 // MaxAttempt is the maximum numbet of attempts to find imsi and imsi
@@ -47,11 +49,67 @@ type Manager struct {
 	monitor *udev.Monitor
 	db      *sql.DB
 	stream  *events.Stream
+	links   *symlink.Manager
+
+	// Ports maps physical USB port locations to friendly names, used for the
+	// Name of the dongle symlinks.
+	Ports map[string]string
+
+	// Labels are set on the dongles with the IMEI used as key, they can be
+	// used by clients to select the events they want.
+	Labels map[string]map[string]string
+
+	// Devices decide which serial devices are probed for a modem, see
+	// config.DeviceRule.
+	Devices []config.DeviceRule
+
+	// Known is where the dongles which got symlinks are remembered, so udev
+	// rules can be written for them. Nothing is remembered when it is nil.
+	Known *rules.Store
+
+	// Settle is how long udev events for a USB device are held before they
+	// are processed. Bursts of add/remove events within this window are
+	// coalesced, only the final state of each tty is acted upon.
+	Settle time.Duration
+
+	// PollInterval is how often the dongles are asked for their signal and
+	// operator, see Poll.
+	PollInterval time.Duration
+
+	hotplug *debouncer
+	health  health
+
+	// ctl holds a lock for every dongle commands were sent to, see lock.
+	ctlMu sync.Mutex
+	ctl   map[string]chan struct{}
+
+	// gone holds the last record of the dongles which were removed by IMEI,
+	// so a SIM swapped while a dongle was away is reported when it returns.
+	goneMu sync.Mutex
+	gone   map[string]*db.Dongle
 }
 
-// New returns a new Manager instance
-func New(db *sql.DB, s *events.Stream) *Manager {
-	return &Manager{stream: s, db: db}
+// New returns a new Manager instance. Symlinks for the dongles are created
+// with l.
+func New(db *sql.DB, s *events.Stream, l *symlink.Manager) *Manager {
+	return &Manager{
+		stream:       s,
+		db:           db,
+		links:        l,
+		Ports:        make(map[string]string),
+		Labels:       make(map[string]map[string]string),
+		Settle:       DefaultSettle,
+		PollInterval: DefaultPollInterval,
+	}
+}
+
+// Suppressed returns the number of udev events which were coalesced away
+// because a newer event for the same tty arrived within the settle window.
+func (m *Manager) Suppressed() uint64 {
+	if m.hotplug == nil {
+		return 0
+	}
+	return m.hotplug.Suppressed()
 }
 
 // Run  initializes the manager. This involves creating a new goroutine to watch
@@ -59,6 +117,9 @@ func New(db *sql.DB, s *events.Stream) *Manager {
 //
 // The only interesting device actions are add and reomove for adding and
 // removing devices respctively.
+//
+// Run returns nil when ctx is done, and an error when the udev monitor can not
+// be started or stops on its own.
 func (m *Manager) Run(ctx context.Context) error {
 	log.Info("running the manager")
 	u := udev.Udev{}
@@ -67,57 +128,97 @@ func (m *Manager) Run(ctx context.Context) error {
 	done := make(chan struct{})
 	ch, err := monitor.DeviceChan(done)
 	if err != nil {
+		m.health.monitor(err)
 		return err
 	}
-	var wg sync.WaitGroup
-	wg.Add(2)
-	go func() {
-	stop:
-		for {
-			select {
-			case <-ctx.Done():
-				done <- struct{}{}
-				log.Info("stopping manager")
-				break stop
+	m.hotplug = newDebouncer(m.Settle, func(key string, work []*hotplug) {
+		m.process(ctx, key, work)
+	})
+	m.health.monitor(nil)
+	log.Info("starting listening for events")
+	for {
+		select {
+		case <-ctx.Done():
+			m.hotplug.stop()
+			close(done)
+			log.Info("stopping manager")
+			m.health.monitor(errStopped)
+			log.Info("exit running manager")
+			return nil
+		case d, ok := <-ch:
+			if !ok {
+				m.hotplug.stop()
+				m.health.monitor(errMonitorClosed)
+				return errMonitorClosed
+			}
+			if !isUSB(d.Devpath()) {
+				continue
 			}
-		}
-		wg.Done()
-	}()
-	go func() {
-		log.Info("starting listening for events")
-		for d := range ch {
 			dpath := filepath.Join("/dev", filepath.Base(d.Devpath()))
+			udevEvents.Add(1, d.Action())
 			switch d.Action() {
-			case "add":
-				log.Info("received add event for %s", dpath)
-				m.AddDevice(ctx, d)
-			case "remove":
-				log.Info("received remove event for %s", dpath)
-				err := m.RemoveDevice(ctx, dpath)
-				if err != nil {
-					log.Error(err.Error())
-				}
+			case "add", "remove":
+				log.Info("received %s event for %s", d.Action(), dpath)
+				m.hotplug.push(usbKey(d.Devpath()), &hotplug{
+					action: d.Action(),
+					path:   dpath,
+					device: d,
+				})
 			}
 		}
-		wg.Done()
-	}()
-	wg.Wait()
-	log.Info("exit running manager")
-	return nil
+	}
+}
 
+// process applies the settled udev events of the USB device key. The work is
+// ordered with removals first, and is never run concurrently for the same USB
+// device.
+func (m *Manager) process(ctx context.Context, key string, work []*hotplug) {
+	log.Info("processing %d settled events for usb device %s (%d suppressed so far)",
+		len(work), key, m.Suppressed(),
+	)
+	for _, h := range work {
+		switch h.action {
+		case "add":
+			err := m.AddDevice(ctx, h.device)
+			if err != nil {
+				log.Error("%s : %s", h.path, err.Error())
+			}
+		case "remove":
+			err := m.RemoveDevice(ctx, h.path)
+			if err != nil {
+				log.Error(err.Error())
+			}
+		}
+	}
 }
 
 // RemoveDevice removes the dongle which has been tracked by the manager
 func (m *Manager) RemoveDevice(ctx context.Context, dpath string) error {
+	if p, err := db.GetPort(m.db, dpath); err == nil {
+		err = db.RemovePort(m.db, dpath)
+		if err != nil {
+			return err
+		}
+		log.Info("removed %s port %s", p.Status, dpath)
+		if p.Status == db.PortPassive {
+			e := events.New(schema.PortRemove, m.portDevice(p), p.Schema())
+			e.Source = schema.SourceUdev
+			m.stream.Send(e)
+		}
+		return nil
+	}
 	d, err := db.GetDongle(m.db, dpath)
 	if err != nil {
 		return nil
 	}
 	c, err := db.GetSymlinkCandidate(m.db, d.IMEI)
 	if err != nil {
-		e := &events.Event{Name: "remove", Data: d}
+		e := events.New(schema.Remove, m.Device(d), d.Schema())
+		e.Source = schema.SourceUdev
 		m.stream.Send(e)
+		m.left(d)
 		log.Info("removed dongle with imei %s", d.IMEI)
+		signalQuality.Delete(d.IMEI)
 		return db.RemoveDongle(m.db, d)
 	}
 	err = db.RemoveDongle(m.db, c)
@@ -152,6 +253,7 @@ func (m *Manager) Startup(ctx context.Context) {
 			log.Divider()
 		}
 	}
+	m.health.start()
 }
 
 func isUSB(name string) bool {
@@ -170,6 +272,10 @@ func (m *Manager) AddDevice(ctx context.Context, d *udev.Device) error {
 	if !isUSB(d.Devpath()) {
 		return nil
 	}
+	dec := decide(m.Devices, d.Properties())
+	if dec.action != config.Probe {
+		return m.skip(d, dec)
+	}
 	err := m.addDevice(ctx, d)
 	if err != nil {
 		return err
@@ -182,7 +288,8 @@ func (m *Manager) addDevice(ctx context.Context, d *udev.Device) error {
 		return err
 	}
 	modem.Properties = d.Properties()
-	e := &events.Event{Name: "add", Data: modem}
+	e := events.New(schema.Add, m.Device(modem), modem.Schema())
+	e.Source = schema.SourceProbe
 	candidate, err := db.GetSymlinkCandidate(m.db, modem.IMEI)
 	if err != nil {
 		if db.DongleExists(m.db, modem) {
@@ -197,6 +304,7 @@ func (m *Manager) addDevice(ctx context.Context, d *udev.Device) error {
 		modem.IMEI, modem.IMSI, modem.Path,
 	)
 	m.stream.Send(e)
+	m.returned(modem)
 	if modem.IMSI == "" {
 		log.Info("skipping processing dongle without imsi")
 		return nil
@@ -204,6 +312,31 @@ func (m *Manager) addDevice(ctx context.Context, d *udev.Device) error {
 	return m.createAdnSym(modem)
 }
 
+// skip records a device which is not probed for a modem, so it can be listed
+// with the reason it was left alone.
+func (m *Manager) skip(d *udev.Device, dec decision) error {
+	p := &db.Port{
+		Path:       filepath.Join("/dev", filepath.Base(d.Devpath())),
+		Status:     db.PortIgnored,
+		Reason:     dec.reason,
+		Properties: d.Properties(),
+	}
+	if dec.action == config.Passive {
+		p.Status = db.PortPassive
+	}
+	log.Info("not probing %s: %s", p.Path, p.Reason)
+	err := db.CreatePort(m.db, p)
+	if err != nil {
+		return err
+	}
+	if p.Status == db.PortPassive {
+		e := events.New(schema.PortAdd, m.portDevice(p), p.Schema())
+		e.Source = schema.SourceUdev
+		m.stream.Send(e)
+	}
+	return nil
+}
+
 // creates a dongle and symlinks it
 func (m *Manager) createAdnSym(modem *db.Dongle) error {
 	err := db.CreateDongle(m.db, modem)
@@ -214,63 +347,213 @@ func (m *Manager) createAdnSym(modem *db.Dongle) error {
 }
 
 func (m *Manager) symlink(d *db.Dongle) {
-	n := fmt.Sprintf("/dev/%s.imei", d.IMEI)
-	_ = syscall.Unlink(n)
-	err := os.Symlink(d.Path, n)
+	names, err := m.links.Link(d.Path, m.linkInfo(d))
+	for _, n := range names {
+		log.Info("symlink: %s --> %s", n, d.Path)
+	}
 	if err != nil {
 		log.Error("symlink :  %v", err)
+	}
+	if len(names) == 0 {
 		return
 	}
-	log.Info("symlink: %s --> %s", n, d.Path)
-	i := fmt.Sprintf("/dev/%s.imsi", d.IMSI)
-	_ = syscall.Unlink(i)
-	err = os.Symlink(d.Path, i)
+	m.remember(d)
+	d.IsSymlinked = true
+	m.update(d, schema.SourceProbe)
+}
+
+// update stores d, and sends an update event with the fields which changed
+// compared to the stored record. Nothing is sent when nothing changed.
+func (m *Manager) update(d *db.Dongle, source schema.Source) {
+	old, err := db.GetDongle(m.db, d.Path)
 	if err != nil {
-		log.Error("ymlinks :  %v", err)
-		_ = syscall.Unlink(n)
+		log.Error(err.Error())
 		return
 	}
-	d.IsSymlinked = true
 	err = db.UpdateDongle(m.db, d)
 	if err != nil {
 		log.Error(err.Error())
-	} else {
-		e := &events.Event{Name: "update", Data: d}
-		m.stream.Send(e)
+		return
+	}
+	stored, err := db.GetDongle(m.db, d.Path)
+	if err != nil {
+		log.Error(err.Error())
+		return
 	}
-	log.Info("symlink: %s --> %s", i, d.Path)
+	changes := schema.Diff(old.Schema(), stored.Schema())
+	if len(changes) == 0 {
+		return
+	}
+	e := events.New(schema.Update, m.Device(stored), stored.Schema())
+	e.Source = source
+	e.Changes = changes
+	m.stream.Send(e)
 }
 
 func (m *Manager) unlink(d *db.Dongle) {
-	n := fmt.Sprintf("/dev/%s.imei", d.IMEI)
-	_ = syscall.Unlink(n)
-	fmt.Printf("device-unlink: %s --> %s\n", n, d.Path)
-	i := fmt.Sprintf("/dev/%s.imsi", d.IMSI)
-	_ = syscall.Unlink(i)
-	fmt.Printf("device-unlink: %s --> %s\n", i, d.Path)
-	e := &events.Event{Name: "remove", Data: d}
+	names, err := m.links.Unlink(d.Path)
+	for _, n := range names {
+		fmt.Printf("device-unlink: %s --> %s\n", n, d.Path)
+	}
+	if err != nil {
+		log.Error("unlink : %v", err)
+	}
+	e := events.New(schema.Remove, m.Device(d), d.Schema())
+	e.Source = schema.SourceUdev
 	m.stream.Send(e)
+	m.left(d)
+	signalQuality.Delete(d.IMEI)
 }
 
-//ClearSymlinks remove all symlinks that wrere created by this aoolication
-func ClearSymlinks() error {
-	return filepath.Walk("/dev", clearSymlink)
+// left keeps the last record of the dongle d, which was removed.
+func (m *Manager) left(d *db.Dongle) {
+	m.goneMu.Lock()
+	if m.gone == nil {
+		m.gone = make(map[string]*db.Dongle)
+	}
+	m.gone[d.IMEI] = d
+	m.goneMu.Unlock()
+}
 
+// returned sends an update for the dongle d which was just added, with the
+// SIM fields which changed since it was removed. Nothing is sent for dongles
+// which are new, or came back with the same SIM.
+func (m *Manager) returned(d *db.Dongle) {
+	m.goneMu.Lock()
+	old, ok := m.gone[d.IMEI]
+	delete(m.gone, d.IMEI)
+	m.goneMu.Unlock()
+	if !ok {
+		return
+	}
+	var changes []schema.Change
+	for _, c := range schema.Diff(old.Schema(), d.Schema()) {
+		if c.Field == "imsi" || c.Field == "iccid" {
+			changes = append(changes, c)
+		}
+	}
+	if len(changes) == 0 {
+		return
+	}
+	log.Info("dongle %s came back with another SIM", d.IMEI)
+	e := events.New(schema.Update, m.Device(d), d.Schema())
+	e.Source = schema.SourceProbe
+	e.Changes = changes
+	m.stream.Send(e)
 }
 
-func clearSymlink(path string, info os.FileInfo, err error) error {
+// remember records the dongle d in m.Known.
+func (m *Manager) remember(d *db.Dongle) {
+	if m.Known == nil {
+		return
+	}
+	err := m.Known.Remember(rules.Dongle{
+		IMEI:   d.IMEI,
+		Serial: d.Properties["ID_SERIAL_SHORT"],
+		Vendor: d.Properties["ID_VENDOR_ID"],
+		Model:  d.Properties["ID_MODEL_ID"],
+		Roles:  roles(d, ttys(d.Properties["ID_SERIAL_SHORT"])),
+	})
 	if err != nil {
-		return err
+		log.Error("remember %s : %v", d.IMEI, err)
+	}
+}
+
+// roles returns the interface numbers of the ttys of the dongle d by role,
+// given the properties of the ttys which may belong to it. The tty of d is
+// the control tty, the other ttys of the same USB device are named after
+// their interface, like if01.
+func roles(d *db.Dongle, ttys []map[string]string) map[string]string {
+	control := d.Properties["ID_USB_INTERFACE_NUM"]
+	o := map[string]string{"control": control}
+	for _, p := range ttys {
+		same := p["ID_SERIAL_SHORT"] == d.Properties["ID_SERIAL_SHORT"] &&
+			p["ID_VENDOR_ID"] == d.Properties["ID_VENDOR_ID"] &&
+			p["ID_MODEL_ID"] == d.Properties["ID_MODEL_ID"]
+		iface := p["ID_USB_INTERFACE_NUM"]
+		if !same || iface == "" || iface == control {
+			continue
+		}
+		o["if"+iface] = iface
 	}
-	if info.IsDir() {
+	return o
+}
+
+// ttys returns the properties of the ttys udev knows with the given
+// ID_SERIAL_SHORT.
+func ttys(serial string) []map[string]string {
+	if serial == "" {
+		return nil
+	}
+	u := udev.Udev{}
+	e := u.NewEnumerate()
+	e.AddMatchSubsystem("tty")
+	e.AddMatchProperty("ID_SERIAL_SHORT", serial)
+	devices, err := e.Devices()
+	if err != nil {
+		log.Error("ttys of %s : %v", serial, err)
 		return nil
 	}
-	e := filepath.Ext(path)
-	if e == ".imei" || e == ".imsi" {
-		log.Info("unlink: %s", path)
-		return syscall.Unlink(path)
+	var o []map[string]string
+	for _, d := range devices {
+		o = append(o, d.Properties())
 	}
-	return nil
+	return o
+}
+
+// Device returns the identity of the dongle d used in events, labeled with
+// the configured labels and the USB port it is plugged into.
+func (m *Manager) Device(d *db.Dongle) schema.Device {
+	dev := d.Device()
+	dev.Labels = make(map[string]string)
+	for k, v := range m.Labels[d.IMEI] {
+		dev.Labels[k] = v
+	}
+	m.portLabels(dev.Labels, d.Properties)
+	return dev
+}
+
+func (m *Manager) portDevice(p *db.Port) schema.Device {
+	dev := schema.Device{Path: p.Path, Labels: make(map[string]string)}
+	m.portLabels(dev.Labels, p.Properties)
+	return dev
+}
+
+// portLabels sets the port and name labels from the USB port of a device.
+func (m *Manager) portLabels(labels, props map[string]string) {
+	port := portLocation(props)
+	if port == "" {
+		return
+	}
+	labels["port"] = port
+	if name := m.Ports[port]; name != "" {
+		labels["name"] = name
+	}
+}
+
+// linkInfo returns the identity of the dongle which the symlink names are
+// rendered with.
+func (m *Manager) linkInfo(d *db.Dongle) symlink.Info {
+	port := portLocation(d.Properties)
+	return symlink.Info{
+		IMEI:  d.IMEI,
+		IMSI:  d.IMSI,
+		ICCID: d.ICCID,
+		Port:  port,
+		Name:  m.Ports[port],
+	}
+}
+
+// portLocation returns the physical USB port of the device with the udev
+// properties props, like 1-1.3. ID_PATH is used when the sysfs devpath is not
+// of a USB device.
+func portLocation(props map[string]string) string {
+	if p := props["DEVPATH"]; p != "" {
+		if k := usbKey(p); k != p {
+			return k
+		}
+	}
+	return props["ID_PATH"]
 }
 
 // Symlink creates symlink for the dongle. The symlinks are for both imei and imsi.
@@ -304,10 +587,13 @@ func FindModem(ctx context.Context, d *udev.Device) (*db.Dongle, error) {
 	start := time.Now()
 	cfg := serial.Config{Name: name, Baud: 9600, ReadTimeout: 5 * time.Second}
 	modem, err := NewModem(ctx, cfg)
+	end := time.Now()
+	probes.Add(1)
+	probeDuration.Observe(end.Sub(start).Seconds())
 	if err != nil {
+		probeFailures.Add(1)
 		return nil, err
 	}
-	end := time.Now()
 	log.Info("found it in %s", end.Sub(start).String())
 	return modem, nil
 }
@@ -332,6 +618,13 @@ func NewModem(ctx context.Context, cfg serial.Config) (*db.Dongle, error) {
 	m.IMEI = imei
 	m.ATI = ati
 	m.IMSI = imsi
+	if imsi != "" {
+		iccid, err := getICCID(cfg)
+		if err != nil {
+			log.Info("iccid: %v", err)
+		}
+		m.ICCID = iccid
+	}
 	m.Path = cfg.Name
 	i, err := getttyNum(m.Path)
 	if err != nil {
@@ -429,6 +722,61 @@ func getIMSI(cfg serial.Config) (string, error) {
 	return im, nil
 }
 
+// getICCID reads the ICCID of the SIM card. Not all modems support AT+CCID,
+// Huawei modems are asked with AT^ICCID? instead.
+func getICCID(cfg serial.Config) (string, error) {
+	c := &Conn{device: cfg}
+	err := c.Open()
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+	o, err := c.Run(modemCommands.ICCID)
+	if err == nil {
+		if id, ok := getICCIDNumber(o, false); ok {
+			return id, nil
+		}
+	}
+	o, err = c.Run(modemCommands.HuaweiICCID)
+	if err != nil {
+		return "", err
+	}
+	id, ok := getICCIDNumber(o, true)
+	if !ok {
+		return "", errors.New("ICCID not found")
+	}
+	return id, nil
+}
+
+// getICCIDNumber extracts the ICCID from responses like
+//
+//	+CCID: 89254021084166237541
+//	^ICCID: 98524012804861325714
+//
+// Huawei modems return the ICCID with the nibbles of each byte swapped, which
+// is undone when swapped is true.
+func getICCIDNumber(src []byte, swapped bool) (string, bool) {
+	i, err := cleanResult(src)
+	if err != nil {
+		return "", false
+	}
+	id := string(i)
+	if c := strings.LastIndex(id, ":"); c != -1 {
+		id = id[c+1:]
+	}
+	id = strings.Trim(strings.TrimSpace(id), "\"")
+	if swapped {
+		b := []byte(id)
+		for k := 0; k+1 < len(b); k += 2 {
+			b[k], b[k+1] = b[k+1], b[k]
+		}
+		id = string(b)
+	}
+	// 19 digit ICCIDs are padded with F
+	id = strings.TrimRight(id, "Ff")
+	return id, isNumber(id)
+}
+
 func getIMSINumber(src []byte) (string, bool) {
 	i, err := cleanResult(src)
 	if err != nil {
@@ -517,6 +865,13 @@ func (c *Conn) Read(b []byte) (int, error) {
 // Exec sends the command over serial port and rrturns the response. If the port
 // is closed it is opened  before sending the command.
 func (c *Conn) Exec(cmd string) ([]byte, error) {
+	start := time.Now()
+	buf, err := c.exec(cmd)
+	observe(c.imei, cmd, start, buf, err)
+	return buf, err
+}
+
+func (c *Conn) exec(cmd string) ([]byte, error) {
 	if !c.isOpen {
 		err := c.Open()
 		if err != nil {
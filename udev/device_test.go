@@ -1,6 +1,14 @@
 package udev
 
-import "testing"
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/FarmRadioHangar/fdevices/db"
+	"github.com/FarmRadioHangar/fdevices/events"
+	"github.com/FarmRadioHangar/fdevices/schema"
+)
 
 func TestGetTtyNumber(t *testing.T) {
 	sample := []struct {
@@ -28,3 +36,120 @@ func TestGetTtyNumber(t *testing.T) {
 //t.Error(err)
 //}
 //}
+
+func TestPortLocation(t *testing.T) {
+	sample := []struct {
+		props map[string]string
+		port  string
+	}{
+		{
+			map[string]string{
+				"DEVPATH": "/devices/platform/soc/3f980000.usb/usb1/1-1/1-1.3/1-1.3:1.0/ttyUSB0/tty/ttyUSB0",
+				"ID_PATH": "platform-3f980000.usb-usb-0:1.3:1.0",
+			},
+			"1-1.3",
+		},
+		{
+			map[string]string{
+				"DEVPATH": "/devices/virtual/tty/ttyUSB9",
+				"ID_PATH": "platform-3f980000.usb-usb-0:1.5:1.0",
+			},
+			"platform-3f980000.usb-usb-0:1.5:1.0",
+		},
+		{map[string]string{}, ""},
+	}
+	for _, v := range sample {
+		port := portLocation(v.props)
+		if port != v.port {
+			t.Errorf("expected %s got %s", v.port, port)
+		}
+	}
+}
+
+func TestRoles(t *testing.T) {
+	tty := func(serial, iface string) map[string]string {
+		return map[string]string{
+			"ID_SERIAL_SHORT":      serial,
+			"ID_VENDOR_ID":         "12d1",
+			"ID_MODEL_ID":          "1001",
+			"ID_USB_INTERFACE_NUM": iface,
+		}
+	}
+	d := &db.Dongle{IMEI: "123", Properties: tty("ABC", "02")}
+	r := roles(d, []map[string]string{
+		tty("ABC", "00"), tty("ABC", "01"), tty("ABC", "02"), tty("DEF", "03"),
+	})
+	expect := map[string]string{"control": "02", "if00": "00", "if01": "01"}
+	if !reflect.DeepEqual(r, expect) {
+		t.Errorf("expected %v got %v", expect, r)
+	}
+}
+
+func TestGetICCIDNumber(t *testing.T) {
+	sample := []struct {
+		src     string
+		swapped bool
+		iccid   string
+	}{
+		{"+CCID: 89254021084166237541\r\n\r\nOK", false, "89254021084166237541"},
+		{"AT+CCID\r\r\n+CCID: \"8925402108416623754F\"\r\n\r\nOK", false, "8925402108416623754"},
+		{"^ICCID: 98520412801466325714\r\n\r\nOK", true, "89254021084166237541"},
+		{"ERROR", false, ""},
+	}
+	for _, v := range sample {
+		id, ok := getICCIDNumber([]byte(v.src), v.swapped)
+		if id != v.iccid {
+			t.Errorf("expected %s got %s", v.iccid, id)
+		}
+		if ok != (v.iccid != "") {
+			t.Errorf("%q: expected %v got %v", v.src, v.iccid != "", ok)
+		}
+	}
+}
+
+func TestReturned(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := events.NewStream(10)
+	s.Start(ctx)
+	sub, err := s.Subscribe(events.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New(nil, s, nil)
+	m.returned(&db.Dongle{IMEI: "123", IMSI: "456"})
+	m.left(&db.Dongle{IMEI: "123", IMSI: "456", ICCID: "789", Path: "/dev/ttyUSB0"})
+	m.returned(&db.Dongle{IMEI: "123", IMSI: "456", ICCID: "789", Path: "/dev/ttyUSB3"})
+	m.left(&db.Dongle{IMEI: "123", IMSI: "456", ICCID: "789"})
+	m.returned(&db.Dongle{IMEI: "123", IMSI: "457", ICCID: "790"})
+	s.Unsubscribe(sub.ID)
+
+	var got []*schema.Event
+	for e := range sub.C {
+		got = append(got, e)
+	}
+	expect := []schema.Change{{Field: "imsi", Old: "456", New: "457"}, {Field: "iccid", Old: "789", New: "790"}}
+	if len(got) != 1 || got[0].Type != schema.Update || !reflect.DeepEqual(got[0].Changes, expect) {
+		t.Errorf("expected only the update of the SIM got %v", got)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	m := New(nil, nil, nil)
+	ctx := context.Background()
+	if m.Started(ctx) == nil || m.Monitoring(ctx) == nil {
+		t.Error("expected a new manager not to be ready")
+	}
+	m.health.start()
+	m.health.monitor(nil)
+	if err := m.Started(ctx); err != nil {
+		t.Error(err)
+	}
+	if err := m.Monitoring(ctx); err != nil {
+		t.Error(err)
+	}
+	m.health.monitor(errMonitorClosed)
+	if err := m.Monitoring(ctx); err != errMonitorClosed {
+		t.Errorf("expected %v got %v", errMonitorClosed, err)
+	}
+}
@@ -0,0 +1,61 @@
+package udev
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var (
+	errStarting      = errors.New("udev: enumerating the devices present at startup")
+	errNotMonitoring = errors.New("udev: the monitor is not running yet")
+	errStopped       = errors.New("udev: the monitor was stopped")
+	errMonitorClosed = errors.New("udev: the monitor stopped unexpectedly")
+)
+
+// health is the state of the manager reported by its readiness checks.
+type health struct {
+	mu      sync.Mutex
+	started bool
+	running bool
+	err     error
+}
+
+func (h *health) start() {
+	h.mu.Lock()
+	h.started = true
+	h.mu.Unlock()
+}
+
+// monitor records the state of the udev monitor, it is running when err is
+// nil.
+func (h *health) monitor(err error) {
+	h.mu.Lock()
+	h.running, h.err = err == nil, err
+	h.mu.Unlock()
+}
+
+// Started returns nil once Startup has gone through the devices which were
+// present when fdevices started.
+func (m *Manager) Started(ctx context.Context) error {
+	m.health.mu.Lock()
+	defer m.health.mu.Unlock()
+	if !m.health.started {
+		return errStarting
+	}
+	return nil
+}
+
+// Monitoring returns nil while Run is listening to udev events, otherwise the
+// reason it is not.
+func (m *Manager) Monitoring(ctx context.Context) error {
+	m.health.mu.Lock()
+	defer m.health.mu.Unlock()
+	if m.health.running {
+		return nil
+	}
+	if m.health.err != nil {
+		return m.health.err
+	}
+	return errNotMonitoring
+}
@@ -0,0 +1,54 @@
+package udev
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/FarmRadioHangar/fdevices/config"
+)
+
+// decision is what is done with a serial device, and why.
+type decision struct {
+	action string
+	reason string
+}
+
+// decide returns what the first rule matching the udev properties props asks
+// for. Devices which do not match any rule are probed.
+func decide(rules []config.DeviceRule, props map[string]string) decision {
+	port := portLocation(props)
+	for i, r := range rules {
+		fields := []struct {
+			name, pattern, value string
+		}{
+			{"vendor", r.Vendor, props["ID_VENDOR_ID"]},
+			{"product", r.Product, props["ID_MODEL_ID"]},
+			{"driver", r.Driver, props["ID_USB_DRIVER"]},
+			{"serial", r.Serial, props["ID_SERIAL"]},
+			{"port", r.Port, port},
+		}
+		matched := true
+		var why []string
+		for _, f := range fields {
+			if f.pattern == "" {
+				continue
+			}
+			ok, err := path.Match(f.pattern, f.value)
+			if err != nil || !ok {
+				matched = false
+				break
+			}
+			why = append(why, fmt.Sprintf("%s=%s", f.name, f.value))
+		}
+		if !matched {
+			continue
+		}
+		reason := r.Reason
+		if reason == "" {
+			reason = fmt.Sprintf("matched device rule %d (%s)", i, strings.Join(why, " "))
+		}
+		return decision{action: r.Action, reason: reason}
+	}
+	return decision{action: config.Probe}
+}
@@ -0,0 +1,51 @@
+package udev
+
+import (
+	"testing"
+
+	"github.com/FarmRadioHangar/fdevices/config"
+)
+
+func TestDecide(t *testing.T) {
+	rules := []config.DeviceRule{
+		{Vendor: "0403", Product: "6001", Action: config.Ignore, Reason: "relay board"},
+		{Driver: "cp210x", Port: "1-1.*", Action: config.Passive},
+		{Serial: "Arduino*", Action: config.Ignore},
+	}
+	devpath := "/devices/platform/soc/3f980000.usb/usb1/1-1/1-1.4/1-1.4:1.0/ttyUSB2/tty/ttyUSB2"
+	sample := []struct {
+		props  map[string]string
+		action string
+		reason string
+	}{
+		{
+			map[string]string{"ID_VENDOR_ID": "0403", "ID_MODEL_ID": "6001"},
+			config.Ignore, "relay board",
+		},
+		{
+			map[string]string{"ID_USB_DRIVER": "cp210x", "DEVPATH": devpath},
+			config.Passive, "matched device rule 1 (driver=cp210x port=1-1.4)",
+		},
+		{
+			map[string]string{"ID_USB_DRIVER": "cp210x"},
+			config.Probe, "",
+		},
+		{
+			map[string]string{"ID_SERIAL": "Arduino__www.arduino.cc__0043_7543"},
+			config.Ignore, "matched device rule 2 (serial=Arduino__www.arduino.cc__0043_7543)",
+		},
+		{
+			map[string]string{"ID_VENDOR_ID": "12d1", "ID_MODEL_ID": "1001"},
+			config.Probe, "",
+		},
+	}
+	for _, v := range sample {
+		d := decide(rules, v.props)
+		if d.action != v.action {
+			t.Errorf("expected %s got %s", v.action, d.action)
+		}
+		if d.reason != v.reason {
+			t.Errorf("expected %q got %q", v.reason, d.reason)
+		}
+	}
+}
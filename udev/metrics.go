@@ -0,0 +1,133 @@
+package udev
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FarmRadioHangar/fdevices/metrics"
+	"github.com/FarmRadioHangar/fdevices/schema"
+)
+
+var (
+	udevEvents = metrics.NewCounter("fdevices_udev_events_total",
+		"udev events received for USB serial devices.", "action")
+	probes = metrics.NewCounter("fdevices_probes_total",
+		"Serial devices probed for a modem.")
+	probeFailures = metrics.NewCounter("fdevices_probe_failures_total",
+		"Probes which found no modem.")
+	probeDuration = metrics.NewHistogram("fdevices_probe_duration_seconds",
+		"Time taken to probe a serial device.", metrics.DurationBuckets)
+	atDuration = metrics.NewHistogram("fdevices_at_command_duration_seconds",
+		"Time taken by AT commands, by command.", metrics.DurationBuckets, "command")
+	atErrors = metrics.NewCounter("fdevices_at_command_errors_total",
+		"AT commands which failed, by command and error.", "command", "code")
+	signalQuality = metrics.NewGauge("fdevices_signal_quality",
+		"The RSSI reported by AT+CSQ, from 0 to 31.", "imei")
+)
+
+// atName returns the name of the AT command in cmd, without its arguments,
+// like AT+CMGS for AT+CMGS="+255...".
+func atName(cmd string) string {
+	cmd = strings.TrimSpace(cmd)
+	if i := strings.IndexAny(cmd, "=?\r\n\x1a"); i >= 0 {
+		cmd = cmd[:i]
+	}
+	if len(cmd) > 16 {
+		cmd = cmd[:16]
+	}
+	return strings.ToUpper(cmd)
+}
+
+var atError = regexp.MustCompile(`\+(CME|CMS) ERROR: *(\d+)`)
+
+// atErrorCode returns a short description of the response of a failed
+// command, like CME:10 for +CME ERROR: 10.
+func atErrorCode(res string) string {
+	if m := atError.FindStringSubmatch(res); m != nil {
+		return m[1] + ":" + m[2]
+	}
+	switch {
+	case strings.TrimSpace(res) == "":
+		return "timeout"
+	case strings.Contains(res, "ERROR"):
+		return "ERROR"
+	}
+	return "other"
+}
+
+var csq = regexp.MustCompile(`\+CSQ: *(\d+)`)
+
+// signal returns the RSSI in the reply to AT+CSQ. It returns false when the
+// reply has none, or the dongle does not know it.
+func signal(res []byte) (int, bool) {
+	m := csq.FindSubmatch(res)
+	if m == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(string(m[1]))
+	if err != nil || n == 99 {
+		return 0, false
+	}
+	return n, true
+}
+
+var cops = regexp.MustCompile(`\+COPS: *\d+(?:,\d+,"([^"]*)")?`)
+
+// operator returns the operator in the reply to AT+COPS?, which is empty when
+// the dongle is not registered. It returns false when the reply has none.
+func operator(res []byte) (string, bool) {
+	m := cops.FindSubmatch(res)
+	if m == nil {
+		return "", false
+	}
+	return string(m[1]), true
+}
+
+var cpin = regexp.MustCompile(`\+CPIN: *([^\r\n]+)`)
+
+// sim returns the state of the SIM in the reply to AT+CPIN?, or in the error
+// it failed with when there is no SIM. It returns false when neither tells.
+func sim(res []byte, err error) (string, bool) {
+	if err != nil {
+		if atErrorCode(err.Error()) == "CME:10" || strings.Contains(strings.ToUpper(err.Error()), "SIM NOT INSERTED") {
+			return schema.SIMAbsent, true
+		}
+		return "", false
+	}
+	m := cpin.FindSubmatch(res)
+	if m == nil {
+		return "", false
+	}
+	switch v := strings.TrimSpace(string(m[1])); v {
+	case "READY":
+		return schema.SIMReady, true
+	case "SIM PIN":
+		return schema.SIMPIN, true
+	case "SIM PUK":
+		return schema.SIMPUK, true
+	default:
+		return strings.ToLower(v), true
+	}
+}
+
+// observe records the outcome of the AT command cmd which took since start.
+// A successful AT+CSQ sets the signal quality of the dongle imei.
+func observe(imei, cmd string, start time.Time, res []byte, err error) {
+	name := atName(cmd)
+	atDuration.Observe(time.Since(start).Seconds(), name)
+	if err != nil {
+		atErrors.Add(1, name, atErrorCode(err.Error()))
+		return
+	}
+	if name != "AT+CSQ" || imei == "" {
+		return
+	}
+	if n, ok := signal(res); ok {
+		signalQuality.Set(float64(n), imei)
+	} else if csq.Match(res) {
+		// 99, the dongle does not know
+		signalQuality.Delete(imei)
+	}
+}
@@ -0,0 +1,111 @@
+package udev
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/FarmRadioHangar/fdevices/metrics"
+	"github.com/FarmRadioHangar/fdevices/schema"
+)
+
+func TestATName(t *testing.T) {
+	sample := []struct {
+		cmd, name string
+	}{
+		{"AT+CMGS=\"+255\"\rhello\x1a", "AT+CMGS"},
+		{"at+csq\r\n", "AT+CSQ"},
+		{"AT+COPS?", "AT+COPS"},
+		{"ATI", "ATI"},
+	}
+	for _, v := range sample {
+		if n := atName(v.cmd); n != v.name {
+			t.Errorf("%q: expected %s got %s", v.cmd, v.name, n)
+		}
+	}
+}
+
+func TestATErrorCode(t *testing.T) {
+	sample := []struct {
+		res, code string
+	}{
+		{"AT+CMGS\r\n+CMS ERROR: 330", "CMS:330"},
+		{"+CME ERROR: 10", "CME:10"},
+		{"ERROR", "ERROR"},
+		{"", "timeout"},
+		{"garbage", "other"},
+	}
+	for _, v := range sample {
+		if c := atErrorCode(v.res); c != v.code {
+			t.Errorf("%q: expected %s got %s", v.res, v.code, c)
+		}
+	}
+}
+
+func family(name string) *metrics.Family {
+	for _, f := range metrics.Collect() {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func TestReplies(t *testing.T) {
+	if n, ok := signal([]byte("+CSQ: 17,99\r\n\r\nOK")); !ok || n != 17 {
+		t.Errorf("expected 17 got %d %v", n, ok)
+	}
+	if _, ok := signal([]byte("+CSQ: 99,99\r\n\r\nOK")); ok {
+		t.Error("expected an unknown signal")
+	}
+	if op, ok := operator([]byte("+COPS: 0,0,\"Vodacom TZ\",2\r\n\r\nOK")); !ok || op != "Vodacom TZ" {
+		t.Errorf("expected Vodacom TZ got %q %v", op, ok)
+	}
+	if op, ok := operator([]byte("+COPS: 0\r\n\r\nOK")); !ok || op != "" {
+		t.Errorf("expected no operator got %q %v", op, ok)
+	}
+	if _, ok := operator([]byte("OK")); ok {
+		t.Error("expected no reply to AT+COPS?")
+	}
+	sample := []struct {
+		res   string
+		err   error
+		state string
+		ok    bool
+	}{
+		{"+CPIN: READY\r\n\r\nOK", nil, schema.SIMReady, true},
+		{"+CPIN: SIM PIN\r\n\r\nOK", nil, schema.SIMPIN, true},
+		{"", errors.New("+CME ERROR: 10"), schema.SIMAbsent, true},
+		{"", errors.New("+CME ERROR: SIM not inserted"), schema.SIMAbsent, true},
+		{"", errors.New(""), "", false},
+		{"OK", nil, "", false},
+	}
+	for _, v := range sample {
+		if state, ok := sim([]byte(v.res), v.err); state != v.state || ok != v.ok {
+			t.Errorf("%q %v: expected %q %v got %q %v", v.res, v.err, v.state, v.ok, state, ok)
+		}
+	}
+	for err, h := range map[error]string{
+		nil:                         schema.HealthOK,
+		errors.New("+CMS ERROR: 1"): schema.HealthOK,
+		errors.New(""):              healthTimeout,
+		errors.New("write: EIO"):    healthError,
+	} {
+		if v := healthOf(err); v != h {
+			t.Errorf("%v: expected %s got %s", err, h, v)
+		}
+	}
+}
+
+func TestObserveSignal(t *testing.T) {
+	observe("123", "AT+CSQ\r\n", time.Now(), []byte("+CSQ: 17,99\r\n\r\nOK"), nil)
+	f := family("fdevices_signal_quality")
+	if len(f.Samples) != 1 || f.Samples[0].Value != 17 {
+		t.Errorf("expected a signal of 17 got %v", f.Samples)
+	}
+	observe("123", "AT+CSQ\r\n", time.Now(), nil, errors.New("ERROR"))
+	observe("123", "AT+CSQ\r\n", time.Now(), []byte("+CSQ: 99,99\r\n\r\nOK"), nil)
+	if f = family("fdevices_signal_quality"); len(f.Samples) != 0 {
+		t.Errorf("expected an unknown signal got %v", f.Samples)
+	}
+}
@@ -0,0 +1,118 @@
+package udev
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/FarmRadioHangar/fdevices/control"
+	"github.com/FarmRadioHangar/fdevices/db"
+	"github.com/FarmRadioHangar/fdevices/log"
+	"github.com/FarmRadioHangar/fdevices/schema"
+)
+
+// DefaultPollInterval is how often the dongles are asked for their SIM state,
+// signal and operator by default.
+const DefaultPollInterval = time.Minute
+
+// Health of a dongle which did not answer a poll, see schema.Dongle.
+const (
+	// healthTimeout is a dongle which did not reply in time.
+	healthTimeout = "timeout"
+
+	// healthError is a dongle whose tty can not be opened or written.
+	healthError = "error"
+)
+
+// pollCommands are sent to every dongle by Poll, their replies are stored by
+// report.
+var pollCommands = []string{"AT+CPIN?", "AT+CSQ", "AT+COPS?"}
+
+// Poll asks every dongle for its SIM state, signal and operator every
+// PollInterval, until ctx is done, and records whether it answered as its
+// health. Changes are sent as updates from the poller, and the signal is kept
+// in the fdevices_signal_quality metric. Nothing is polled when PollInterval
+// is zero.
+func (m *Manager) Poll(ctx context.Context) {
+	if m.PollInterval <= 0 {
+		return
+	}
+	t := time.NewTicker(m.PollInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		all, err := db.GetDistinct(m.db)
+		if err != nil {
+			log.Error("poll: %v", err)
+			continue
+		}
+		var wg sync.WaitGroup
+		for _, d := range all {
+			wg.Add(1)
+			go func(imei string) {
+				defer wg.Done()
+				m.poll(ctx, imei)
+			}(d.IMEI)
+		}
+		wg.Wait()
+	}
+}
+
+// poll runs pollCommands on the dongle imei. A dongle kept busy by other
+// commands for a whole interval is left for the next poll.
+func (m *Manager) poll(ctx context.Context, imei string) {
+	ctx, cancel := context.WithTimeout(ctx, m.PollInterval)
+	defer cancel()
+	c, done, err := m.conn(ctx, imei)
+	if err != nil {
+		if ctx.Err() == nil && err != control.ErrUnknownDongle {
+			log.Error("poll %s: %v", imei, err)
+			m.setHealth(imei, healthError)
+		}
+		return
+	}
+	var h string
+	for _, cmd := range pollCommands {
+		o, err := c.Run(cmd)
+		if err != nil {
+			log.Error("poll %s: %s: %v", imei, cmd, err)
+		}
+		m.report(imei, cmd, o, err, schema.SourcePoller)
+		if h != schema.HealthOK {
+			h = healthOf(err)
+		}
+	}
+	done()
+	m.setHealth(imei, h)
+}
+
+// healthOf returns the health of a dongle whose reply to a command failed with
+// err. A dongle replying with an error still answers.
+func healthOf(err error) string {
+	if err == nil {
+		return schema.HealthOK
+	}
+	switch atErrorCode(err.Error()) {
+	case "timeout":
+		return healthTimeout
+	case "other":
+		return healthError
+	}
+	return schema.HealthOK
+}
+
+// setHealth stores the health h of the dongle imei, and sends an update from
+// the poller when it changed.
+func (m *Manager) setHealth(imei, h string) {
+	d, err := db.GetSymlinkCandidate(m.db, imei)
+	if err != nil {
+		log.Error("poll %s: %v", imei, err)
+		return
+	}
+	d.Health = h
+	m.update(d, schema.SourcePoller)
+}
@@ -0,0 +1,21 @@
+package udev
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPollDisabled(t *testing.T) {
+	m := &Manager{}
+	done := make(chan struct{})
+	go func() {
+		m.Poll(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("expected no polling without an interval")
+	}
+}
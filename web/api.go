@@ -0,0 +1,236 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/FarmRadioHangar/fdevices/control"
+	"github.com/FarmRadioHangar/fdevices/db"
+	"github.com/FarmRadioHangar/fdevices/events"
+	"github.com/FarmRadioHangar/fdevices/schema"
+	"github.com/gernest/alien"
+)
+
+// CommandTimeout is how long a command sent with PostCommand is given to
+// complete.
+const CommandTimeout = time.Minute
+
+// ListDongles lists the dongles as a JSON array. It takes the filter
+// parameters of GetDongles, except for type.
+func ListDongles(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, schema.CodeBadRequest, err.Error())
+		return
+	}
+	all, ok := dongles(w, r)
+	if !ok {
+		return
+	}
+	opts := options(r.Context())
+	o := []*schema.Dongle{}
+	for _, d := range all {
+		if f.MatchDevice(opts.device(d)) {
+			o = append(o, opts.resource(d))
+		}
+	}
+	writeJSON(w, r, o)
+}
+
+// GetDongle returns the dongle with the id given in the path. The id is
+// matched against the IMEI, IMSI and ICCID of the dongles. An id holding = is
+// a label selector like port=1-1.3,name=news, which must match a single
+// dongle.
+func GetDongle(w http.ResponseWriter, r *http.Request) {
+	id := alien.GetParams(r).Get("id")
+	all, ok := dongles(w, r)
+	if !ok {
+		return
+	}
+	opts := options(r.Context())
+	found, err := opts.find(all, id)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, schema.CodeBadRequest, err.Error())
+		return
+	}
+	switch len(found) {
+	case 0:
+		writeError(w, http.StatusNotFound, schema.CodeNotFound,
+			fmt.Sprintf("no dongle matches %s", id))
+	case 1:
+		writeJSON(w, r, opts.resource(found[0]))
+	default:
+		writeError(w, http.StatusConflict, schema.CodeAmbiguous,
+			fmt.Sprintf("%d dongles match %s", len(found), id))
+	}
+}
+
+// find returns the dongles matching id, see GetDongle. An IMSI or ICCID can
+// be reported by more than one dongle, every one of them is returned so the
+// caller can refuse the ambiguous id. Label selectors are matched against the
+// devices of o.
+func (o Options) find(all []*db.Dongle, id string) ([]*db.Dongle, error) {
+	var found []*db.Dongle
+	if strings.Contains(id, "=") {
+		l, err := events.ParseSelector(id)
+		if err != nil {
+			return nil, err
+		}
+		f := &events.Filter{Labels: l}
+		for _, d := range all {
+			if f.MatchDevice(o.device(d)) {
+				found = append(found, d)
+			}
+		}
+		return found, nil
+	}
+	for _, d := range all {
+		if d.IMEI == id || d.IMSI == id || d.ICCID == id {
+			found = append(found, d)
+		}
+	}
+	return found, nil
+}
+
+// PostCommand returns a handler running the command named in the path on the
+// dongle with the id in the path, which is looked up like in GetDongle. The
+// body is a schema.Command, the response a schema.Result.
+func PostCommand(ctl control.Controller) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := alien.GetParams(r)
+		id, name := p.Get("id"), p.Get("name")
+		var cmd schema.Command
+		err := json.NewDecoder(r.Body).Decode(&cmd)
+		if err != nil && err != io.EOF {
+			writeError(w, http.StatusBadRequest, schema.CodeBadRequest, err.Error())
+			return
+		}
+		all, ok := dongles(w, r)
+		if !ok {
+			return
+		}
+		found, err := options(r.Context()).find(all, id)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, schema.CodeBadRequest, err.Error())
+			return
+		}
+		switch len(found) {
+		case 0:
+			writeError(w, http.StatusNotFound, schema.CodeNotFound,
+				fmt.Sprintf("no dongle matches %s", id))
+			return
+		case 1:
+		default:
+			writeError(w, http.StatusConflict, schema.CodeAmbiguous,
+				fmt.Sprintf("%d dongles match %s", len(found), id))
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), CommandTimeout)
+		defer cancel()
+		out, err := control.Run(ctx, ctl, found[0].IMEI, name, &cmd)
+		if err != nil {
+			status, code := http.StatusBadGateway, schema.CodeCommandFailed
+			if _, ok := err.(control.UnknownCommandError); ok || err == control.ErrUnknownDongle {
+				status, code = http.StatusNotFound, schema.CodeNotFound
+			}
+			writeError(w, status, code, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(&schema.Result{ID: cmd.ID, OK: true, Output: out})
+	}
+}
+
+// ListPorts lists the serial devices which were not probed for a modem as a
+// JSON array.
+func ListPorts(w http.ResponseWriter, r *http.Request) {
+	ql, ok := r.Context().Value(db.CtxKey).(*sql.DB)
+	if !ok {
+		writeError(w, http.StatusServiceUnavailable, schema.CodeUnavailable, "database not available")
+		return
+	}
+	ports, err := db.GetAllPorts(ql)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, schema.CodeInternal, err.Error())
+		return
+	}
+	o := []*schema.Port{}
+	for _, p := range ports {
+		o = append(o, p.Schema())
+	}
+	writeJSON(w, r, o)
+}
+
+// dongles returns the dongles ordered by IMEI, one per IMEI. An error
+// response is written when they can not be loaded.
+func dongles(w http.ResponseWriter, r *http.Request) ([]*db.Dongle, bool) {
+	ql, ok := r.Context().Value(db.CtxKey).(*sql.DB)
+	if !ok {
+		writeError(w, http.StatusServiceUnavailable, schema.CodeUnavailable, "database not available")
+		return nil, false
+	}
+	all, err := db.GetDistinct(ql)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, schema.CodeInternal, err.Error())
+		return nil, false
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].IMEI < all[j].IMEI })
+	return all, true
+}
+
+// resource returns d as it is sent to clients, with the labels of its device.
+func (o Options) resource(d *db.Dongle) *schema.Dongle {
+	v := d.Schema()
+	v.Labels = o.device(d).Labels
+	return v
+}
+
+// writeJSON writes v with an ETag computed from its encoding. Nothing but the
+// status is written when the request has a matching If-None-Match.
+func writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, schema.CodeInternal, err.Error())
+		return
+	}
+	sum := sha256.Sum256(b)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	h := w.Header()
+	h.Set("ETag", etag)
+	h.Set("Cache-Control", "no-cache")
+	if match(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h.Set("Content-Type", "application/json")
+	_, _ = w.Write(append(b, '\n'))
+}
+
+// match returns true when the If-None-Match header value inm holds etag.
+func match(inm, etag string) bool {
+	for _, v := range strings.Split(inm, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	var buf bytes.Buffer
+	_ = json.NewEncoder(&buf).Encode(&schema.Error{Status: status, Code: code, Message: msg})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(buf.Bytes())
+}
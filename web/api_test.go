@@ -0,0 +1,151 @@
+package web
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/FarmRadioHangar/fdevices/db"
+	"github.com/FarmRadioHangar/fdevices/db/dbtest"
+	"github.com/FarmRadioHangar/fdevices/events"
+	"github.com/FarmRadioHangar/fdevices/schema"
+)
+
+// testDB returns the database shared by the tests, with two dongles and a
+// port.
+func testDB(t *testing.T) *sql.DB {
+	return dbtest.DB(t, []*db.Dongle{
+		{IMEI: "123", IMSI: "456", Path: "/dev/ttyUSB0", TTY: 0},
+		{IMEI: "124", IMSI: "457", ICCID: "890", Path: "/dev/ttyUSB3", TTY: 3},
+	}, []*db.Port{
+		{Path: "/dev/ttyUSB9", Status: db.PortPassive, Reason: "gps"},
+	})
+}
+
+func get(t *testing.T, url, etag string, v interface{}) *http.Response {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if v != nil && res.StatusCode != http.StatusNotModified {
+		err = json.NewDecoder(res.Body).Decode(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return res
+}
+
+func TestAPI(t *testing.T) {
+	ts := httptest.NewServer(New(testDB(t), events.NewStream(10), Options{}))
+	defer ts.Close()
+
+	var list []*schema.Dongle
+	res := get(t, ts.URL+"/api/v1/dongles", "", &list)
+	if res.StatusCode != http.StatusOK || len(list) != 2 {
+		t.Fatalf("expected 2 dongles got %d %v", res.StatusCode, list)
+	}
+	etag := res.Header.Get("ETag")
+	if etag == "" {
+		t.Error("expected an ETag")
+	}
+	if res = get(t, ts.URL+"/api/v1/dongles", etag, nil); res.StatusCode != http.StatusNotModified {
+		t.Errorf("expected %d got %d", http.StatusNotModified, res.StatusCode)
+	}
+	res = get(t, ts.URL+"/api/v1/dongles?imsi=457", "", &list)
+	if len(list) != 1 || list[0].IMEI != "124" {
+		t.Errorf("expected dongle 124 got %v", list)
+	}
+
+	for _, id := range []string{"124", "457", "890"} {
+		var d schema.Dongle
+		res = get(t, ts.URL+"/api/v1/dongles/"+id, "", &d)
+		if res.StatusCode != http.StatusOK || d.IMEI != "124" {
+			t.Errorf("%s: expected dongle 124 got %d %v", id, res.StatusCode, d)
+		}
+	}
+	var e schema.Error
+	res = get(t, ts.URL+"/api/v1/dongles/999", "", &e)
+	if res.StatusCode != http.StatusNotFound || e.Code != schema.CodeNotFound {
+		t.Errorf("expected not found got %d %v", res.StatusCode, e)
+	}
+
+	labelled := httptest.NewServer(New(testDB(t), events.NewStream(10), Options{
+		DeviceOf: func(d *db.Dongle) schema.Device {
+			dev := d.Device()
+			dev.Labels = map[string]string{"site": "studio", "port": d.IMEI}
+			return dev
+		},
+	}))
+	defer labelled.Close()
+	var d schema.Dongle
+	res = get(t, labelled.URL+"/api/v1/dongles/site=studio,port=123", "", &d)
+	if res.StatusCode != http.StatusOK || d.IMEI != "123" || d.Labels["site"] != "studio" {
+		t.Errorf("expected dongle 123 got %d %v", res.StatusCode, d)
+	}
+	e = schema.Error{}
+	res = get(t, labelled.URL+"/api/v1/dongles/site=studio", "", &e)
+	if res.StatusCode != http.StatusConflict || e.Code != schema.CodeAmbiguous {
+		t.Errorf("expected conflict got %d %v", res.StatusCode, e)
+	}
+
+	var ports []*schema.Port
+	res = get(t, ts.URL+"/api/v1/ports", "", &ports)
+	if res.StatusCode != http.StatusOK || len(ports) != 1 || ports[0].Reason != "gps" {
+		t.Errorf("unexpected ports %d %v", res.StatusCode, ports)
+	}
+}
+
+func TestFind(t *testing.T) {
+	all := []*db.Dongle{
+		{IMEI: "123", IMSI: "456", ICCID: "890"},
+		{IMEI: "124", IMSI: "456", ICCID: "891"},
+	}
+	for id, n := range map[string]int{"123": 1, "891": 1, "456": 2, "999": 0} {
+		found, err := Options{}.find(all, id)
+		if err != nil || len(found) != n {
+			t.Errorf("%s: expected %d dongles got %v %v", id, n, found, err)
+		}
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	ts := httptest.NewServer(New(testDB(t), events.NewStream(10), Options{}))
+	defer ts.Close()
+	var doc struct {
+		OpenAPI string                 `json:"openapi"`
+		Paths   map[string]interface{} `json:"paths"`
+	}
+	res := get(t, ts.URL+"/api/openapi.json", "", &doc)
+	if res.StatusCode != http.StatusOK || doc.OpenAPI == "" {
+		t.Fatalf("unexpected document %d %v", res.StatusCode, doc)
+	}
+	for _, p := range []string{"/api/v1/dongles", "/api/v1/dongles/{id}", "/api/v1/ports", "/api/events"} {
+		if _, ok := doc.Paths[p]; !ok {
+			t.Errorf("expected %s to be documented", p)
+		}
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	ts := httptest.NewServer(New(testDB(t), events.NewStream(10), Options{}))
+	defer ts.Close()
+	res, err := http.Get(ts.URL + "/ui")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); res.StatusCode != http.StatusOK || ct != "text/html; charset=utf-8" {
+		t.Errorf("expected a page got %d %s", res.StatusCode, ct)
+	}
+}
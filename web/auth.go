@@ -0,0 +1,81 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/FarmRadioHangar/fdevices/auth"
+	"github.com/FarmRadioHangar/fdevices/control"
+	"github.com/FarmRadioHangar/fdevices/schema"
+)
+
+// checkOrigin allows the websockets opened from the origins of the options
+// put on the request by PrepCtx.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// not a browser
+		return true
+	}
+	for _, v := range options(r.Context()).Origins {
+		if v == "*" || strings.EqualFold(strings.TrimSuffix(v, "/"), origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// Scope returns the scope a request needs. Commands need the sms or control
+// scope, the subscribers and webhook deliveries need the admin scope, and
+// everything else the read scope. The health checks need none, so probes work
+// without credentials.
+func Scope(r *http.Request) string {
+	p := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/healthz" || r.URL.Path == "/readyz":
+		return ""
+	case len(p) == 6 && p[0] == "api" && p[1] == "v1" && p[2] == "dongles" && p[4] == "commands":
+		if p[5] == control.SMS {
+			return auth.SMS
+		}
+		return auth.Control
+	case r.URL.Path == "/subscribers" || r.URL.Path == "/api/v1/webhooks/deliveries":
+		return auth.Admin
+	}
+	return auth.Read
+}
+
+// Auth returns h with every request authenticated by o.Auth, and checked
+// against the scope it needs. The identity of the client is put on the request
+// context. The requests which need no scope are let through, and so is every
+// request when o.Auth is nil. The client is then anonymous, and can only run
+// commands when o.Commands is set.
+func Auth(o Options, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, scope := o.anonymous(), Scope(r)
+		switch {
+		case o.Auth != nil && scope != "":
+			var err error
+			id, err = o.Auth.Authenticate(r)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Basic realm="fdevices"`)
+				writeError(w, http.StatusUnauthorized, schema.CodeUnauthorized, err.Error())
+				return
+			}
+		case scope == auth.Admin:
+			// without authentication the admin routes, which only read,
+			// are as open as the others
+			scope = auth.Read
+		}
+		if !id.Allowed(scope) {
+			writeError(w, http.StatusForbidden, schema.CodeForbidden, "missing scope "+scope)
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), id)))
+	})
+}
@@ -0,0 +1,114 @@
+package web
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/FarmRadioHangar/fdevices/auth"
+	"github.com/FarmRadioHangar/fdevices/db"
+	"github.com/FarmRadioHangar/fdevices/events"
+	"github.com/gorilla/websocket"
+)
+
+type nopController struct{}
+
+func (nopController) SendSMS(ctx context.Context, imei, number, text string) error { return nil }
+
+func (nopController) RunAT(ctx context.Context, imei, cmd string) (string, error) { return "", nil }
+
+func (nopController) Reset(ctx context.Context, imei string) error { return nil }
+
+func TestAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a := &auth.Authenticator{Tokens: auth.NewStore(filepath.Join(dir, "tokens.json"))}
+	_, reader, err := a.Tokens.Create("reader", []string{auth.Read})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, sms, err := a.Tokens.Create("sms", []string{auth.SMS})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(New(testDB(t), events.NewStream(10), Options{Commands: nopController{}, Auth: a}))
+	defer ts.Close()
+	m := New(testDB(t), events.NewStream(10), Options{})
+	m.Get("/api/v1/webhooks/deliveries", func(w http.ResponseWriter, r *http.Request) {})
+	anonymous := httptest.NewServer(m)
+	defer anonymous.Close()
+
+	sample := []struct {
+		server              *httptest.Server
+		method, path, token string
+		status              int
+	}{
+		{ts, "GET", "/api/v1/dongles", "", http.StatusUnauthorized},
+		{ts, "GET", "/api/v1/dongles", "wrong", http.StatusUnauthorized},
+		{ts, "GET", "/api/v1/dongles", reader, http.StatusOK},
+		{ts, "GET", "/api/v1/dongles", sms, http.StatusForbidden},
+		{ts, "GET", "/subscribers", reader, http.StatusForbidden},
+		{ts, "POST", "/api/v1/dongles/123/commands/reset", reader, http.StatusForbidden},
+		{ts, "POST", "/api/v1/dongles/123/commands/reset", sms, http.StatusForbidden},
+		{ts, "POST", "/api/v1/dongles/123/commands/sms", sms, http.StatusOK},
+		{ts, "GET", "/healthz", "", http.StatusOK},
+		{anonymous, "GET", "/api/v1/dongles", "", http.StatusOK},
+		{anonymous, "GET", "/subscribers", "", http.StatusOK},
+		{anonymous, "GET", "/api/v1/webhooks/deliveries", "", http.StatusOK},
+		{anonymous, "POST", "/api/v1/dongles/123/commands/sms", "", http.StatusNotFound},
+	}
+	for _, v := range sample {
+		req, _ := http.NewRequest(v.method, v.server.URL+v.path, strings.NewReader("{}"))
+		if v.token != "" {
+			req.Header.Set("Authorization", "Bearer "+v.token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != v.status {
+			t.Errorf("%s %s: expected %d got %d", v.method, v.path, v.status, res.StatusCode)
+		}
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	s := events.NewStream(10)
+	ts := httptest.NewServer(New(testDB(t), s, Options{}))
+	defer ts.Close()
+	allowed := httptest.NewServer(New(testDB(t), s, Options{Origins: []string{"http://example.com"}}))
+	defer allowed.Close()
+	dial := func(ts *httptest.Server, origin string) bool {
+		u := "ws" + strings.TrimPrefix(ts.URL, "http") + "/"
+		h := http.Header{}
+		h.Set("Origin", origin)
+		c, _, err := websocket.DefaultDialer.Dial(u, h)
+		if err != nil {
+			return false
+		}
+		// let the connection end before the next one
+		var dongles []*db.Dongle
+		_ = c.ReadJSON(&dongles)
+		c.Close()
+		waitSubscribers(t, s, 0)
+		return true
+	}
+	if !dial(ts, ts.URL) {
+		t.Error("expected the same origin to be allowed")
+	}
+	if dial(ts, "http://example.com") {
+		t.Error("expected another origin to be refused")
+	}
+	if !dial(allowed, "http://example.com") {
+		t.Error("expected a configured origin to be allowed")
+	}
+}
@@ -0,0 +1,204 @@
+package web
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/FarmRadioHangar/fdevices/auth"
+	"github.com/FarmRadioHangar/fdevices/events"
+	"github.com/FarmRadioHangar/fdevices/metrics"
+	"github.com/FarmRadioHangar/fdevices/schema"
+	"github.com/gorilla/websocket"
+)
+
+// PingInterval is how often websocket clients are pinged. A client which
+// sends nothing, not even the pong, for two intervals is disconnected.
+var PingInterval = 30 * time.Second
+
+// writeWait is how long a single write to a websocket may take.
+const writeWait = 10 * time.Second
+
+// maxMessage is the size of the largest message accepted from a client.
+const maxMessage = 64 * 1024
+
+var errClosed = errors.New("web: connection closed")
+
+var (
+	wsClients = metrics.NewGauge("fdevices_websocket_clients",
+		"Connected websocket clients.")
+	wsConnections = metrics.NewCounter("fdevices_websocket_connections_total",
+		"Websocket connections accepted.")
+)
+
+// conn is a websocket connection. Only its writer goroutine writes to the
+// websocket, everything else queues messages with write.
+type conn struct {
+	ws     *websocket.Conn
+	ql     *sql.DB
+	stream *events.Stream
+	opts   Options
+	id     *auth.Identity
+
+	out  chan interface{}
+	done chan struct{}
+	once sync.Once
+
+	mu   sync.Mutex
+	subs map[string]*events.Subscription
+	wg   sync.WaitGroup
+}
+
+// newConn returns the connection of ws and starts its writer. The options and
+// identity of the client are taken from ctx.
+func newConn(ctx context.Context, ws *websocket.Conn, ql *sql.DB, stream *events.Stream) *conn {
+	opts := options(ctx)
+	id := auth.FromContext(ctx)
+	if id == nil {
+		id = opts.anonymous()
+	}
+	c := &conn{
+		ws:     ws,
+		ql:     ql,
+		stream: stream,
+		opts:   opts,
+		id:     id,
+		out:    make(chan interface{}),
+		done:   make(chan struct{}),
+		subs:   make(map[string]*events.Subscription),
+	}
+	wsClients.Add(1)
+	wsConnections.Add(1)
+	go c.writer()
+	return c
+}
+
+// write queues v to be sent as JSON. It blocks until the writer takes it, so
+// the subscriptions of a slow client fill up and their policy applies.
+func (c *conn) write(v interface{}) error {
+	select {
+	case c.out <- v:
+		return nil
+	case <-c.done:
+		return errClosed
+	}
+}
+
+// writer sends the queued messages and pings the client, until the
+// connection is shut down or a write fails.
+func (c *conn) writer() {
+	tick := time.NewTicker(PingInterval)
+	defer tick.Stop()
+	for {
+		var err error
+		select {
+		case <-c.done:
+			return
+		case v := <-c.out:
+			_ = c.ws.SetWriteDeadline(time.Now().Add(writeWait))
+			err = c.ws.WriteJSON(v)
+		case <-tick.C:
+			err = c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+		}
+		if err != nil {
+			c.shutdown(websocket.CloseAbnormalClosure, "")
+			return
+		}
+	}
+}
+
+// shutdown tells the client why the connection ends, when code is not
+// CloseAbnormalClosure, and closes the websocket. The reader then fails,
+// which tears down the rest of the connection.
+func (c *conn) shutdown(code int, reason string) {
+	c.once.Do(func() {
+		close(c.done)
+		if code != websocket.CloseAbnormalClosure {
+			msg := websocket.FormatCloseMessage(code, reason)
+			_ = c.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeWait))
+		}
+		c.ws.Close()
+	})
+}
+
+// run reads the requests of the client until the connection is lost, then
+// ends its subscriptions and waits for its goroutines.
+func (c *conn) run(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	c.ws.SetReadLimit(maxMessage)
+	_ = c.ws.SetReadDeadline(time.Now().Add(2 * PingInterval))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(2 * PingInterval))
+	})
+	c.serve(ctx)
+	cancel()
+	c.shutdown(websocket.CloseNormalClosure, "")
+	c.mu.Lock()
+	subs := c.subs
+	c.subs = make(map[string]*events.Subscription)
+	c.mu.Unlock()
+	for id := range subs {
+		c.stream.Unsubscribe(id)
+	}
+	c.wg.Wait()
+	wsClients.Add(-1)
+}
+
+func (c *conn) add(sub *events.Subscription) {
+	c.mu.Lock()
+	c.subs[sub.ID] = sub
+	c.mu.Unlock()
+}
+
+// remove forgets the subscription id, and returns true when it was known.
+func (c *conn) remove(id string) bool {
+	c.mu.Lock()
+	_, ok := c.subs[id]
+	delete(c.subs, id)
+	c.mu.Unlock()
+	return ok
+}
+
+// follow delivers the events of sub until it is closed. The events of the
+// subscription made with the query parameters are sent as they are, the
+// others as notifications. Losing the former closes the connection.
+func (c *conn) follow(sub *events.Subscription, plain bool) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		for ev := range sub.C {
+			var err error
+			if plain {
+				err = c.write(ev)
+			} else {
+				err = c.write(&schema.Notification{
+					Method: schema.MethodEvent,
+					Params: schema.Subscription{Subscription: sub.ID, Event: ev},
+				})
+			}
+			if err != nil {
+				return
+			}
+		}
+		if !c.remove(sub.ID) {
+			// unsubscribed by the client or the connection closing
+			return
+		}
+		code, reason := websocket.CloseGoingAway, "shutting down"
+		if sub.Stats().Disconnected {
+			log.Printf("disconnecting slow subscriber %s", sub.ID)
+			code, reason = websocket.CloseTryAgainLater, "too slow"
+		}
+		if plain {
+			c.shutdown(code, reason)
+			return
+		}
+		_ = c.write(&schema.Notification{
+			Method: schema.MethodClosed,
+			Params: schema.Subscription{Subscription: sub.ID, Reason: reason},
+		})
+	}()
+}
@@ -0,0 +1,104 @@
+package web
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FarmRadioHangar/fdevices/db"
+	"github.com/FarmRadioHangar/fdevices/events"
+	"github.com/FarmRadioHangar/fdevices/schema"
+	"github.com/gorilla/websocket"
+)
+
+func TestConn(t *testing.T) {
+	ql := testDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := events.NewStream(10)
+	s.Start(ctx)
+	PingInterval = 50 * time.Millisecond
+	defer func() { PingInterval = 30 * time.Second }()
+	ts := httptest.NewServer(New(ql, s, Options{}))
+	defer ts.Close()
+	u := "ws" + strings.TrimPrefix(ts.URL, "http") + "/"
+
+	ws, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	pings := make(chan struct{}, 10)
+	ws.SetPingHandler(func(string) error {
+		pings <- struct{}{}
+		return ws.WriteControl(websocket.PongMessage, nil, time.Now().Add(time.Second))
+	})
+	var dongles []*db.Dongle
+	err = ws.ReadJSON(&dongles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the subscription is made before the snapshot is taken
+	if n := len(s.Stats()); n != 1 {
+		t.Errorf("expected a subscription with the snapshot got %d", n)
+	}
+	s.Send(events.New(schema.Add, schema.Device{IMEI: "1"}, nil))
+	var e schema.Event
+	err = ws.ReadJSON(&e)
+	if err != nil || e.Seq != 1 {
+		t.Errorf("expected event 1 got %v %v", e.Seq, err)
+	}
+	// the snapshot can carry the id of the event it was taken at
+	snap, _, err := websocket.DefaultDialer.Dial(u+"?snapshot=id", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v schema.Snapshot
+	err = snap.ReadJSON(&v)
+	snap.Close()
+	if err != nil || v.ID != schema.ID(s.Boot(), 1) || len(v.Dongles) != 2 {
+		t.Errorf("expected a snapshot at event 1 got %+v %v", v, err)
+	}
+	waitSubscribers(t, s, 1)
+	// pongs keep the connection open past the read deadline
+	go func() {
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	for i := 0; i < 4; i++ {
+		select {
+		case <-pings:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a ping")
+		}
+	}
+	if n := len(s.Stats()); n != 1 {
+		t.Errorf("expected the connection to stay open got %d subscriptions", n)
+	}
+	ws.Close()
+	waitSubscribers(t, s, 0)
+
+	// a client which does not answer pings is disconnected
+	idle, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+	waitSubscribers(t, s, 1)
+	waitSubscribers(t, s, 0)
+}
+
+func waitSubscribers(t *testing.T, s *events.Stream, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for len(s.Stats()) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d subscribers got %d", n, len(s.Stats()))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,230 @@
+package web
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/url"
+
+	"github.com/FarmRadioHangar/fdevices/api"
+	"github.com/FarmRadioHangar/fdevices/auth"
+	"github.com/FarmRadioHangar/fdevices/control"
+	"github.com/FarmRadioHangar/fdevices/db"
+	"github.com/FarmRadioHangar/fdevices/events"
+	"github.com/FarmRadioHangar/fdevices/schema"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GRPC returns a gRPC server offering the Dongles service of the api package,
+// over the same database and event stream as the HTTP API, with the same
+// options. Clients are authenticated by o.Auth, with the credentials they pass
+// in the authorization metadata, and are anonymous when it is nil.
+func GRPC(ql *sql.DB, s *events.Stream, o Options, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, h grpc.UnaryHandler) (interface{}, error) {
+			ctx, err := authenticate(ctx, o, info.FullMethod)
+			if err != nil {
+				return nil, err
+			}
+			return h(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, h grpc.StreamHandler) error {
+			_, err := authenticate(ss.Context(), o, info.FullMethod)
+			if err != nil {
+				return err
+			}
+			return h(srv, ss)
+		}),
+	)
+	srv := grpc.NewServer(opts...)
+	api.RegisterDonglesServer(srv, &dongleServer{ql: ql, stream: s, opts: o})
+	return srv
+}
+
+// grpcScope returns the scope a gRPC method needs, like Scope does for HTTP.
+func grpcScope(method string) string {
+	switch method {
+	case api.Dongles_SendSMS_FullMethodName:
+		return auth.SMS
+	case api.Dongles_RunAT_FullMethodName, api.Dongles_ResetDongle_FullMethodName:
+		return auth.Control
+	}
+	return auth.Read
+}
+
+// authenticate checks the credentials of a call to method, and returns ctx
+// carrying the identity of the client.
+func authenticate(ctx context.Context, o Options, method string) (context.Context, error) {
+	id := o.anonymous()
+	if o.Auth != nil {
+		md, _ := metadata.FromIncomingContext(ctx)
+		// the credentials are the same as over HTTP
+		r := &http.Request{URL: &url.URL{}, Header: http.Header{"Authorization": md.Get("authorization")}}
+		var err error
+		id, err = o.Auth.Authenticate(r)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+	}
+	if scope := grpcScope(method); !id.Allowed(scope) {
+		return nil, status.Error(codes.PermissionDenied, "missing scope "+scope)
+	}
+	return auth.NewContext(ctx, id), nil
+}
+
+// grpcCodes are the gRPC status codes of the error codes of the API.
+var grpcCodes = map[string]codes.Code{
+	schema.CodeBadRequest:    codes.InvalidArgument,
+	schema.CodeNotFound:      codes.NotFound,
+	schema.CodeAmbiguous:     codes.FailedPrecondition,
+	schema.CodeUnavailable:   codes.Unavailable,
+	schema.CodeInternal:      codes.Internal,
+	schema.CodeUnauthorized:  codes.Unauthenticated,
+	schema.CodeForbidden:     codes.PermissionDenied,
+	schema.CodeCommandFailed: codes.Aborted,
+}
+
+func grpcError(e *schema.Error) error {
+	c, ok := grpcCodes[e.Code]
+	if !ok {
+		c = codes.Unknown
+	}
+	return status.Error(c, e.Message)
+}
+
+// dongleServer implements api.DonglesServer.
+type dongleServer struct {
+	api.UnimplementedDonglesServer
+	ql     *sql.DB
+	stream *events.Stream
+	opts   Options
+}
+
+func (s *dongleServer) ListDongles(ctx context.Context, req *api.ListDonglesRequest) (*api.ListDonglesResponse, error) {
+	all, e := s.opts.list(s.ql, filter(req.Filter.Schema()))
+	if e != nil {
+		return nil, grpcError(e)
+	}
+	o := &api.ListDonglesResponse{}
+	for _, d := range all {
+		o.Dongles = append(o.Dongles, api.FromDongle(d))
+	}
+	return o, nil
+}
+
+func (s *dongleServer) GetDongle(ctx context.Context, req *api.GetDongleRequest) (*api.Dongle, error) {
+	d, e := s.opts.lookup(s.ql, req.Id)
+	if e != nil {
+		return nil, grpcError(e)
+	}
+	return api.FromDongle(s.opts.resource(d)), nil
+}
+
+// WatchEvents follows the event stream like a websocket subscription. The
+// call ends with RESOURCE_EXHAUSTED when the client is disconnected by its
+// policy, and UNAVAILABLE when the stream shuts down.
+func (s *dongleServer) WatchEvents(req *api.WatchEventsRequest, ss grpc.ServerStreamingServer[api.WatchEventsResponse]) error {
+	opts := events.Options{
+		Policy: events.Disconnect,
+		Since:  req.Since,
+		Boot:   req.Boot,
+		Filter: filter(req.Filter.Schema()),
+	}
+	if req.Policy != "" {
+		p, err := events.ParsePolicy(req.Policy)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		opts.Policy = p
+	}
+	var first []*api.WatchEventsResponse
+	sub := subscribe(s.opts, s.ql, s.stream, opts, func(gap *schema.Event, seq uint64, dongles []*db.Dongle) {
+		if gap != nil {
+			first = append(first, &api.WatchEventsResponse{
+				Message: &api.WatchEventsResponse_Event{Event: api.FromEvent(gap)},
+			})
+		}
+		snapshot := &api.Snapshot{Seq: seq, Boot: s.stream.Boot()}
+		for _, d := range dongles {
+			snapshot.Dongles = append(snapshot.Dongles, api.FromDongle(s.opts.resource(d)))
+		}
+		first = append(first, &api.WatchEventsResponse{
+			Message: &api.WatchEventsResponse_Snapshot{Snapshot: snapshot},
+		})
+	})
+	defer s.stream.Unsubscribe(sub.ID)
+	for _, v := range first {
+		err := ss.Send(v)
+		if err != nil {
+			return err
+		}
+	}
+	ctx := ss.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev, ok := <-sub.C:
+			if !ok {
+				if sub.Stats().Disconnected {
+					return status.Error(codes.ResourceExhausted, "too slow")
+				}
+				return status.Error(codes.Unavailable, "shutting down")
+			}
+			err := ss.Send(&api.WatchEventsResponse{
+				Message: &api.WatchEventsResponse_Event{Event: api.FromEvent(ev)},
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// run runs the command p, with the identity put on ctx by authenticate.
+func (s *dongleServer) run(ctx context.Context, p *schema.CommandParams) (*schema.Result, error) {
+	id := auth.FromContext(ctx)
+	if id == nil {
+		id = s.opts.anonymous()
+	}
+	res, e := s.opts.command(ctx, s.ql, id, p)
+	if e != nil {
+		return nil, grpcError(e)
+	}
+	return res, nil
+}
+
+func (s *dongleServer) SendSMS(ctx context.Context, req *api.SendSMSRequest) (*api.SendSMSResponse, error) {
+	_, err := s.run(ctx, &schema.CommandParams{
+		Command: schema.Command{Number: req.Number, Text: req.Text},
+		Dongle:  req.Dongle,
+		Name:    control.SMS,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &api.SendSMSResponse{}, nil
+}
+
+func (s *dongleServer) RunAT(ctx context.Context, req *api.RunATRequest) (*api.RunATResponse, error) {
+	res, err := s.run(ctx, &schema.CommandParams{
+		Command: schema.Command{Command: req.Command},
+		Dongle:  req.Dongle,
+		Name:    control.AT,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &api.RunATResponse{Output: res.Output}, nil
+}
+
+func (s *dongleServer) ResetDongle(ctx context.Context, req *api.ResetDongleRequest) (*api.ResetDongleResponse, error) {
+	_, err := s.run(ctx, &schema.CommandParams{Dongle: req.Dongle, Name: control.Reset})
+	if err != nil {
+		return nil, err
+	}
+	return &api.ResetDongleResponse{}, nil
+}
@@ -0,0 +1,115 @@
+package web
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/FarmRadioHangar/fdevices/api"
+	"github.com/FarmRadioHangar/fdevices/auth"
+	"github.com/FarmRadioHangar/fdevices/events"
+	"github.com/FarmRadioHangar/fdevices/schema"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPC(t *testing.T) {
+	dir, err := ioutil.TempDir("", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a := &auth.Authenticator{Tokens: auth.NewStore(filepath.Join(dir, "tokens.json"))}
+	_, reader, err := a.Tokens.Create("reader", []string{auth.Read})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, sms, err := a.Tokens.Create("sms", []string{auth.SMS})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s := events.NewStream(10)
+	s.Start(ctx)
+	ctl := &smsController{sms: make(chan string, 1)}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := GRPC(testDB(t), s, Options{Commands: ctl, Auth: a})
+	go srv.Serve(l)
+	defer srv.Stop()
+	cc, err := grpc.NewClient(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+	c := api.NewDonglesClient(cc)
+	as := func(token string) context.Context {
+		return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	}
+
+	_, err = c.ListDongles(ctx, &api.ListDonglesRequest{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected unauthenticated got %v", err)
+	}
+	list, err := c.ListDongles(as(reader), &api.ListDonglesRequest{Filter: &api.Filter{Imsi: []string{"457"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Dongles) != 1 || list.Dongles[0].Imei != "124" {
+		t.Errorf("expected dongle 124 got %v", list.Dongles)
+	}
+	d, err := c.GetDongle(as(reader), &api.GetDongleRequest{Id: "890"})
+	if err != nil || d.Imei != "124" {
+		t.Errorf("expected dongle 124 got %v %v", d, err)
+	}
+	_, err = c.GetDongle(as(reader), &api.GetDongleRequest{Id: "999"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected not found got %v", err)
+	}
+
+	_, err = c.SendSMS(as(reader), &api.SendSMSRequest{Dongle: "456", Number: "+255", Text: "hi"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected permission denied got %v", err)
+	}
+	_, err = c.SendSMS(as(sms), &api.SendSMSRequest{Dongle: "456", Number: "+255", Text: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := <-ctl.sms; v != "123 +255 hi" {
+		t.Errorf("unexpected sms %s", v)
+	}
+
+	w, err := c.WatchEvents(as(reader), &api.WatchEventsRequest{Filter: &api.Filter{Imei: []string{"123"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := w.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot := m.GetSnapshot()
+	if snapshot == nil || len(snapshot.Dongles) != 1 || snapshot.Dongles[0].Imei != "123" {
+		t.Errorf("expected a snapshot of 123 got %v", m)
+	}
+	s.Send(events.New(schema.Add, schema.Device{IMEI: "999"}, nil))
+	s.Send(events.New(schema.Update, schema.Device{IMEI: "123"}, &schema.Dongle{IMEI: "123", IMSI: "456"}))
+	m, err = w.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := m.GetEvent()
+	if ev == nil || ev.Type != string(schema.Update) || ev.Seq <= snapshot.Seq || ev.Boot != snapshot.Boot || ev.GetDongle().GetImsi() != "456" {
+		t.Errorf("expected the update of 123 got %v", m)
+	}
+}
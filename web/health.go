@@ -0,0 +1,67 @@
+package web
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/FarmRadioHangar/fdevices/db"
+	"github.com/FarmRadioHangar/fdevices/schema"
+)
+
+// checkTimeout is how long a readiness check is given.
+const checkTimeout = 2 * time.Second
+
+// Check returns nil when a subsystem is ready, otherwise the reason it is
+// not.
+type Check func(ctx context.Context) error
+
+// GetHealth reports that the process is alive. It does not check anything
+// else, see GetReady.
+func GetHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"status":"ok"}` + "\n"))
+}
+
+// GetReady returns a handler reporting whether every check passes, along with
+// the database being reachable. The response is 200 when they all do and 503
+// otherwise, with a schema.Readiness body either way.
+func GetReady(checks map[string]Check) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		defer cancel()
+		o := &schema.Readiness{Ready: true, Checks: make(map[string]schema.Check)}
+		add := func(name string, err error) {
+			c := schema.Check{Ready: err == nil}
+			if err != nil {
+				c.Error = err.Error()
+				o.Ready = false
+			}
+			o.Checks[name] = c
+		}
+		add("database", ping(ctx))
+		for name, check := range checks {
+			add(name, check(ctx))
+		}
+		status := http.StatusOK
+		if !o.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(o)
+	}
+}
+
+// ping checks that the database on the context answers.
+func ping(ctx context.Context) error {
+	ql, ok := ctx.Value(db.CtxKey).(*sql.DB)
+	if !ok {
+		return errors.New("database not available")
+	}
+	return ql.PingContext(ctx)
+}
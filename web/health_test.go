@@ -0,0 +1,63 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/FarmRadioHangar/fdevices/events"
+	"github.com/FarmRadioHangar/fdevices/schema"
+)
+
+func TestGetReady(t *testing.T) {
+	var started bool
+	m := New(testDB(t), events.NewStream(10), Options{})
+	m.Get("/readyz", GetReady(map[string]Check{
+		"startup": func(ctx context.Context) error {
+			if !started {
+				return errors.New("starting")
+			}
+			return nil
+		},
+	}))
+	ts := httptest.NewServer(m)
+	defer ts.Close()
+
+	get := func(status int) *schema.Readiness {
+		res, err := http.Get(ts.URL + "/readyz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode != status {
+			t.Errorf("expected %d got %d", status, res.StatusCode)
+		}
+		o := &schema.Readiness{}
+		err = json.NewDecoder(res.Body).Decode(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return o
+	}
+	o := get(http.StatusServiceUnavailable)
+	if o.Ready || !o.Checks["database"].Ready || o.Checks["startup"].Error != "starting" {
+		t.Errorf("unexpected %+v", o)
+	}
+	started = true
+	o = get(http.StatusOK)
+	if !o.Ready || !o.Checks["startup"].Ready {
+		t.Errorf("unexpected %+v", o)
+	}
+
+	res, err := http.Get(ts.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected %d got %d", http.StatusOK, res.StatusCode)
+	}
+}
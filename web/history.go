@@ -0,0 +1,66 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/FarmRadioHangar/fdevices/journal"
+	"github.com/FarmRadioHangar/fdevices/schema"
+)
+
+// DefaultHistoryLimit is the number of events returned by GetHistory when no
+// limit is asked for.
+const DefaultHistoryLimit = 1000
+
+// GetHistory returns a handler listing the events kept in the journal in dir
+// as a JSON array, oldest first.
+//
+// ?since= and ?until= bound the time of the events, they are either a
+// duration before now like 2h or an RFC 3339 time. ?limit= is the number of
+// most recent events returned, 1000 by default, 0 returns every event. The
+// filter parameters of GetDongles are accepted as well.
+func GetHistory(dir string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		f, err := parseFilter(query)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, schema.CodeBadRequest, err.Error())
+			return
+		}
+		q := journal.Query{Filter: f, Limit: DefaultHistoryLimit}
+		now := time.Now()
+		if v := query.Get("since"); v != "" {
+			q.Since, err = journal.ParseTime(v, now)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, schema.CodeBadRequest, err.Error())
+				return
+			}
+		}
+		if v := query.Get("until"); v != "" {
+			q.Until, err = journal.ParseTime(v, now)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, schema.CodeBadRequest, err.Error())
+				return
+			}
+		}
+		if v := query.Get("limit"); v != "" {
+			q.Limit, err = strconv.Atoi(v)
+			if err != nil || q.Limit < 0 {
+				writeError(w, http.StatusBadRequest, schema.CodeBadRequest, "limit must be a positive number")
+				return
+			}
+		}
+		all, err := journal.Read(dir, q)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, schema.CodeInternal, err.Error())
+			return
+		}
+		if all == nil {
+			all = []*schema.Event{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(all)
+	}
+}
@@ -0,0 +1,95 @@
+package web
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/FarmRadioHangar/fdevices/db"
+	"github.com/FarmRadioHangar/fdevices/events"
+	"github.com/FarmRadioHangar/fdevices/metrics"
+)
+
+// GetMetrics serves the metrics in the Prometheus text format. Along with the
+// declared metrics it reports the dongles in the database, by vendor and
+// state, and the counters of every subscriber of the event stream.
+func GetMetrics(w http.ResponseWriter, r *http.Request) {
+	families := metrics.Collect()
+	if ql, ok := r.Context().Value(db.CtxKey).(*sql.DB); ok {
+		f, err := dongleMetrics(ql)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		families = append(families, f)
+	}
+	if stream, ok := r.Context().Value(evtCtxKey).(*events.Stream); ok {
+		families = append(families, subscriberMetrics(stream)...)
+	}
+	w.Header().Set("Content-Type", metrics.ContentType)
+	_ = metrics.Write(w, families)
+}
+
+// dongleState is the state of a dongle as reported by the metrics.
+func dongleState(d *db.Dongle) string {
+	switch {
+	case d.IMSI == "":
+		return "no_sim"
+	case d.IsSymlinked:
+		return "ready"
+	}
+	return "probed"
+}
+
+func dongleMetrics(ql *sql.DB) (*metrics.Family, error) {
+	all, err := db.GetDistinct(ql)
+	if err != nil {
+		return nil, err
+	}
+	type key struct{ vendor, state string }
+	var keys []key
+	count := make(map[key]int)
+	for _, d := range all {
+		k := key{d.Properties["ID_VENDOR_ID"], dongleState(d)}
+		if count[k] == 0 {
+			keys = append(keys, k)
+		}
+		count[k]++
+	}
+	f := &metrics.Family{
+		Name: "fdevices_dongles",
+		Help: "Dongles plugged in, by USB vendor id and state.",
+		Type: metrics.Gauge,
+	}
+	for _, k := range keys {
+		f.Samples = append(f.Samples, metrics.Sample{
+			Labels: []metrics.Label{{Name: "vendor", Value: k.vendor}, {Name: "state", Value: k.state}},
+			Value:  float64(count[k]),
+		})
+	}
+	return f, nil
+}
+
+func subscriberMetrics(stream *events.Stream) []*metrics.Family {
+	delivered := &metrics.Family{
+		Name: "fdevices_subscriber_events_delivered_total",
+		Help: "Events delivered to a subscriber of the event stream.",
+		Type: metrics.Counter,
+	}
+	dropped := &metrics.Family{
+		Name: "fdevices_subscriber_events_dropped_total",
+		Help: "Events dropped because a subscriber of the event stream was too slow.",
+		Type: metrics.Counter,
+	}
+	lag := &metrics.Family{
+		Name: "fdevices_subscriber_lag",
+		Help: "Events waiting to be read by a subscriber of the event stream.",
+		Type: metrics.Gauge,
+	}
+	for _, s := range stream.Stats() {
+		l := []metrics.Label{{Name: "subscriber", Value: s.ID}, {Name: "policy", Value: string(s.Policy)}}
+		delivered.Samples = append(delivered.Samples, metrics.Sample{Labels: l, Value: float64(s.Delivered)})
+		dropped.Samples = append(dropped.Samples, metrics.Sample{Labels: l, Value: float64(s.Dropped)})
+		lag.Samples = append(lag.Samples, metrics.Sample{Labels: l, Value: float64(s.Lag)})
+	}
+	return []*metrics.Family{delivered, dropped, lag}
+}
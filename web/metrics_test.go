@@ -0,0 +1,47 @@
+package web
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/FarmRadioHangar/fdevices/events"
+	"github.com/FarmRadioHangar/fdevices/metrics"
+	"github.com/FarmRadioHangar/fdevices/schema"
+)
+
+func TestGetMetrics(t *testing.T) {
+	s := events.NewStream(10)
+	sub, err := s.Subscribe(events.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Send(events.New(schema.Add, schema.Device{IMEI: "123"}, nil))
+	ts := httptest.NewServer(New(testDB(t), s, Options{}))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != metrics.ContentType {
+		t.Errorf("expected %s got %s", metrics.ContentType, ct)
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{
+		`fdevices_dongles{vendor="",state="probed"} 2`,
+		`fdevices_subscriber_events_delivered_total{subscriber="` + sub.ID + `",policy="drop-oldest"} 1`,
+		`# TYPE fdevices_events_total counter`,
+		`fdevices_websocket_clients `,
+	} {
+		if !strings.Contains(string(b), v) {
+			t.Errorf("expected %s in\n%s", v, b)
+		}
+	}
+}
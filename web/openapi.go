@@ -0,0 +1,302 @@
+package web
+
+import (
+	"net/http"
+)
+
+// openAPI describes the HTTP API, it has to be kept in step with the handlers.
+const openAPI = `{
+  "openapi": "3.0.0",
+  "info": {
+    "title": "fdevices",
+    "description": "Real time state of the 3G dongles plugged into a device.",
+    "version": "1"
+  },
+  "paths": {
+    "/api/v1/dongles": {
+      "get": {
+        "summary": "List the dongles",
+        "operationId": "listDongles",
+        "parameters": [
+          {"$ref": "#/components/parameters/imei"},
+          {"$ref": "#/components/parameters/imsi"},
+          {"$ref": "#/components/parameters/iccid"},
+          {"$ref": "#/components/parameters/label"}
+        ],
+        "responses": {
+          "200": {
+            "description": "The dongles ordered by IMEI",
+            "headers": {"ETag": {"schema": {"type": "string"}}},
+            "content": {
+              "application/json": {
+                "schema": {"type": "array", "items": {"$ref": "#/components/schemas/Dongle"}}
+              }
+            }
+          },
+          "304": {"description": "Not modified since the ETag in If-None-Match"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/dongles/{id}": {
+      "get": {
+        "summary": "Get a dongle by IMEI, IMSI, ICCID or label selector",
+        "operationId": "getDongle",
+        "parameters": [{"$ref": "#/components/parameters/id"}],
+        "responses": {
+          "200": {
+            "description": "The dongle",
+            "headers": {"ETag": {"schema": {"type": "string"}}},
+            "content": {
+              "application/json": {"schema": {"$ref": "#/components/schemas/Dongle"}}
+            }
+          },
+          "304": {"description": "Not modified since the ETag in If-None-Match"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/dongles/{id}/commands/{name}": {
+      "post": {
+        "summary": "Run a command on a dongle, when commands are enabled",
+        "operationId": "runCommand",
+        "parameters": [
+          {"$ref": "#/components/parameters/id"},
+          {
+            "name": "name",
+            "in": "path",
+            "required": true,
+            "schema": {"type": "string", "enum": ["sms", "at", "reset"]}
+          }
+        ],
+        "requestBody": {
+          "content": {
+            "application/json": {"schema": {"$ref": "#/components/schemas/Command"}}
+          }
+        },
+        "responses": {
+          "200": {
+            "description": "The command was carried out",
+            "content": {
+              "application/json": {"schema": {"$ref": "#/components/schemas/Result"}}
+            }
+          },
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/ports": {
+      "get": {
+        "summary": "List the serial devices which are not probed",
+        "operationId": "listPorts",
+        "responses": {
+          "200": {
+            "description": "The ports ordered by path",
+            "headers": {"ETag": {"schema": {"type": "string"}}},
+            "content": {
+              "application/json": {
+                "schema": {"type": "array", "items": {"$ref": "#/components/schemas/Port"}}
+              }
+            }
+          },
+          "304": {"description": "Not modified since the ETag in If-None-Match"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/webhooks/deliveries": {
+      "get": {
+        "summary": "List the pending and failed webhook deliveries",
+        "operationId": "listDeliveries",
+        "parameters": [
+          {"name": "status", "in": "query", "schema": {"type": "string", "enum": ["pending", "failed"]}}
+        ],
+        "responses": {
+          "200": {
+            "description": "The deliveries, oldest first",
+            "content": {
+              "application/json": {
+                "schema": {"type": "array", "items": {"type": "object"}}
+              }
+            }
+          },
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/events": {
+      "get": {
+        "summary": "Stream the dongles and their events as Server-Sent Events",
+        "description": "A snapshot event with the dongles is sent first, followed by an event for every change. The id of an event is its boot and seq, as <boot>-<seq>.",
+        "operationId": "streamEvents",
+        "parameters": [
+          {"name": "Last-Event-ID", "in": "header", "schema": {"type": "string"}},
+          {"name": "since", "in": "query", "schema": {"type": "string"}},
+          {"name": "policy", "in": "query", "schema": {"type": "string", "enum": ["disconnect", "drop-oldest", "drop-newest"]}},
+          {"$ref": "#/components/parameters/type"},
+          {"$ref": "#/components/parameters/imei"},
+          {"$ref": "#/components/parameters/imsi"},
+          {"$ref": "#/components/parameters/iccid"},
+          {"$ref": "#/components/parameters/label"}
+        ],
+        "responses": {
+          "200": {
+            "description": "The event stream",
+            "content": {"text/event-stream": {"schema": {"type": "string"}}}
+          },
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/events/history": {
+      "get": {
+        "summary": "List the events kept in the journal",
+        "operationId": "eventHistory",
+        "parameters": [
+          {"name": "since", "in": "query", "description": "A duration before now like 2h, or an RFC 3339 time", "schema": {"type": "string"}},
+          {"name": "until", "in": "query", "description": "A duration before now like 2h, or an RFC 3339 time", "schema": {"type": "string"}},
+          {"name": "limit", "in": "query", "schema": {"type": "integer", "default": 1000}},
+          {"$ref": "#/components/parameters/type"},
+          {"$ref": "#/components/parameters/imei"},
+          {"$ref": "#/components/parameters/imsi"},
+          {"$ref": "#/components/parameters/iccid"},
+          {"$ref": "#/components/parameters/label"}
+        ],
+        "responses": {
+          "200": {
+            "description": "The events, oldest first",
+            "content": {
+              "application/json": {
+                "schema": {"type": "array", "items": {"$ref": "#/components/schemas/Event"}}
+              }
+            }
+          }
+        }
+      }
+    }
+  },
+  "security": [{"bearer": []}, {"basic": []}, {"accessToken": []}],
+  "components": {
+    "securitySchemes": {
+      "bearer": {"type": "http", "scheme": "bearer", "description": "An API token, when authentication is enabled"},
+      "basic": {"type": "http", "scheme": "basic"},
+      "accessToken": {"type": "apiKey", "in": "query", "name": "access_token"}
+    },
+    "parameters": {
+      "id": {
+        "name": "id",
+        "in": "path",
+        "required": true,
+        "description": "An IMEI, IMSI or ICCID, or a label selector like port=1-1.3",
+        "schema": {"type": "string"}
+      },
+      "type": {"name": "type", "in": "query", "description": "Comma separated event types", "schema": {"type": "string"}},
+      "imei": {"name": "imei", "in": "query", "description": "Comma separated IMEIs", "schema": {"type": "string"}},
+      "imsi": {"name": "imsi", "in": "query", "description": "Comma separated IMSIs", "schema": {"type": "string"}},
+      "iccid": {"name": "iccid", "in": "query", "description": "Comma separated ICCIDs", "schema": {"type": "string"}},
+      "label": {"name": "label", "in": "query", "description": "A label selector like port=1-1.3,name=news", "schema": {"type": "string"}}
+    },
+    "responses": {
+      "Error": {
+        "description": "An error",
+        "content": {
+          "application/json": {"schema": {"$ref": "#/components/schemas/Error"}}
+        }
+      }
+    },
+    "schemas": {
+      "Dongle": {
+        "type": "object",
+        "properties": {
+          "imei": {"type": "string"},
+          "imsi": {"type": "string"},
+          "iccid": {"type": "string"},
+          "path": {"type": "string"},
+          "symlink": {"type": "boolean"},
+          "ati": {"type": "string"},
+          "operator": {"type": "string"},
+          "signal": {"type": "integer", "minimum": 0, "maximum": 31},
+          "sim": {"type": "string", "description": "ready, pin, puk or absent"},
+          "health": {"type": "string", "description": "ok when the dongle answered the last poll"},
+          "properties": {"type": "object", "additionalProperties": {"type": "string"}},
+          "labels": {"type": "object", "additionalProperties": {"type": "string"}}
+        }
+      },
+      "Port": {
+        "type": "object",
+        "properties": {
+          "path": {"type": "string"},
+          "status": {"type": "string", "enum": ["ignored", "passive"]},
+          "reason": {"type": "string"},
+          "properties": {"type": "object", "additionalProperties": {"type": "string"}},
+          "created_on": {"type": "string", "format": "date-time"}
+        }
+      },
+      "Device": {
+        "type": "object",
+        "properties": {
+          "imei": {"type": "string"},
+          "imsi": {"type": "string"},
+          "iccid": {"type": "string"},
+          "path": {"type": "string"},
+          "labels": {"type": "object", "additionalProperties": {"type": "string"}}
+        }
+      },
+      "Change": {
+        "type": "object",
+        "properties": {
+          "field": {"type": "string"},
+          "old": {"type": "string"},
+          "new": {"type": "string"}
+        }
+      },
+      "Event": {
+        "type": "object",
+        "properties": {
+          "version": {"type": "integer"},
+          "seq": {"type": "integer"},
+          "boot": {"type": "string"},
+          "time": {"type": "string", "format": "date-time"},
+          "type": {"type": "string", "enum": ["add", "remove", "update", "port-add", "port-remove", "gap"]},
+          "device": {"$ref": "#/components/schemas/Device"},
+          "source": {"type": "string", "enum": ["udev", "probe", "poller", "api"]},
+          "changes": {"type": "array", "items": {"$ref": "#/components/schemas/Change"}},
+          "data": {"description": "A Dongle, a Port, or for gap events the since and oldest seq"}
+        }
+      },
+      "Command": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "string"},
+          "number": {"type": "string"},
+          "text": {"type": "string"},
+          "command": {"type": "string"}
+        }
+      },
+      "Result": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "string"},
+          "ok": {"type": "boolean"},
+          "error": {"type": "string"},
+          "output": {"type": "string"}
+        }
+      },
+      "Error": {
+        "type": "object",
+        "properties": {
+          "status": {"type": "integer"},
+          "code": {"type": "string", "enum": ["bad_request", "not_found", "ambiguous", "unavailable", "internal", "command_failed", "unauthorized", "forbidden"]},
+          "message": {"type": "string"}
+        }
+      }
+    }
+  }
+}
+`
+
+// GetOpenAPI serves the OpenAPI 3 description of the HTTP API.
+func GetOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(openAPI))
+}
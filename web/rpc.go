@@ -0,0 +1,254 @@
+package web
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/FarmRadioHangar/fdevices/auth"
+	"github.com/FarmRadioHangar/fdevices/control"
+	"github.com/FarmRadioHangar/fdevices/db"
+	"github.com/FarmRadioHangar/fdevices/events"
+	"github.com/FarmRadioHangar/fdevices/schema"
+)
+
+// serve reads the requests of the client until the connection is closed.
+// Commands are run in the background, so a slow dongle does not hold up the
+// other requests.
+func (c *conn) serve(ctx context.Context) {
+	for {
+		_, b, err := c.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		_ = c.ws.SetReadDeadline(time.Now().Add(2 * PingInterval))
+		var req schema.Request
+		err = json.Unmarshal(b, &req)
+		if err != nil {
+			_ = c.write(&schema.Response{Error: rpcError(schema.CodeBadRequest, err.Error())})
+			continue
+		}
+		if req.Method == schema.MethodCommand {
+			c.wg.Add(1)
+			go func() {
+				defer c.wg.Done()
+				res, _ := c.handle(ctx, &req)
+				_ = c.write(res)
+			}()
+			continue
+		}
+		res, then := c.handle(ctx, &req)
+		_ = c.write(res)
+		if then != nil {
+			then()
+		}
+	}
+}
+
+func rpcError(code, msg string) *schema.Error {
+	return &schema.Error{Code: code, Message: msg}
+}
+
+// handle returns the response to req, and a function to call once it is
+// written, if any.
+func (c *conn) handle(ctx context.Context, req *schema.Request) (*schema.Response, func()) {
+	res := &schema.Response{ID: req.ID}
+	var v interface{}
+	var then func()
+	var e *schema.Error
+	if req.Method == schema.MethodSubscribe {
+		var p schema.Subscribe
+		if e = params(req, &p); e == nil {
+			v, then, e = c.subscribe(&p)
+		}
+	} else {
+		v, e = c.call(ctx, req)
+	}
+	if e != nil {
+		res.Error = e
+		return res, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		res.Error = rpcError(schema.CodeInternal, err.Error())
+		return res, then
+	}
+	res.Result = b
+	return res, then
+}
+
+func (c *conn) call(ctx context.Context, req *schema.Request) (interface{}, *schema.Error) {
+	switch req.Method {
+	case schema.MethodPing:
+		return "pong", nil
+	case schema.MethodUnsubscribe:
+		var p schema.Subscription
+		if e := params(req, &p); e != nil {
+			return nil, e
+		}
+		if !c.remove(p.Subscription) {
+			return nil, rpcError(schema.CodeNotFound, fmt.Sprintf("no subscription %s", p.Subscription))
+		}
+		c.stream.Unsubscribe(p.Subscription)
+		return &p, nil
+	case schema.MethodSnapshot:
+		var f schema.Filter
+		if e := params(req, &f); e != nil {
+			return nil, e
+		}
+		return c.opts.list(c.ql, filter(&f))
+	case schema.MethodCommand:
+		var p schema.CommandParams
+		if e := params(req, &p); e != nil {
+			return nil, e
+		}
+		return c.opts.command(ctx, c.ql, c.id, &p)
+	}
+	return nil, rpcError(schema.CodeNotFound, fmt.Sprintf("unknown method %q", req.Method))
+}
+
+// params decodes the params of req into v, missing params leave v alone.
+func params(req *schema.Request, v interface{}) *schema.Error {
+	if len(req.Params) == 0 {
+		return nil
+	}
+	err := json.Unmarshal(req.Params, v)
+	if err != nil {
+		return rpcError(schema.CodeBadRequest, err.Error())
+	}
+	return nil
+}
+
+// filter returns the events filter matching f, or nil when f is empty.
+func filter(f *schema.Filter) *events.Filter {
+	if len(f.Types) == 0 && len(f.IMEI) == 0 && len(f.IMSI) == 0 &&
+		len(f.ICCID) == 0 && len(f.Labels) == 0 {
+		return nil
+	}
+	return &events.Filter{
+		Types:  f.Types,
+		IMEI:   f.IMEI,
+		IMSI:   f.IMSI,
+		ICCID:  f.ICCID,
+		Labels: f.Labels,
+	}
+}
+
+// list returns the dongles passing f, ordered by IMEI.
+func (o Options) list(ql *sql.DB, f *events.Filter) ([]*schema.Dongle, *schema.Error) {
+	all, err := db.GetDistinct(ql)
+	if err != nil {
+		return nil, rpcError(schema.CodeInternal, err.Error())
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].IMEI < all[j].IMEI })
+	v := []*schema.Dongle{}
+	for _, d := range all {
+		if f.MatchDevice(o.device(d)) {
+			v = append(v, o.resource(d))
+		}
+	}
+	return v, nil
+}
+
+// subscribe adds a subscription. The function returned sends its snapshot,
+// if any, and starts delivering its events. It is called once the response
+// is written, so the client knows the subscription before its notifications.
+func (c *conn) subscribe(p *schema.Subscribe) (*schema.Subscription, func(), *schema.Error) {
+	opts := events.Options{
+		Policy: events.Disconnect,
+		Filter: filter(&p.Filter),
+	}
+	if p.Since != "" {
+		boot, n, err := schema.ParseID(p.Since)
+		if err != nil {
+			return nil, nil, rpcError(schema.CodeBadRequest, err.Error())
+		}
+		opts.Boot, opts.Since = boot, n
+	}
+	if p.Policy != "" {
+		v, err := events.ParsePolicy(p.Policy)
+		if err != nil {
+			return nil, nil, rpcError(schema.CodeBadRequest, err.Error())
+		}
+		opts.Policy = v
+	}
+	var gap *schema.Event
+	var id string
+	var snapshot []*schema.Dongle
+	sub := subscribe(c.opts, c.ql, c.stream, opts, func(g *schema.Event, seq uint64, dongles []*db.Dongle) {
+		gap, id = g, schema.ID(c.stream.Boot(), seq)
+		snapshot = []*schema.Dongle{}
+		for _, d := range dongles {
+			snapshot = append(snapshot, c.opts.resource(d))
+		}
+	})
+	c.add(sub)
+	start := func() {
+		if gap != nil {
+			_ = c.write(&schema.Notification{
+				Method: schema.MethodEvent,
+				Params: schema.Subscription{Subscription: sub.ID, Event: gap},
+			})
+		}
+		if snapshot != nil {
+			_ = c.write(&schema.Notification{
+				Method: schema.MethodSnapshot,
+				Params: schema.Subscription{Subscription: sub.ID, ID: id, Dongles: snapshot},
+			})
+		}
+		c.follow(sub, false)
+	}
+	return &schema.Subscription{Subscription: sub.ID}, start, nil
+}
+
+// command runs the command p for the client id, with o.Commands.
+func (o Options) command(ctx context.Context, ql *sql.DB, id *auth.Identity, p *schema.CommandParams) (*schema.Result, *schema.Error) {
+	scope := auth.Control
+	if p.Name == control.SMS {
+		scope = auth.SMS
+	}
+	if !id.Allowed(scope) {
+		return nil, rpcError(schema.CodeForbidden, "missing scope "+scope)
+	}
+	if o.Commands == nil {
+		return nil, rpcError(schema.CodeUnavailable, "commands are disabled")
+	}
+	d, e := o.lookup(ql, p.Dongle)
+	if e != nil {
+		return nil, e
+	}
+	ctx, cancel := context.WithTimeout(ctx, CommandTimeout)
+	defer cancel()
+	out, err := control.Run(ctx, o.Commands, d.IMEI, p.Name, &p.Command)
+	if err != nil {
+		code := schema.CodeCommandFailed
+		if _, ok := err.(control.UnknownCommandError); ok || err == control.ErrUnknownDongle {
+			code = schema.CodeNotFound
+		}
+		return nil, rpcError(code, err.Error())
+	}
+	return &schema.Result{ID: p.ID, OK: true, Output: out}, nil
+}
+
+// lookup returns the single dongle matching id, which is looked up like in
+// GetDongle.
+func (o Options) lookup(ql *sql.DB, id string) (*db.Dongle, *schema.Error) {
+	all, err := db.GetDistinct(ql)
+	if err != nil {
+		return nil, rpcError(schema.CodeInternal, err.Error())
+	}
+	found, err := o.find(all, id)
+	if err != nil {
+		return nil, rpcError(schema.CodeBadRequest, err.Error())
+	}
+	switch len(found) {
+	case 0:
+		return nil, rpcError(schema.CodeNotFound, fmt.Sprintf("no dongle matches %s", id))
+	case 1:
+		return found[0], nil
+	}
+	return nil, rpcError(schema.CodeAmbiguous, fmt.Sprintf("%d dongles match %s", len(found), id))
+}
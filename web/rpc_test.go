@@ -0,0 +1,130 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FarmRadioHangar/fdevices/events"
+	"github.com/FarmRadioHangar/fdevices/schema"
+	"github.com/gorilla/websocket"
+)
+
+type smsController struct {
+	nopController
+	sms chan string
+}
+
+func (c *smsController) SendSMS(ctx context.Context, imei, number, text string) error {
+	c.sms <- imei + " " + number + " " + text
+	return nil
+}
+
+// message is a response or a notification.
+type message struct {
+	schema.Response
+	Method string              `json:"method"`
+	Params schema.Subscription `json:"params"`
+}
+
+func TestRPC(t *testing.T) {
+	ql := testDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := events.NewStream(10)
+	s.Start(ctx)
+	ctl := &smsController{sms: make(chan string, 1)}
+	ts := httptest.NewServer(New(ql, s, Options{Commands: ctl}))
+	defer ts.Close()
+
+	u := "ws" + strings.TrimPrefix(ts.URL, "http") + "/?subscribe=false"
+	ws, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	send := func(id, method string, params interface{}) {
+		b, _ := json.Marshal(params)
+		err := ws.WriteJSON(&schema.Request{ID: id, Method: method, Params: b})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func() *message {
+		ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+		m := &message{}
+		err := ws.ReadJSON(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	send("1", schema.MethodPing, nil)
+	if m := read(); m.ID != "1" || string(m.Result) != `"pong"` {
+		t.Errorf("expected pong got %+v", m)
+	}
+	_ = ws.WriteMessage(websocket.TextMessage, []byte("{"))
+	if m := read(); m.Error == nil || m.Error.Code != schema.CodeBadRequest {
+		t.Errorf("expected bad request got %+v", m)
+	}
+	send("2", "frobnicate", nil)
+	if m := read(); m.ID != "2" || m.Error == nil || m.Error.Code != schema.CodeNotFound {
+		t.Errorf("expected unknown method got %+v", m)
+	}
+
+	send("3", schema.MethodSnapshot, &schema.Filter{IMSI: []string{"457"}})
+	m := read()
+	var dongles []*schema.Dongle
+	_ = json.Unmarshal(m.Result, &dongles)
+	if m.ID != "3" || len(dongles) != 1 || dongles[0].IMEI != "124" {
+		t.Errorf("expected dongle 124 got %s", m.Result)
+	}
+
+	send("4", schema.MethodSubscribe, &schema.Subscribe{Filter: schema.Filter{IMEI: []string{"123"}}})
+	m = read()
+	var sub schema.Subscription
+	_ = json.Unmarshal(m.Result, &sub)
+	if m.ID != "4" || sub.Subscription == "" {
+		t.Fatalf("expected a subscription got %+v", m)
+	}
+	m = read()
+	if m.Method != schema.MethodSnapshot || m.Params.Subscription != sub.Subscription ||
+		len(m.Params.Dongles) != 1 || m.Params.Dongles[0].IMEI != "123" {
+		t.Errorf("expected a snapshot of 123 got %+v", m)
+	}
+	s.Send(events.New(schema.Add, schema.Device{IMEI: "999"}, nil))
+	s.Send(events.New(schema.Add, schema.Device{IMEI: "123"}, nil))
+	m = read()
+	if m.Method != schema.MethodEvent || m.Params.Event == nil || m.Params.Event.Device.IMEI != "123" {
+		t.Errorf("expected the event of 123 got %+v", m)
+	}
+
+	send("5", schema.MethodCommand, &schema.CommandParams{
+		Dongle:  "456",
+		Name:    "sms",
+		Command: schema.Command{Number: "+255", Text: "hi"},
+	})
+	m = read()
+	var res schema.Result
+	_ = json.Unmarshal(m.Result, &res)
+	if m.ID != "5" || !res.OK {
+		t.Errorf("expected the sms to be sent got %+v", m)
+	}
+	if v := <-ctl.sms; v != "123 +255 hi" {
+		t.Errorf("unexpected sms %s", v)
+	}
+
+	send("6", schema.MethodUnsubscribe, &schema.Subscription{Subscription: sub.Subscription})
+	if m = read(); m.ID != "6" || m.Error != nil {
+		t.Errorf("expected unsubscribed got %+v", m)
+	}
+	s.Send(events.New(schema.Remove, schema.Device{IMEI: "123"}, nil))
+	send("7", schema.MethodPing, nil)
+	if m = read(); m.ID != "7" {
+		t.Errorf("expected no event after unsubscribing got %+v", m)
+	}
+}
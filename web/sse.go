@@ -0,0 +1,129 @@
+package web
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/FarmRadioHangar/fdevices/db"
+	"github.com/FarmRadioHangar/fdevices/events"
+	"github.com/FarmRadioHangar/fdevices/schema"
+)
+
+// Heartbeat is how often a comment is sent to idle Server-Sent Events
+// clients, which keeps proxies from closing the connection.
+var Heartbeat = 15 * time.Second
+
+// GetEvents streams the dongles as Server-Sent Events. It takes the same
+// parameters as GetDongles, and sends the same things
+//
+//	event: snapshot
+//	data: [{"imei": "123", ...}]
+//
+//	id: 5f0c2a9e-42
+//	event: add
+//	data: {"version": 1, "seq": 42, "boot": "5f0c2a9e", "type": "add", ...}
+//
+// The id of an event is its boot and sequence number, so clients like
+// EventSource resume where they left off by sending the Last-Event-ID header,
+// which takes precedence over ?since. The id of the snapshot is that of the
+// event it was taken at, the events which follow come after it. A comment is
+// sent every Heartbeat when there are no events.
+func GetEvents(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseOptions(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, schema.CodeBadRequest, err.Error())
+		return
+	}
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		boot, n, err := schema.ParseID(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, schema.CodeBadRequest, "Last-Event-ID must be an event id")
+			return
+		}
+		opts.Boot, opts.Since = boot, n
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, schema.CodeInternal, "streaming not supported")
+		return
+	}
+	ctx := r.Context()
+	ql, ok := ctx.Value(db.CtxKey).(*sql.DB)
+	if !ok {
+		writeError(w, http.StatusServiceUnavailable, schema.CodeUnavailable, "database not available")
+		return
+	}
+	stream, ok := ctx.Value(evtCtxKey).(*events.Stream)
+	if !ok {
+		writeError(w, http.StatusServiceUnavailable, schema.CodeUnavailable, "event stream not available")
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	sub := subscribe(options(ctx), ql, stream, opts, func(gap *schema.Event, seq uint64, dongles []*db.Dongle) {
+		if gap != nil {
+			_ = writeEvent(w, gap)
+		}
+		id := ""
+		if seq > 0 {
+			id = schema.ID(stream.Boot(), seq)
+		}
+		_ = writeSSE(w, id, "snapshot", dongles)
+	})
+	defer stream.Unsubscribe(sub.ID)
+	flusher.Flush()
+
+	tick := time.NewTicker(Heartbeat)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			_, err = io.WriteString(w, ": heartbeat\n\n")
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			err = writeEvent(w, e)
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w io.Writer, e *schema.Event) error {
+	id := ""
+	if e.Type != schema.Gap {
+		id = schema.ID(e.Boot, e.Seq)
+	}
+	return writeSSE(w, id, string(e.Type), e)
+}
+
+// writeSSE writes v as JSON in a single event. The JSON encoding has no
+// newlines, so it fits on one data line.
+func writeSSE(w io.Writer, id, event string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		_, err = fmt.Fprintf(w, "id: %s\n", id)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	return err
+}
@@ -0,0 +1,98 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FarmRadioHangar/fdevices/events"
+	"github.com/FarmRadioHangar/fdevices/schema"
+)
+
+// readSSE returns the fields of the next event or comment read from r.
+func readSSE(t *testing.T, r *bufio.Reader) map[string]string {
+	o := make(map[string]string)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return o
+		}
+		if strings.HasPrefix(line, ":") {
+			o["comment"] = strings.TrimSpace(line[1:])
+			continue
+		}
+		kv := strings.SplitN(line, ": ", 2)
+		o[kv[0]] = kv[1]
+	}
+}
+
+func TestGetEvents(t *testing.T) {
+	ql := testDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := events.NewStream(10)
+	s.Start(ctx)
+	Heartbeat = 50 * time.Millisecond
+	ts := httptest.NewServer(PrepCtx(ql, s, Options{})(http.HandlerFunc(GetEvents)))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "?type=update")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected text/event-stream got %s", ct)
+	}
+	r := bufio.NewReader(res.Body)
+	ev := readSSE(t, r)
+	if ev["event"] != "snapshot" || !strings.Contains(ev["data"], `"imei":"123"`) {
+		t.Errorf("expected snapshot got %v", ev)
+	}
+	s.Send(events.New(schema.Add, schema.Device{IMEI: "123"}, nil))
+	s.Send(events.New(schema.Update, schema.Device{IMEI: "123"}, nil))
+	ev = readSSE(t, r)
+	if ev["id"] != schema.ID(s.Boot(), 2) || ev["event"] != "update" {
+		t.Errorf("expected update 2 got %v", ev)
+	}
+	ev = readSSE(t, r)
+	if ev["comment"] != "heartbeat" {
+		t.Errorf("expected heartbeat got %v", ev)
+	}
+	res.Body.Close()
+
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	req.Header.Set("Last-Event-ID", schema.ID(s.Boot(), 1))
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	r = bufio.NewReader(res.Body)
+	ev = readSSE(t, r)
+	if ev["id"] != schema.ID(s.Boot(), 2) || ev["event"] != "update" {
+		t.Errorf("expected update 2 got %v", ev)
+	}
+
+	// the same sequence number from before a restart
+	req.Header.Set("Last-Event-ID", schema.ID("0a1b2c3d", 1))
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	r = bufio.NewReader(res.Body)
+	if ev = readSSE(t, r); ev["event"] != "gap" {
+		t.Errorf("expected gap got %v", ev)
+	}
+	if ev = readSSE(t, r); ev["event"] != "snapshot" {
+		t.Errorf("expected snapshot got %v", ev)
+	}
+}
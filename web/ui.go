@@ -0,0 +1,229 @@
+package web
+
+import (
+	"net/http"
+)
+
+// dashboard is the page served at /ui. It follows the dongles over the
+// websocket with the requests of the schema package, and sends the commands
+// the API supports. The signal, operator, SIM state and health are those of
+// the dongle records, which the poller keeps up to date.
+const dashboard = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>fdevices</title>
+<style>
+body { font-family: sans-serif; margin: 0; background: #f4f4f4; color: #222; }
+header { background: #234; color: #fff; padding: .6em 1em; display: flex; justify-content: space-between; }
+#status.ok { color: #8d8; } #status.down { color: #f88; }
+main { display: flex; flex-wrap: wrap; gap: 1em; padding: 1em; }
+#dongles { flex: 2 1 20em; display: grid; grid-template-columns: repeat(auto-fill, minmax(18em, 1fr)); gap: 1em; align-content: start; }
+#log { flex: 1 1 16em; background: #fff; border-radius: 4px; padding: .5em; max-height: 80vh; overflow: auto; font: 12px monospace; }
+.card { background: #fff; border-radius: 4px; padding: .8em; box-shadow: 0 1px 2px rgba(0,0,0,.2); }
+.card h2 { font-size: 1em; margin: 0 0 .4em; display: flex; justify-content: space-between; }
+.card dl { display: grid; grid-template-columns: auto 1fr; gap: .1em .6em; margin: 0 0 .6em; font-size: .9em; }
+.card dt { color: #666; } .card dd { margin: 0; word-break: break-all; }
+.bars span { display: inline-block; width: 4px; margin-right: 1px; background: #ccc; vertical-align: bottom; }
+.bars span.on { background: #2a2; }
+.bad { color: #c22; } .good { color: #2a2; }
+button { margin: .1em; padding: .4em .7em; }
+#empty { color: #666; }
+</style>
+</head>
+<body>
+<header><b>fdevices</b><span id="status" class="down">connecting</span></header>
+<main>
+<section id="dongles"><p id="empty">No dongles.</p></section>
+<section id="log"></section>
+</main>
+<script>
+(function () {
+  var dongles = {};
+  var pending = {};
+  var nextID = 1;
+  var ws;
+  var token = new URLSearchParams(location.search).get("access_token");
+
+  function el(tag, attrs, text) {
+    var e = document.createElement(tag);
+    for (var k in attrs || {}) { e.setAttribute(k, attrs[k]); }
+    if (text !== undefined) { e.textContent = text; }
+    return e;
+  }
+
+  function log(msg, cls) {
+    var line = el("div", cls ? {"class": cls} : {}, new Date().toLocaleTimeString() + " " + msg);
+    var pane = document.getElementById("log");
+    pane.insertBefore(line, pane.firstChild);
+    while (pane.childNodes.length > 200) { pane.removeChild(pane.lastChild); }
+  }
+
+  function request(method, params) {
+    return new Promise(function (resolve, reject) {
+      var id = String(nextID++);
+      pending[id] = {resolve: resolve, reject: reject};
+      ws.send(JSON.stringify({id: id, method: method, params: params}));
+    });
+  }
+
+  function command(imei, name, params) {
+    params = params || {};
+    params.dongle = imei;
+    params.name = name;
+    return request("command", params).then(function (res) {
+      log(imei + " " + name + ": ok" + (res.output ? " " + res.output.trim() : ""), "good");
+      return true;
+    }, function (err) {
+      log(imei + " " + name + ": " + err.message, "bad");
+      alert(name + " on " + imei + " failed: " + err.message);
+      return false;
+    });
+  }
+
+  function bars(signal) {
+    var known = typeof signal === "number";
+    var span = el("span", {"class": "bars"});
+    var n = known ? Math.min(4, Math.ceil(signal / 8)) : 0;
+    for (var i = 1; i <= 4; i++) {
+      span.appendChild(el("span", {"class": i <= n ? "on" : "", style: "height:" + (i * 4) + "px"}));
+    }
+    span.title = known ? "RSSI " + signal : "unknown";
+    return span;
+  }
+
+  function render() {
+    var root = document.getElementById("dongles");
+    root.innerHTML = "";
+    var imeis = Object.keys(dongles).sort();
+    if (imeis.length === 0) {
+      root.appendChild(el("p", {id: "empty"}, "No dongles."));
+    }
+    imeis.forEach(function (imei) {
+      var d = dongles[imei];
+      var labels = d.labels || {};
+      var card = el("div", {"class": "card"});
+      var h = el("h2", {}, labels.name || labels.port || imei);
+      h.appendChild(bars(d.signal));
+      card.appendChild(h);
+      var dl = el("dl");
+      function row(k, v, cls) {
+        dl.appendChild(el("dt", {}, k));
+        dl.appendChild(el("dd", cls ? {"class": cls} : {}, v || "-"));
+      }
+      row("IMEI", d.imei);
+      row("IMSI", d.imsi);
+      row("ICCID", d.iccid);
+      row("SIM", d.sim || "unknown", d.sim ? (d.sim === "ready" ? "good" : "bad") : "");
+      row("health", d.health || "unknown", d.health ? (d.health === "ok" ? "good" : "bad") : "");
+      row("operator", d.operator);
+      row("port", labels.port);
+      row("tty", d.path);
+      row("symlinks", d.symlink ? "yes" : "no", d.symlink ? "good" : "bad");
+      row("model", d.ati);
+      card.appendChild(dl);
+      [["refresh", function () {
+        // the replies update the dongle, which comes back as an event
+        ["AT+CPIN?", "AT+CSQ", "AT+COPS?"].reduce(function (p, cmd) {
+          return p.then(function (ok) { return ok && command(imei, "at", {command: cmd}); });
+        }, Promise.resolve(true));
+      }], ["sms", function () {
+        var number = prompt("Send an SMS from " + imei + " to");
+        if (!number) { return; }
+        var text = prompt("Text");
+        if (text === null) { return; }
+        command(imei, "sms", {number: number, text: text});
+      }], ["at", function () {
+        var cmd = prompt("AT command for " + imei, "AT");
+        if (cmd) { command(imei, "at", {command: cmd}); }
+      }], ["reset", function () {
+        if (confirm("Reset " + imei + "?")) { command(imei, "reset"); }
+      }]].forEach(function (b) {
+        var button = el("button", {}, b[0]);
+        button.onclick = b[1];
+        card.appendChild(button);
+      });
+      root.appendChild(card);
+    });
+  }
+
+  function onEvent(e) {
+    var label = e.type + " " + (e.device.imei || e.device.path || "");
+    if (e.changes) {
+      label += " " + e.changes.map(function (c) { return c.field + "=" + c.new; }).join(" ");
+    }
+    log(label, e.type === "remove" ? "bad" : "");
+    if (e.type === "gap") {
+      return;
+    }
+    if (e.type === "remove") {
+      delete dongles[e.device.imei];
+    } else if (e.type === "add" || e.type === "update") {
+      var d = e.data;
+      d.labels = e.device.labels;
+      dongles[e.device.imei] = d;
+    }
+    render();
+  }
+
+  function onMessage(msg) {
+    if (msg.id && pending[msg.id]) {
+      var p = pending[msg.id];
+      delete pending[msg.id];
+      if (msg.error) { p.reject(msg.error); } else { p.resolve(msg.result); }
+      return;
+    }
+    if (msg.error) {
+      log(msg.error.message, "bad");
+      return;
+    }
+    switch (msg.method) {
+    case "snapshot":
+      dongles = {};
+      (msg.params.dongles || []).forEach(function (d) { dongles[d.imei] = d; });
+      render();
+      break;
+    case "event":
+      onEvent(msg.params.event);
+      break;
+    case "closed":
+      log("subscription closed: " + msg.params.reason, "bad");
+      ws.close();
+      break;
+    }
+  }
+
+  function connect() {
+    var u = (location.protocol === "https:" ? "wss://" : "ws://") + location.host + "/?subscribe=false";
+    if (token) { u += "&access_token=" + encodeURIComponent(token); }
+    ws = new WebSocket(u);
+    var status = document.getElementById("status");
+    ws.onopen = function () {
+      status.textContent = "live";
+      status.className = "ok";
+      request("subscribe", {}).catch(function (err) { log(err.message, "bad"); });
+    };
+    ws.onmessage = function (m) { onMessage(JSON.parse(m.data)); };
+    ws.onclose = function () {
+      status.textContent = "disconnected";
+      status.className = "down";
+      for (var id in pending) { pending[id].reject({message: "disconnected"}); }
+      pending = {};
+      setTimeout(connect, 2000);
+    };
+  }
+
+  connect();
+})();
+</script>
+</body>
+</html>
+`
+
+// GetDashboard serves a page showing the dongles live, with buttons for the
+// commands.
+func GetDashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(dashboard))
+}
@@ -3,21 +3,109 @@ package web
 import (
 	"context"
 	"database/sql"
-	"fmt"
+	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
+	"github.com/FarmRadioHangar/fdevices/auth"
+	"github.com/FarmRadioHangar/fdevices/control"
 	"github.com/FarmRadioHangar/fdevices/db"
 	"github.com/FarmRadioHangar/fdevices/events"
+	"github.com/FarmRadioHangar/fdevices/schema"
 	"github.com/gernest/alien"
 	"github.com/gorilla/websocket"
 )
 
-const evtCtxKey = "_stream"
+const (
+	evtCtxKey  = "_stream"
+	optsCtxKey = "_options"
+)
+
+var upgrader = websocket.Upgrader{CheckOrigin: checkOrigin}
+
+// Options are the settings of the API served by New and GRPC.
+type Options struct {
+	// DeviceOf returns the device of a dongle as it is set on events. It is
+	// used to filter the dongles sent to clients, by default only the
+	// identity of the dongle is known and not its labels.
+	DeviceOf func(d *db.Dongle) schema.Device
+
+	// Origins are the origins allowed to open websockets, like
+	// https://example.com, or * for any origin. When it is empty only pages
+	// served from the same host as the API are allowed.
+	Origins []string
 
-var upgrader = websocket.Upgrader{} // use default options
+	// Commands runs the commands sent to the API, they are refused when it
+	// is nil.
+	Commands control.Controller
 
+	// Auth authenticates the clients. Every client is let in when it is nil,
+	// see Auth.
+	Auth *auth.Authenticator
+}
+
+// device returns the device of d, see DeviceOf.
+func (o Options) device(d *db.Dongle) schema.Device {
+	if o.DeviceOf == nil {
+		return d.Device()
+	}
+	return o.DeviceOf(d)
+}
+
+// anonymous returns the identity of the clients when authentication is
+// disabled. It can only read, unless commands are enabled.
+func (o Options) anonymous() *auth.Identity {
+	id := &auth.Identity{Name: "anonymous", Scopes: []string{auth.Read}}
+	if o.Commands != nil {
+		id.Scopes = append(id.Scopes, auth.SMS, auth.Control)
+	}
+	return id
+}
+
+// options returns the options put on ctx by PrepCtx.
+func options(ctx context.Context) Options {
+	o, _ := ctx.Value(optsCtxKey).(Options)
+	return o
+}
+
+// GetDongles streams the dongles over a websocket. The list of dongles is sent
+// first, followed by the events of the stream.
+//
+// A client which reconnects can pass the id of the last event it received as
+// ?since=<boot>-<seq>, the events it missed are then sent instead of the list
+// of dongles. When those events are no longer available, or were sent before
+// fdevices restarted, a gap event is sent, followed by the list of dongles.
+//
+// The connection is closed when the client falls too far behind, unless a
+// different policy is asked for with ?policy=drop-oldest or drop-newest.
+//
+// Clients can ask for a subset of the events with ?type=add,remove, ?imei=,
+// ?imsi=, ?iccid= and ?label=port=1-1.3,name=news. Parameters can be repeated
+// or hold comma separated values, a device has to match every parameter
+// given. The list of dongles is filtered the same way.
+//
+// The list of dongles is a bare array. With ?snapshot=id it is a
+// schema.Snapshot instead, which carries the id of the event the list was
+// taken at, so the client can resume after it.
+//
+// Clients can send requests over the same connection, like
+//
+//	{"id": "1", "method": "subscribe", "params": {"types": ["add"], "imei": ["123"]}}
+//	{"id": "2", "method": "command", "params": {"dongle": "123", "name": "sms", "number": "+255", "text": "hi"}}
+//
+// which are answered by a response with the same id. The methods and
+// messages are defined in the schema package. With ?subscribe=false the
+// connection starts without the subscription of the query parameters.
 func GetDongles(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseOptions(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, schema.CodeBadRequest, err.Error())
+		return
+	}
 	ws, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		if _, ok := err.(websocket.HandshakeError); !ok {
@@ -27,66 +115,209 @@ func GetDongles(w http.ResponseWriter, r *http.Request) {
 	}
 	ctx := r.Context()
 	ql, ok := ctx.Value(db.CtxKey).(*sql.DB)
-	if !ok {
-		// Log something and return?
+	stream, sok := ctx.Value(evtCtxKey).(*events.Stream)
+	if !ok || !sok {
+		log.Println("websocket: database or event stream not available")
+		msg := websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "unavailable")
+		_ = ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeWait))
+		ws.Close()
 		return
 	}
+	c := newConn(ctx, ws, ql, stream)
+	if r.URL.Query().Get("subscribe") != "false" {
+		withID := r.URL.Query().Get("snapshot") == "id"
+		sub := subscribe(c.opts, ql, stream, opts, func(gap *schema.Event, seq uint64, dongles []*db.Dongle) {
+			if gap != nil {
+				_ = c.write(gap)
+			}
+			if !withID {
+				_ = c.write(dongles)
+				return
+			}
+			v := &schema.Snapshot{Dongles: []*schema.Dongle{}}
+			if seq > 0 {
+				v.ID = schema.ID(stream.Boot(), seq)
+			}
+			for _, d := range dongles {
+				v.Dongles = append(v.Dongles, c.opts.resource(d))
+			}
+			_ = c.write(v)
+		})
+		c.add(sub)
+		c.follow(sub, true)
+	}
+	c.run(ctx)
+}
+
+// parseOptions returns the subscription asked for in the query q, with the
+// since, policy and filter parameters.
+func parseOptions(q url.Values) (events.Options, error) {
+	opts := events.Options{Policy: events.Disconnect}
+	f, err := parseFilter(q)
+	if err != nil {
+		return opts, err
+	}
+	opts.Filter = f
+	if v := q.Get("since"); v != "" {
+		boot, n, err := schema.ParseID(v)
+		if err != nil {
+			return opts, errors.New("since must be an event id")
+		}
+		opts.Boot, opts.Since = boot, n
+	}
+	if v := q.Get("policy"); v != "" {
+		p, err := events.ParsePolicy(v)
+		if err != nil {
+			return opts, err
+		}
+		opts.Policy = p
+	}
+	return opts, nil
+}
+
+// subscribe subscribes to stream. When opts.Since is zero, or the events after
+// it are no longer available, snapshot is called with the dongles passing the
+// filter before any event is delivered. The gap event is passed to snapshot
+// when events were missed.
+//
+// The subscription is made before the dongles are read, and seq is the
+// sequence number it starts at, in the boot of stream. No change is lost
+// between the two, the events after seq may however already be part of the
+// snapshot. The dongles are filtered with the devices of o.
+func subscribe(o Options, ql *sql.DB, stream *events.Stream, opts events.Options, snapshot func(gap *schema.Event, seq uint64, dongles []*db.Dongle)) *events.Subscription {
+	var gap *schema.Event
+	if opts.Since > 0 {
+		sub, err := stream.Subscribe(opts)
+		if err == nil {
+			return sub
+		}
+		gap = events.New(schema.Gap, schema.Device{}, &schema.Missed{
+			Since:  opts.Since,
+			Oldest: stream.Oldest(),
+		})
+		opts.Since = 0
+	}
+	// without Since there is nothing to replay and no error
+	sub, _ := stream.Subscribe(opts)
 	dongles, err := db.GetDistinct(ql)
 	if err != nil {
-		// log something?
-		fmt.Printf("ERROR: %v\n", err)
+		log.Printf("ERROR: %v", err)
 	}
-	if dongles == nil {
-		dongles = []*db.Dongle{}
+	list := []*db.Dongle{}
+	for _, d := range dongles {
+		if opts.Filter.MatchDevice(o.device(d)) {
+			list = append(list, d)
+		}
 	}
-	_ = ws.WriteJSON(dongles)
-	stream, ok := ctx.Value(evtCtxKey).(*events.Stream)
+	snapshot(gap, sub.Seq, list)
+	return sub
+}
+
+// GetSubscribers lists the subscribers of the event stream, with the number
+// of events delivered to them and dropped because they were too slow.
+func GetSubscribers(w http.ResponseWriter, r *http.Request) {
+	stream, ok := r.Context().Value(evtCtxKey).(*events.Stream)
 	if !ok {
-		// Log something and return?
+		writeError(w, http.StatusServiceUnavailable, schema.CodeUnavailable, "event stream not available")
 		return
 	}
-	ch, evts := stream.Subscribe()
-	defer stream.Unsubscribe(ch)
-	go func() {
-		for {
-			select {
-			case ev := <-evts:
-				_ = ws.WriteJSON(ev)
-			}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(stream.Stats())
+}
+
+// GetPorts lists the serial devices which were not probed for a modem,
+// together with the reason they were left alone.
+func GetPorts(w http.ResponseWriter, r *http.Request) {
+	ql, ok := r.Context().Value(db.CtxKey).(*sql.DB)
+	if !ok {
+		writeError(w, http.StatusServiceUnavailable, schema.CodeUnavailable, "database not available")
+		return
+	}
+	ports, err := db.GetAllPorts(ql)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, schema.CodeInternal, err.Error())
+		return
+	}
+	if ports == nil {
+		ports = []*db.Port{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(ports)
+}
+
+// parseFilter returns the event filter asked for in the query q, or nil when
+// there is none.
+func parseFilter(q url.Values) (*events.Filter, error) {
+	f := &events.Filter{}
+	for _, t := range values(q, "type") {
+		f.Types = append(f.Types, schema.Type(t))
+	}
+	f.IMEI = values(q, "imei")
+	f.IMSI = values(q, "imsi")
+	f.ICCID = values(q, "iccid")
+	for _, v := range q["label"] {
+		l, err := events.ParseSelector(v)
+		if err != nil {
+			return nil, err
+		}
+		if f.Labels == nil {
+			f.Labels = make(map[string]string)
+		}
+		for k, v := range l {
+			f.Labels[k] = v
 		}
-	}()
-	reader(ctx, ws)
+	}
+	if len(f.Types) == 0 && len(f.IMEI) == 0 && len(f.IMSI) == 0 &&
+		len(f.ICCID) == 0 && len(f.Labels) == 0 {
+		return nil, nil
+	}
+	return f, nil
 }
 
-func reader(ctx context.Context, ws *websocket.Conn) {
-	defer ws.Close()
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			_, _, err := ws.ReadMessage()
-			if err != nil {
-				log.Println(err)
+// values returns the values of the query parameter key, which can be repeated
+// and hold comma separated values.
+func values(q url.Values, key string) []string {
+	var o []string
+	for _, v := range q[key] {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				o = append(o, s)
 			}
 		}
 	}
+	return o
 }
 
-func PrepCtx(ql *sql.DB, s *events.Stream) func(http.Handler) http.Handler {
+func PrepCtx(ql *sql.DB, s *events.Stream, o Options) func(http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ctx := context.WithValue(r.Context(), db.CtxKey, ql)
 			ctx = context.WithValue(ctx, evtCtxKey, s)
+			ctx = context.WithValue(ctx, optsCtxKey, o)
 			r = r.WithContext(ctx)
 			h.ServeHTTP(w, r)
 		})
 	}
 }
 
-func New(ql *sql.DB, s *events.Stream) *alien.Mux {
+// New returns the mux of the API, every route added to it is authenticated
+// with Auth. The command route is only there when o.Commands is set.
+func New(ql *sql.DB, s *events.Stream, o Options) *alien.Mux {
 	m := alien.New()
-	m.Use(PrepCtx(ql, s))
+	m.Use(PrepCtx(ql, s, o), func(h http.Handler) http.Handler { return Auth(o, h) })
 	m.Get("/", GetDongles)
+	m.Get("/ports", GetPorts)
+	m.Get("/subscribers", GetSubscribers)
+	m.Get("/api/events", GetEvents)
+	m.Get("/api/v1/dongles", ListDongles)
+	m.Get("/api/v1/dongles/:id", GetDongle)
+	m.Get("/api/v1/ports", ListPorts)
+	m.Get("/api/openapi.json", GetOpenAPI)
+	m.Get("/ui", GetDashboard)
+	m.Get("/metrics", GetMetrics)
+	m.Get("/healthz", GetHealth)
+	if o.Commands != nil {
+		m.Post("/api/v1/dongles/:id/commands/:name", PostCommand(o.Commands))
+	}
 	return m
 }
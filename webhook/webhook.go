@@ -0,0 +1,472 @@
+// Package webhook posts events to HTTP endpoints.
+//
+// Every event is queued for each endpoint whose filter it passes. The queue is
+// kept in a JSON file, so deliveries survive a restart, and failed deliveries
+// are retried with exponential backoff. Every endpoint is posted to on its
+// own, so an endpoint which is down does not hold up the others.
+//
+// The body of a request is the event, encoded as by the schema package. The
+// request carries the headers
+//
+//	X-Fdevices-Delivery:  the id of the delivery, the same for every attempt
+//	X-Fdevices-Event:     the event type
+//	X-Fdevices-Signature: sha256=<hex HMAC-SHA256 of the body>
+//
+// The signature is only set when the endpoint has a secret. A delivery is
+// done when the endpoint answers with a 2xx status code.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/FarmRadioHangar/fdevices/events"
+	"github.com/FarmRadioHangar/fdevices/log"
+	"github.com/FarmRadioHangar/fdevices/schema"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Request headers.
+const (
+	DeliveryHeader  = "X-Fdevices-Delivery"
+	EventHeader     = "X-Fdevices-Event"
+	SignatureHeader = "X-Fdevices-Signature"
+)
+
+// Defaults for the retries of a Dispatcher.
+const (
+	DefaultMaxAttempts = 10
+	DefaultMaxPending  = 1000
+	DefaultMinBackoff  = 5 * time.Second
+	DefaultMaxBackoff  = 30 * time.Minute
+	DefaultTimeout     = 30 * time.Second
+)
+
+// Status of a delivery.
+const (
+	// Pending deliveries are waiting for their next attempt.
+	Pending = "pending"
+
+	// Failed deliveries were given up after too many attempts.
+	Failed = "failed"
+)
+
+// maxFailed is the number of failed deliveries which are kept around to be
+// listed.
+const maxFailed = 100
+
+// Endpoint is where events are posted to.
+type Endpoint struct {
+	URL string
+
+	// Secret is the key of the request signature, no signature is sent when
+	// it is empty.
+	Secret string
+
+	// Filter selects the events posted to the endpoint, all events are posted
+	// when it is nil.
+	Filter *events.Filter
+}
+
+// Delivery is an event on its way to an endpoint.
+type Delivery struct {
+	ID        string        `json:"id"`
+	URL       string        `json:"url"`
+	Status    string        `json:"status"`
+	Attempts  int           `json:"attempts"`
+	Next      time.Time     `json:"next_attempt"`
+	LastError string        `json:"last_error,omitempty"`
+	CreatedOn time.Time     `json:"created_on"`
+	Event     *schema.Event `json:"event"`
+}
+
+// Dispatcher posts events to endpoints.
+//
+// This is safe to use concurrently in multiple goroutines
+type Dispatcher struct {
+	// MaxAttempts is the number of attempts after which a delivery fails.
+	MaxAttempts int
+
+	// MaxPending is the number of pending deliveries kept for an endpoint,
+	// the oldest ones fail when there are more. There is no limit when it
+	// is zero.
+	MaxPending int
+
+	// MinBackoff is the wait after the first failed attempt, it doubles with
+	// every attempt up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	Client *http.Client
+
+	endpoints map[string]Endpoint
+	order     []string
+	path      string
+	wake      chan struct{}
+
+	mu    sync.Mutex
+	queue []*Delivery
+}
+
+// New returns a Dispatcher posting events to endpoints, which keeps its queue
+// in the file at path. Deliveries in the queue for endpoints which are no
+// longer given are dropped.
+func New(endpoints []Endpoint, path string) (*Dispatcher, error) {
+	d := &Dispatcher{
+		MaxAttempts: DefaultMaxAttempts,
+		MaxPending:  DefaultMaxPending,
+		MinBackoff:  DefaultMinBackoff,
+		MaxBackoff:  DefaultMaxBackoff,
+		Client:      &http.Client{Timeout: DefaultTimeout},
+		endpoints:   make(map[string]Endpoint),
+		path:        path,
+		wake:        make(chan struct{}, 1),
+	}
+	for _, e := range endpoints {
+		if _, ok := d.endpoints[e.URL]; !ok {
+			d.order = append(d.order, e.URL)
+		}
+		d.endpoints[e.URL] = e
+	}
+	var queue []*Delivery
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(b) > 0 {
+		err = json.Unmarshal(b, &queue)
+		if err != nil {
+			return nil, fmt.Errorf("webhook: %s: %v", path, err)
+		}
+	}
+	for _, v := range queue {
+		if _, ok := d.endpoints[v.URL]; ok {
+			d.queue = append(d.queue, v)
+		}
+	}
+	return d, nil
+}
+
+// Enqueue queues e for every endpoint whose filter it passes.
+func (d *Dispatcher) Enqueue(e *schema.Event) error {
+	if e.Type == schema.Gap {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	n := 0
+	for _, u := range d.order {
+		if !d.endpoints[u].Filter.Match(e) {
+			continue
+		}
+		d.queue = append(d.queue, &Delivery{
+			ID:        uuid.NewV4().String(),
+			URL:       u,
+			Status:    Pending,
+			Next:      now,
+			CreatedOn: now,
+			Event:     e,
+		})
+		d.limit(u)
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	return d.save()
+}
+
+// Deliveries returns the pending and failed deliveries, oldest first.
+func (d *Dispatcher) Deliveries() []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	o := make([]Delivery, len(d.queue))
+	for i, v := range d.queue {
+		o[i] = *v
+	}
+	return o
+}
+
+// ServeHTTP lists the deliveries as JSON. The list can be narrowed down with
+// ?status=pending or ?status=failed.
+func (d *Dispatcher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	o := []Delivery{}
+	for _, v := range d.Deliveries() {
+		if status == "" || v.Status == status {
+			o = append(o, v)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(o)
+}
+
+// Run queues the events of s and delivers them until ctx is done. It returns
+// once every event it received is queued.
+func (d *Dispatcher) Run(ctx context.Context, s *events.Stream) error {
+	sub, err := s.Subscribe(events.Options{Policy: events.DropOldest})
+	if err != nil {
+		return err
+	}
+	queued := make(chan struct{})
+	defer func() {
+		s.Unsubscribe(sub.ID)
+		<-queued
+	}()
+	go func() {
+		defer close(queued)
+		for e := range sub.C {
+			err := d.Enqueue(e)
+			if err != nil {
+				log.Error("webhook: %v", err)
+			}
+		}
+	}()
+	for {
+		wait := time.Hour
+		if next := d.flush(ctx); !next.IsZero() {
+			wait = next.Sub(time.Now())
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil
+		case <-d.wake:
+		case <-t.C:
+		}
+		t.Stop()
+	}
+}
+
+// flush makes an attempt at the deliveries which are due, and returns when the
+// next pending delivery is due. The endpoints are posted to concurrently.
+func (d *Dispatcher) flush(ctx context.Context) time.Time {
+	d.mu.Lock()
+	due := make(map[string][]*Delivery)
+	now := time.Now()
+	for _, v := range d.queue {
+		if v.Status == Pending && !v.Next.After(now) {
+			due[v.URL] = append(due[v.URL], v)
+		}
+	}
+	d.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, q := range due {
+		wg.Add(1)
+		go func(q []*Delivery) {
+			defer wg.Done()
+			d.deliver(ctx, q)
+		}(q)
+	}
+	wg.Wait()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var next time.Time
+	for _, v := range d.queue {
+		if v.Status == Pending && (next.IsZero() || v.Next.Before(next)) {
+			next = v.Next
+		}
+	}
+	return next
+}
+
+// deliver makes an attempt at the due deliveries q of a single endpoint, in
+// order. It stops at the first failure, the rest of q then waits for the
+// failed delivery to be retried.
+func (d *Dispatcher) deliver(ctx context.Context, q []*Delivery) {
+	for i, v := range q {
+		if ctx.Err() != nil {
+			return
+		}
+		err := d.post(ctx, v)
+		d.mu.Lock()
+		d.done(v, err)
+		if err != nil && v.Status == Pending {
+			for _, w := range q[i+1:] {
+				if w.Next.Before(v.Next) {
+					w.Next = v.Next
+				}
+			}
+		}
+		if serr := d.save(); serr != nil {
+			log.Error("webhook: %v", serr)
+		}
+		d.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// done records the outcome of an attempt at v, it must be called with the
+// lock held.
+func (d *Dispatcher) done(v *Delivery, err error) {
+	v.Attempts++
+	if err == nil {
+		d.remove(v)
+		return
+	}
+	v.LastError = err.Error()
+	if v.Attempts >= d.MaxAttempts {
+		v.Status = Failed
+		d.trim()
+		return
+	}
+	v.Next = time.Now().Add(d.backoff(v.Attempts))
+}
+
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	b := d.MinBackoff
+	for i := 1; i < attempts && b < d.MaxBackoff; i++ {
+		b *= 2
+	}
+	if b > d.MaxBackoff {
+		b = d.MaxBackoff
+	}
+	return b
+}
+
+func (d *Dispatcher) remove(v *Delivery) {
+	for i := range d.queue {
+		if d.queue[i] == v {
+			d.queue = append(d.queue[:i], d.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// limit fails the oldest pending deliveries to the endpoint u when there are
+// more than MaxPending, it must be called with the lock held.
+func (d *Dispatcher) limit(u string) {
+	n := 0
+	for _, v := range d.queue {
+		if v.URL == u && v.Status == Pending {
+			n++
+		}
+	}
+	if d.MaxPending <= 0 || n <= d.MaxPending {
+		return
+	}
+	for _, v := range d.queue {
+		if n <= d.MaxPending {
+			break
+		}
+		if v.URL == u && v.Status == Pending {
+			log.Error("webhook: %s: dropping delivery %s, too many pending deliveries", u, v.ID)
+			v.Status = Failed
+			v.LastError = "too many pending deliveries"
+			n--
+		}
+	}
+	d.trim()
+}
+
+// trim drops the oldest failed deliveries when there are more than maxFailed.
+func (d *Dispatcher) trim() {
+	n := 0
+	for _, v := range d.queue {
+		if v.Status == Failed {
+			n++
+		}
+	}
+	var q []*Delivery
+	for _, v := range d.queue {
+		if v.Status == Failed && n > maxFailed {
+			n--
+			continue
+		}
+		q = append(q, v)
+	}
+	d.queue = q
+}
+
+func (d *Dispatcher) post(ctx context.Context, v *Delivery) error {
+	body, err := json.Marshal(v.Event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, v.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryHeader, v.ID)
+	req.Header.Set(EventHeader, string(v.Event.Type))
+	if secret := d.endpoints[v.URL].Secret; secret != "" {
+		req.Header.Set(SignatureHeader, Sign(secret, body))
+	}
+	res, err := d.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook: %s: %s", v.URL, res.Status)
+	}
+	return nil
+}
+
+// Sign returns the signature header value of body, signed with secret.
+func Sign(secret string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(body)
+	return "sha256=" + hex.EncodeToString(h.Sum(nil))
+}
+
+// Verify returns true when signature is the signature of body signed with
+// secret. Receivers can use it to check requests.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, body)))
+}
+
+// save writes the queue, it must be called with the lock held. The file is
+// replaced atomically.
+func (d *Dispatcher) save() error {
+	b, err := json.Marshal(d.queue)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(d.path)
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(d.path))
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), d.path)
+}
@@ -0,0 +1,205 @@
+package webhook
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/FarmRadioHangar/fdevices/events"
+	"github.com/FarmRadioHangar/fdevices/schema"
+)
+
+type request struct {
+	delivery  string
+	signature string
+	body      []byte
+}
+
+func TestDeliverWithRetries(t *testing.T) {
+	var mu sync.Mutex
+	var got []request
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, request{
+			delivery:  r.Header.Get(DeliveryHeader),
+			signature: r.Header.Get(SignatureHeader),
+			body:      b,
+		})
+		if len(got) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		close(done)
+	}))
+	defer ts.Close()
+
+	d, err := New([]Endpoint{{URL: ts.URL, Secret: "s3cret"}}, filepath.Join(t.TempDir(), "webhooks.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.MinBackoff = time.Millisecond
+	d.MaxBackoff = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := events.NewStream(10)
+	s.Start(ctx)
+	ran := make(chan struct{})
+	go func() {
+		d.Run(ctx, s)
+		close(ran)
+	}()
+	defer func() {
+		cancel()
+		<-ran
+	}()
+	for len(s.Stats()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	s.Send(events.New(schema.Add, schema.Device{IMEI: "123"}, nil))
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for delivery")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, v := range got {
+		if v.delivery != got[0].delivery {
+			t.Errorf("expected delivery id %s got %s", got[0].delivery, v.delivery)
+		}
+		if !Verify("s3cret", v.body, v.signature) {
+			t.Errorf("bad signature %s", v.signature)
+		}
+	}
+	e, err := schema.Decode(got[0].body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Device.IMEI != "123" {
+		t.Errorf("expected 123 got %s", e.Device.IMEI)
+	}
+}
+
+func TestFilterAndFail(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+	d, err := New([]Endpoint{{
+		URL:    ts.URL,
+		Filter: &events.Filter{Types: []schema.Type{schema.Remove}},
+	}}, filepath.Join(t.TempDir(), "webhooks.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.MinBackoff = time.Millisecond
+	d.MaxBackoff = 10 * time.Millisecond
+	d.MaxAttempts = 2
+	_ = d.Enqueue(events.New(schema.Add, schema.Device{IMEI: "123"}, nil))
+	_ = d.Enqueue(events.New(schema.Remove, schema.Device{IMEI: "123"}, nil))
+	q := d.Deliveries()
+	if len(q) != 1 || q[0].Event.Type != schema.Remove {
+		t.Fatalf("expected one remove delivery got %v", q)
+	}
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		time.Sleep(d.MaxBackoff)
+		d.flush(ctx)
+	}
+	q = d.Deliveries()
+	if len(q) != 1 || q[0].Status != Failed || q[0].Attempts != 2 || q[0].LastError == "" {
+		t.Errorf("expected a failed delivery got %+v", q)
+	}
+}
+
+func TestQueuePersists(t *testing.T) {
+	d, err := New([]Endpoint{{URL: "http://a.invalid"}, {URL: "http://b.invalid"}}, filepath.Join(t.TempDir(), "webhooks.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Enqueue(events.New(schema.Update, schema.Device{IMEI: "123"}, &schema.Dongle{IMEI: "123"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := New([]Endpoint{{URL: "http://b.invalid"}}, d.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := n.Deliveries()
+	if len(q) != 1 || q[0].URL != "http://b.invalid" || q[0].Status != Pending {
+		t.Fatalf("expected one pending delivery got %+v", q)
+	}
+	if _, ok := q[0].Event.Data.(*schema.Dongle); !ok {
+		t.Errorf("expected *schema.Dongle got %T", q[0].Event.Data)
+	}
+}
+
+func TestFailingEndpoint(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	handler := func(status int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			hits[r.Host]++
+			mu.Unlock()
+			w.WriteHeader(status)
+		}
+	}
+	down := httptest.NewServer(handler(http.StatusServiceUnavailable))
+	defer down.Close()
+	up := httptest.NewServer(handler(http.StatusOK))
+	defer up.Close()
+	d, err := New([]Endpoint{{URL: down.URL}, {URL: up.URL}}, filepath.Join(t.TempDir(), "webhooks.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		_ = d.Enqueue(events.New(schema.Add, schema.Device{IMEI: "123"}, nil))
+	}
+	next := d.flush(context.Background())
+	mu.Lock()
+	defer mu.Unlock()
+	if n := hits[strings.TrimPrefix(down.URL, "http://")]; n != 1 {
+		t.Errorf("expected a single attempt at the failing endpoint got %d", n)
+	}
+	if n := hits[strings.TrimPrefix(up.URL, "http://")]; n != 3 {
+		t.Errorf("expected 3 deliveries got %d", n)
+	}
+	q := d.Deliveries()
+	if len(q) != 3 || q[0].Attempts != 1 || q[1].Attempts != 0 {
+		t.Fatalf("expected 3 pending deliveries got %+v", q)
+	}
+	if !q[1].Next.Equal(q[0].Next) || !next.Equal(q[0].Next) {
+		t.Errorf("expected the deliveries to wait for the retry at %v got %+v", q[0].Next, q)
+	}
+}
+
+func TestMaxPending(t *testing.T) {
+	d, err := New([]Endpoint{{URL: "http://a.invalid"}}, filepath.Join(t.TempDir(), "webhooks.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.MaxPending = 2
+	for _, imei := range []string{"1", "2", "3"} {
+		_ = d.Enqueue(events.New(schema.Add, schema.Device{IMEI: imei}, nil))
+	}
+	q := d.Deliveries()
+	if len(q) != 3 || q[0].Status != Failed || q[0].Event.Device.IMEI != "1" || q[0].LastError == "" {
+		t.Fatalf("expected the oldest delivery to fail got %+v", q)
+	}
+	for _, v := range q[1:] {
+		if v.Status != Pending {
+			t.Errorf("expected a pending delivery got %+v", v)
+		}
+	}
+}